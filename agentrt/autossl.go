@@ -0,0 +1,148 @@
+package agentrt
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/pushclient"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// autoSslRenewInterval is the interval the expiry of the AutoSSL certificate gets checked
+var autoSslRenewInterval = time.Hour
+
+// certificateSubmitter sends the csr to openITCOCKPIT (implemented by the push client)
+type certificateSubmitter interface {
+	SubmitCsr(ctx context.Context, csr []byte) (*pushclient.CertificateResponse, error)
+}
+
+// autoSslRenewalDue returns the AutoSSL certificate if it expires within autossl-renew-days
+// Returns nil if AutoSSL or the renewal is disabled or there is no certificate yet
+func autoSslRenewalDue(cfg *config.Configuration, now time.Time) (*x509.Certificate, error) {
+	if cfg == nil || !cfg.AutoSslEnabled || cfg.AutoSslRenewDays <= 0 || !utils.FileExists(cfg.AutoSslCrtFile) {
+		return nil, nil
+	}
+	cert, err := utils.ParseCertificateFile(cfg.AutoSslCrtFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read certificate: %w", err)
+	}
+	if utils.CertificateDaysRemaining(cert, now) > cfg.AutoSslRenewDays {
+		return nil, nil
+	}
+	return cert, nil
+}
+
+// autoSslCsrPending returns true if the csr file was written after the certificate, so it was not signed yet
+func autoSslCsrPending(cfg *config.Configuration) bool {
+	csrInfo, err := os.Stat(cfg.AutoSslCsrFile)
+	if err != nil {
+		return false
+	}
+	crtInfo, err := os.Stat(cfg.AutoSslCrtFile)
+	if err != nil {
+		return true
+	}
+	return csrInfo.ModTime().After(crtInfo.ModTime())
+}
+
+// renewAutoSslCertificate creates a new csr for the certificate, with autossl-push-renewal the csr gets submitted to
+// openITCOCKPIT. Otherwise openITCOCKPIT requests the csr when the agent check reports that the renewal is due and
+// a pending csr is kept.
+func renewAutoSslCertificate(ctx context.Context, cfg *config.Configuration, cert *x509.Certificate, submitter certificateSubmitter) error {
+	if submitter == nil && autoSslCsrPending(cfg) {
+		log.Debugln("AutoSSL: CSR for the certificate renewal is pending")
+		return nil
+	}
+
+	domain := cert.Subject.CommonName
+	if len(cert.DNSNames) > 0 {
+		domain = cert.DNSNames[0]
+	}
+	csr, err := utils.CSRFromKeyFile(cfg.AutoSslKeyFile, domain)
+	if err != nil {
+		return fmt.Errorf("could not generate csr: %w", err)
+	}
+	if err := os.WriteFile(cfg.AutoSslCsrFile, csr, 0600); err != nil {
+		return fmt.Errorf("could not store csr: %w", err)
+	}
+	log.Infoln("AutoSSL: CSR for the certificate renewal generated")
+
+	if submitter == nil {
+		return nil
+	}
+	res, err := submitter.SubmitCsr(ctx, csr)
+	if err != nil {
+		return err
+	}
+	if res.Signed == "" {
+		log.Infoln("AutoSSL: openITCOCKPIT did not sign the CSR yet, retry in ", autoSslRenewInterval)
+		return nil
+	}
+	if err := writeAutoSslCertificate(cfg, res); err != nil {
+		return err
+	}
+	// The webserver loads the new files without a restart
+	log.Infoln("AutoSSL: certificate renewed")
+	return nil
+}
+
+// writeAutoSslCertificate stores the signed certificate and ca, the response is validated before any file gets replaced
+func writeAutoSslCertificate(cfg *config.Configuration, res *pushclient.CertificateResponse) error {
+	if _, err := utils.ParseCertificatePEM([]byte(res.Signed)); err != nil {
+		return fmt.Errorf("openITCOCKPIT returned an invalid certificate: %w", err)
+	}
+	if res.CA != "" {
+		if _, err := utils.ParseCertificatePEM([]byte(res.CA)); err != nil {
+			return fmt.Errorf("openITCOCKPIT returned an invalid ca certificate: %w", err)
+		}
+	}
+
+	if err := os.WriteFile(cfg.AutoSslCrtFile, []byte(res.Signed), 0600); err != nil {
+		return fmt.Errorf("could not write certificate file: %w", err)
+	}
+	if res.CA != "" {
+		if err := os.WriteFile(cfg.AutoSslCaFile, []byte(res.CA), 0600); err != nil {
+			return fmt.Errorf("could not write ca certificate file: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkAutoSslRenewal starts the renewal in background if the certificate expires soon, must be called by the agent routine
+func (a *AgentInstance) checkAutoSslRenewal(ctx context.Context) {
+	cert, err := autoSslRenewalDue(a.configuration, time.Now())
+	if err != nil {
+		log.Errorln("AutoSSL: ", err)
+		return
+	}
+	if cert == nil {
+		return
+	}
+	if !a.autoSslRenewing.CompareAndSwap(false, true) {
+		log.Debugln("AutoSSL: certificate renewal is already running")
+		return
+	}
+
+	log.Infoln("AutoSSL: certificate expires at ", cert.NotAfter, ", start renewal")
+	cfg := a.configuration
+	var submitter certificateSubmitter
+	if a.pushClient != nil && cfg.AutoSslPushRenewal {
+		submitter = a.pushClient
+	}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		defer a.autoSslRenewing.Store(false)
+
+		if err := renewAutoSslCertificate(ctx, cfg, cert, submitter); err != nil && !errors.Is(err, context.Canceled) {
+			log.Errorln("AutoSSL: certificate renewal failed: ", err)
+		}
+	}()
+}
@@ -0,0 +1,205 @@
+package agentrt
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/pushclient"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
+)
+
+// testSigner signs the submitted csr like openITCOCKPIT
+type testSigner struct {
+	key *rsa.PrivateKey
+	csr []byte
+}
+
+func (s *testSigner) SubmitCsr(_ context.Context, csr []byte) (*pushclient.CertificateResponse, error) {
+	s.csr = csr
+	block, _ := pem.Decode(csr)
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signed := testCertificate(s.key, req.PublicKey, req.DNSNames, 365)
+	ca := testCertificate(s.key, &s.key.PublicKey, nil, 365)
+	return &pushclient.CertificateResponse{
+		Signed: string(signed),
+		CA:     string(ca),
+	}, nil
+}
+
+func testCertificate(signer *rsa.PrivateKey, pub interface{}, dnsNames []string, days int) []byte {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "CA"},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Duration(days) * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, signer)
+	if err != nil {
+		panic(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestAutoSslRenewal(t *testing.T) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Configuration{
+		AutoSslEnabled:   true,
+		AutoSslCsrFile:   filepath.Join(tmpDir, "agent.csr"),
+		AutoSslCrtFile:   filepath.Join(tmpDir, "agent.crt"),
+		AutoSslKeyFile:   filepath.Join(tmpDir, "agent.key"),
+		AutoSslCaFile:    filepath.Join(tmpDir, "server_ca.crt"),
+		AutoSslRenewDays: 30,
+	}
+	if err := os.WriteFile(cfg.AutoSslKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// there is nothing to renew before openITCOCKPIT signed the first certificate
+	if cert, err := autoSslRenewalDue(cfg, time.Now()); err != nil || cert != nil {
+		t.Fatal("unexpected renewal without certificate: ", err)
+	}
+
+	if err := os.WriteFile(cfg.AutoSslCrtFile, testCertificate(key, &key.PublicKey, []string{"agent.example.org"}, 60), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err := autoSslRenewalDue(cfg, time.Now()); err != nil || cert != nil {
+		t.Fatal("unexpected renewal of a valid certificate: ", err)
+	}
+
+	cert, err := autoSslRenewalDue(cfg, time.Now().Add(40*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert == nil {
+		t.Fatal("expected renewal 20 days before the expiry")
+	}
+
+	signer := &testSigner{key: key}
+	if err := renewAutoSslCertificate(context.Background(), cfg, cert, signer); err != nil {
+		t.Fatal(err)
+	}
+
+	csr, err := os.ReadFile(cfg.AutoSslCsrFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(csr) != string(signer.csr) {
+		t.Error("the stored csr was not submitted")
+	}
+	renewed, err := utils.ParseCertificateFile(cfg.AutoSslCrtFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if days := utils.CertificateDaysRemaining(renewed, time.Now()); days < 360 {
+		t.Error("certificate was not renewed, days remaining: ", days)
+	}
+	if len(renewed.DNSNames) != 1 || renewed.DNSNames[0] != "agent.example.org" {
+		t.Error("renewed certificate has unexpected dns names: ", renewed.DNSNames)
+	}
+	if !utils.FileExists(cfg.AutoSslCaFile) {
+		t.Error("ca certificate was not stored")
+	}
+
+	// an invalid certificate does not replace the current one
+	if err := writeAutoSslCertificate(cfg, &pushclient.CertificateResponse{Signed: "invalid"}); err == nil {
+		t.Error("expected error for invalid certificate")
+	}
+	if _, err := utils.ParseCertificateFile(cfg.AutoSslCrtFile); err != nil {
+		t.Error("certificate was replaced by invalid certificate: ", err)
+	}
+}
+
+func TestAutoSslRenewalPendingCsr(t *testing.T) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	cfg := &config.Configuration{
+		AutoSslEnabled:   true,
+		AutoSslCsrFile:   filepath.Join(tmpDir, "agent.csr"),
+		AutoSslCrtFile:   filepath.Join(tmpDir, "agent.crt"),
+		AutoSslKeyFile:   filepath.Join(tmpDir, "agent.key"),
+		AutoSslCaFile:    filepath.Join(tmpDir, "server_ca.crt"),
+		AutoSslRenewDays: 30,
+	}
+	if err := utils.GeneratePrivateKeyIfNotExists(cfg.AutoSslKeyFile); err != nil {
+		t.Fatal(err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.AutoSslCrtFile, testCertificate(key, &key.PublicKey, []string{"agent.example.org"}, 10), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := autoSslRenewalDue(cfg, time.Now())
+	if err != nil || cert == nil {
+		t.Fatal("expected renewal: ", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(cfg.AutoSslCrtFile, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// without push renewal the csr gets written once and kept until openITCOCKPIT signed it
+	if err := renewAutoSslCertificate(context.Background(), cfg, cert, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !autoSslCsrPending(cfg) {
+		t.Fatal("csr is not pending")
+	}
+	if err := os.WriteFile(cfg.AutoSslCsrFile, []byte("pending"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := renewAutoSslCertificate(context.Background(), cfg, cert, nil); err != nil {
+		t.Fatal(err)
+	}
+	if csr, err := os.ReadFile(cfg.AutoSslCsrFile); err != nil || string(csr) != "pending" {
+		t.Error("pending csr was replaced: ", err)
+	}
+
+	// the certificate was signed after the csr, so a new csr is required for the next renewal
+	if err := os.Chtimes(cfg.AutoSslCsrFile, old.Add(-time.Hour), old.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := renewAutoSslCertificate(context.Background(), cfg, cert, nil); err != nil {
+		t.Fatal(err)
+	}
+	if csr, err := os.ReadFile(cfg.AutoSslCsrFile); err != nil || string(csr) == "pending" {
+		t.Error("csr was not renewed: ", err)
+	}
+}
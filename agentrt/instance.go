@@ -3,8 +3,11 @@ package agentrt
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/checkrunner"
@@ -13,10 +16,15 @@ import (
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/loghandler"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/packagemanager"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/pushclient"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/telemetry"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/webserver"
 	log "github.com/sirupsen/logrus"
 )
 
+// reloadTimeout is the maximum time the agent may take to get healthy after a configuration push
+var reloadTimeout = 60 * time.Second
+
 type AgentInstance struct {
 	ConfigurationPath  string
 	LogPath            string
@@ -27,7 +35,8 @@ type AgentInstance struct {
 
 	wg       sync.WaitGroup
 	shutdown chan struct{}
-	reload   chan chan struct{}
+	reload   chan chan error
+	runCheck chan *checkRunRequest
 
 	stateWebserver                chan []byte
 	statePushClient               chan []byte
@@ -39,11 +48,24 @@ type AgentInstance struct {
 	prometheusExporterResultChan  chan *checkrunner.PrometheusExporterResult
 	packageManagerResultChan      chan *packagemanager.PackageInfo
 
-	customCheckResults map[string]interface{}
+	// configuration is the currently running configuration, used to only restart the changed components on reload
+	configuration *config.Configuration
+	// activeConfiguration is the last configuration the agent was started with, safe to read by other go routines
+	activeConfiguration atomic.Pointer[config.Configuration]
+
+	customCheckResults map[string]*storedCustomCheckResult
+	// lastCheckResult is processed again when an on-demand custom check result arrives
+	lastCheckResult map[string]interface{}
 
-	prometheusExporterResults map[string]string
+	prometheusExporterResults map[string]*storedPrometheusExporterResult
 	packageManagerResult      packagemanager.PackageInfo
 
+	// autoSslRenewing is set while the AutoSSL certificate renewal is running
+	autoSslRenewing atomic.Bool
+
+	// telemetry collects the execution statistics of all checks (agent_runtime)
+	telemetry *telemetry.Registry
+
 	logHandler             *loghandler.LogHandler
 	webserver              *webserver.Server
 	checkRunner            *checkrunner.CheckRunner
@@ -53,6 +75,21 @@ type AgentInstance struct {
 	pushClient             *pushclient.PushClient
 }
 
+// checkRunRequest is sent to the agent routine to execute a check on demand
+type checkRunRequest struct {
+	ctx    context.Context
+	name   string
+	custom bool
+	// lookup only checks if the check exists, the check does not get executed
+	lookup bool
+	done   chan *checkRunResult
+}
+
+type checkRunResult struct {
+	result interface{}
+	err    error
+}
+
 type PackageInfoJson struct {
 	Enabled    bool
 	Pending    bool
@@ -60,25 +97,42 @@ type PackageInfoJson struct {
 	Stats      packagemanager.PackageStats
 }
 
+// processCheckResult passes the check result to the webserver and push client
 func (a *AgentInstance) processCheckResult(result map[string]interface{}) {
-	if a.customCheckResults == nil {
-		result["customchecks"] = map[string]interface{}{}
-	} else {
-		// Merge custom check results into "normal" check results
-		result["customchecks"] = a.customCheckResults
+	data, prometheusResults := a.serializeCheckResult(result)
+	a.updateWebserver(data, prometheusResults)
+
+	if a.pushClient != nil {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+
+			t := time.NewTimer(time.Second * 10)
+			defer t.Stop()
+
+			// we may have to give the push client some time to think about it
+			select {
+			case a.statePushClient <- data: // Pass checkresult json to push client
+			case <-t.C:
+				log.Errorln("Internal error: could not store check result for push client: timeout")
+			}
+		}()
 	}
+}
+
+// serializeCheckResult merges the results of the other components into the check result and returns the json
+func (a *AgentInstance) serializeCheckResult(result map[string]interface{}) ([]byte, map[string]string) {
+	// Merge custom check results into "normal" check results
+	result["customchecks"] = a.customCheckResultsWithStale()
 
-	prometheus_results_data := make(map[string]string, len(a.prometheusExporterResults))
+	prometheus_results_data := a.prometheusExporterResultsWithStale()
 	if a.prometheusExporterResults == nil {
 		result["prometheus_exporters"] = "[]"
 	} else {
 		// Merge the name of all available prometheus exporters into the check result
-		keys := make([]string, len(a.prometheusExporterResults))
-		i := 0
-		for k, result := range a.prometheusExporterResults {
-			keys[i] = k
-			prometheus_results_data[k] = result
-			i++
+		keys := make([]string, 0, len(prometheus_results_data))
+		for k := range prometheus_results_data {
+			keys = append(keys, k)
 		}
 
 		result["prometheus_exporters"] = keys
@@ -99,6 +153,8 @@ func (a *AgentInstance) processCheckResult(result map[string]interface{}) {
 		}
 	}
 
+	result["agent_runtime"] = a.telemetry.Result(context.Background())
+
 	//data, err := json.Marshal(sanitizeFloats(result))
 	data, err := json.Marshal(result)
 	if err != nil {
@@ -112,6 +168,11 @@ func (a *AgentInstance) processCheckResult(result map[string]interface{}) {
 		}
 	}
 
+	return data, prometheus_results_data
+}
+
+// updateWebserver passes the check result to the webserver
+func (a *AgentInstance) updateWebserver(data []byte, prometheusResults map[string]string) {
 	if a.webserver != nil {
 		a.wg.Add(1)
 		go func() {
@@ -129,7 +190,7 @@ func (a *AgentInstance) processCheckResult(result map[string]interface{}) {
 			}
 
 			select {
-			case a.prometheusStateWebserver <- prometheus_results_data: // Pass Prometheus Exporter data to webserver
+			case a.prometheusStateWebserver <- prometheusResults: // Pass Prometheus Exporter data to webserver
 				//log.Debugln("[processCheckResult] Successfully sent prometheus results to prometheusStateWebserver channel")
 			case <-t.C:
 				log.Errorln("Internal error: could not store check result for webserver: timeout")
@@ -143,26 +204,11 @@ func (a *AgentInstance) processCheckResult(result map[string]interface{}) {
 			}
 		}()
 	}
-
-	if a.pushClient != nil {
-		a.wg.Add(1)
-		go func() {
-			defer a.wg.Done()
-
-			t := time.NewTimer(time.Second * 10)
-			defer t.Stop()
-
-			// we may have to give the push client some time to think about it
-			select {
-			case a.statePushClient <- data: // Pass checkresult json to push client
-			case <-t.C:
-				log.Errorln("Internal error: could not store check result for push client: timeout")
-			}
-		}()
-	}
 }
 
-func (a *AgentInstance) doReload(ctx context.Context, cfg *config.Configuration) {
+// doReload (re)starts all components affected by the new configuration
+// Returns an error if a component could not be started
+func (a *AgentInstance) doReload(ctx context.Context, cfg *config.Configuration) error {
 	if a.stateWebserver == nil {
 		a.stateWebserver = make(chan []byte)
 	}
@@ -176,6 +222,14 @@ func (a *AgentInstance) doReload(ctx context.Context, cfg *config.Configuration)
 		a.packageManagerStateWebserver = make(chan packagemanager.PackageInfo)
 	}
 
+	// diff is nil on the initial start, so all components get started
+	var diff *config.Diff
+	if a.configuration != nil {
+		diff = config.Compare(a.configuration, cfg)
+	}
+	a.configuration = cfg
+	a.activeConfiguration.Store(cfg)
+
 	// we do not stop the webserver on every reload for better availability during the wizard setup
 
 	if cfg.OITC.Push && !cfg.OITC.EnableWebserver && a.webserver != nil {
@@ -183,81 +237,162 @@ func (a *AgentInstance) doReload(ctx context.Context, cfg *config.Configuration)
 		a.webserver = nil
 	}
 
+	webserverStarted := false
 	if a.webserver == nil && (!cfg.OITC.Push || (cfg.OITC.Push && cfg.OITC.EnableWebserver)) {
 		a.webserver = &webserver.Server{
 			StateInput:          a.stateWebserver,
 			PrometheusInput:     a.prometheusStateWebserver,
 			PackageManagerInput: a.packageManagerStateWebserver,
 			Reloader:            a, // Set agent instance to Reloader interface for the webserver handler
+			CheckExecutor:       a,
 		}
 		a.webserver.Start(ctx)
+		webserverStarted = true
 	}
 
-	if a.webserver != nil {
+	if a.webserver != nil && (webserverStarted || diff == nil || diff.Webserver) {
 		a.webserver.Reload(cfg)
+		if err := a.webserver.Err(); err != nil {
+			return fmt.Errorf("could not start webserver: %w", err)
+		}
+	}
+
+	if a.checkRunner == nil || diff == nil || diff.Checks || diff.Splay {
+		if err := a.doCheckRunnerReload(ctx, cfg); err != nil {
+			return err
+		}
+	}
+
+	if diff == nil || diff.Push {
+		if err := a.doPushClientReload(ctx, cfg); err != nil {
+			return err
+		}
+	}
+
+	if diff != nil && diff.Splay {
+		// the splay is passed to every executor, so all custom checks and exporters have to be restarted
+		a.doCustomCheckReload(ctx, nil, 0)
+		a.doPrometheusExporterCheckReload(ctx, nil, 0)
+	}
+
+	if diff == nil || diff.Splay || diff.CustomChecksChanged() {
+		if diff != nil {
+			for _, name := range diff.CustomChecksRemoved {
+				delete(a.customCheckResults, name)
+				a.telemetry.Remove(telemetry.CustomChecks, name)
+			}
+		}
+		a.doCustomCheckReload(ctx, cfg.CustomCheckConfiguration, cfg.Splay())
 	}
 
+	if diff == nil || diff.Splay || diff.PrometheusExportersChanged() {
+		if diff != nil {
+			for _, name := range diff.PrometheusExportersRemoved {
+				delete(a.prometheusExporterResults, name)
+				a.telemetry.Remove(telemetry.PrometheusExporters, name)
+			}
+		}
+		a.doPrometheusExporterCheckReload(ctx, cfg.PrometheusExporterConfiguration, cfg.Splay())
+	}
+
+	if diff == nil || diff.Packagemanager || diff.Splay {
+		a.doSoftwareCollectorReload(ctx, cfg)
+	}
+	return nil
+}
+
+func (a *AgentInstance) doCheckRunnerReload(ctx context.Context, cfg *config.Configuration) error {
 	if a.checkRunner != nil {
 		a.checkRunner.Shutdown()
+		a.checkRunner = nil
 	}
 
 	cList, err := checks.ChecksForConfiguration(cfg)
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
+	a.telemetry.Reset(telemetry.Checks)
 	a.checkRunner = &checkrunner.CheckRunner{
 		Configuration: cfg,
 		Result:        a.checkResult,
 		Checks:        cList,
+		Telemetry:     a.telemetry,
 	}
 	if err := a.checkRunner.Start(ctx); err != nil {
-		log.Fatalln(err)
+		a.checkRunner = nil
+		return err
 	}
+	return nil
+}
 
+func (a *AgentInstance) doPushClientReload(ctx context.Context, cfg *config.Configuration) error {
 	if a.pushClient != nil {
 		a.pushClient.Shutdown()
 		a.pushClient = nil
 	}
+	a.telemetry.Reset(telemetry.Push)
 	if cfg.OITC.Push {
 		a.pushClient = &pushclient.PushClient{
 			StateInput:               a.statePushClient,
 			StateInputPackageManager: a.statePushClientPackageManager,
+			Telemetry:                a.telemetry,
 		}
 		if err := a.pushClient.Start(ctx, cfg); err != nil {
-			log.Fatalln("Could not load push client: ", err)
+			a.pushClient = nil
+			return fmt.Errorf("could not load push client: %w", err)
 		}
 	}
-	a.doCustomCheckReload(ctx, cfg.CustomCheckConfiguration)
-	a.doPrometheusExporterCheckReload(ctx, cfg.PrometheusExporterConfiguration)
-	a.doSoftwareCollectorReload(ctx, cfg)
+	return nil
 }
 
-func (a *AgentInstance) doCustomCheckReload(ctx context.Context, ccc []*config.CustomCheck) {
+// doCustomCheckReload keeps the custom check handler running, so only changed custom checks get restarted
+func (a *AgentInstance) doCustomCheckReload(ctx context.Context, ccc []*config.CustomCheck, splay time.Duration) {
+	if len(ccc) == 0 {
+		if a.customCheckHandler != nil {
+			a.customCheckHandler.Shutdown()
+			a.customCheckHandler = nil
+		}
+		a.telemetry.Reset(telemetry.CustomChecks)
+		return
+	}
+
 	if a.customCheckHandler != nil {
-		a.customCheckHandler.Shutdown()
-		a.customCheckHandler = nil
+		a.customCheckHandler.Reload(ccc)
+		return
 	}
-	if len(ccc) > 0 {
-		a.customCheckHandler = &checkrunner.CustomCheckHandler{
-			Configuration: ccc,
-			ResultOutput:  a.customCheckResultChan,
-		}
-		a.customCheckHandler.Start(ctx)
+
+	a.customCheckHandler = &checkrunner.CustomCheckHandler{
+		Configuration: ccc,
+		ResultOutput:  a.customCheckResultChan,
+		Telemetry:     a.telemetry,
+		Splay:         splay,
 	}
+	a.customCheckHandler.Start(ctx)
 }
 
-func (a *AgentInstance) doPrometheusExporterCheckReload(ctx context.Context, exporters []*config.PrometheusExporter) {
+// doPrometheusExporterCheckReload keeps the exporter handler running, so only changed exporters get restarted
+func (a *AgentInstance) doPrometheusExporterCheckReload(ctx context.Context, exporters []*config.PrometheusExporter, splay time.Duration) {
+	if len(exporters) == 0 {
+		if a.prometheusCheckHandler != nil {
+			a.prometheusCheckHandler.Shutdown()
+			a.prometheusCheckHandler = nil
+		}
+		a.telemetry.Reset(telemetry.PrometheusExporters)
+		return
+	}
+
 	if a.prometheusCheckHandler != nil {
-		a.prometheusCheckHandler.Shutdown()
-		a.prometheusCheckHandler = nil
+		a.prometheusCheckHandler.Reload(exporters)
+		return
 	}
-	if len(exporters) > 0 {
-		a.prometheusCheckHandler = &checkrunner.PrometheusCheckHandler{
-			Configuration: exporters,
-			ResultOutput:  a.prometheusExporterResultChan,
-		}
-		a.prometheusCheckHandler.Start(ctx)
+
+	a.prometheusCheckHandler = &checkrunner.PrometheusCheckHandler{
+		Configuration: exporters,
+		ResultOutput:  a.prometheusExporterResultChan,
+		Telemetry:     a.telemetry,
+		Splay:         splay,
 	}
+	a.prometheusCheckHandler.Start(ctx)
 }
 
 func (a *AgentInstance) doSoftwareCollectorReload(ctx context.Context, cfg *config.Configuration) {
@@ -333,15 +468,17 @@ func (a *AgentInstance) Start(parent context.Context) {
 	a.statePushClientPackageManager = make(chan packagemanager.PackageInfo)
 	a.checkResult = make(chan map[string]interface{})
 	a.customCheckResultChan = make(chan *checkrunner.CustomCheckResult)
-	a.customCheckResults = map[string]interface{}{}
+	a.customCheckResults = map[string]*storedCustomCheckResult{}
 	a.prometheusExporterResultChan = make(chan *checkrunner.PrometheusExporterResult)
-	a.prometheusExporterResults = make(map[string]string)
+	a.prometheusExporterResults = map[string]*storedPrometheusExporterResult{}
 	a.packageManagerResultChan = make(chan *packagemanager.PackageInfo)
 	a.packageManagerResult = packagemanager.PackageInfo{
 		Enabled: false,
 	}
+	a.telemetry = &telemetry.Registry{}
 	a.shutdown = make(chan struct{})
-	a.reload = make(chan chan struct{})
+	a.reload = make(chan chan error)
+	a.runCheck = make(chan *checkRunRequest)
 	a.logHandler = &loghandler.LogHandler{
 		Verbose:              a.Verbose,
 		Debug:                a.Debug,
@@ -362,6 +499,9 @@ func (a *AgentInstance) Start(parent context.Context) {
 
 		defer a.stop()
 
+		autoSslRenewTicker := time.NewTicker(autoSslRenewInterval)
+		defer autoSslRenewTicker.Stop()
+
 		for {
 			select {
 			case <-ctx.Done():
@@ -372,24 +512,42 @@ func (a *AgentInstance) Start(parent context.Context) {
 					return
 				}
 			case done := <-a.reload:
-				// Got reload signal
-				cfg, err := config.Load(ctx, a.ConfigurationPath)
-				if err != nil {
-					log.Fatalln("could not load configuration: ", err)
-				}
-				a.doReload(ctx, cfg)
-
-				// Notify caller that reload is done
-				done <- struct{}{}
+				// Got reload signal, notify caller that reload is done
+				done <- a.reloadConfiguration(ctx)
+				a.checkAutoSslRenewal(ctx)
+			case <-autoSslRenewTicker.C:
+				a.checkAutoSslRenewal(ctx)
+			case req := <-a.runCheck:
+				// the check runs in background, the result gets back to this routine through the result channels
+				a.startCheckRun(req)
 			case res := <-a.checkResult:
 				// received check result from checkrunner
+				a.lastCheckResult = res
 				a.processCheckResult(res)
 			case res := <-a.customCheckResultChan:
 				// received check result from customcheckhandler
-				a.customCheckResults[res.Name] = res.Result
+				previous := a.customCheckResults[res.Name]
+				a.customCheckResults[res.Name] = &storedCustomCheckResult{
+					result:   res.Result,
+					received: time.Now(),
+				}
+				switch {
+				case a.lastCheckResult == nil:
+					// the result gets published with the first check result
+				case res.OnDemand:
+					// do not wait for the next check result to publish the result of the on-demand execution
+					a.processCheckResult(a.lastCheckResult)
+				case previous == nil || customCheckResultChanged(previous.result, res.Result):
+					// the webserver gets changed results immediately for the event stream, the push client
+					// gets them with the next check result
+					a.updateWebserver(a.serializeCheckResult(a.lastCheckResult))
+				}
 			case res := <-a.prometheusExporterResultChan:
 				// received check result from prometheus exporter
-				a.prometheusExporterResults[res.Name] = res.Result
+				a.prometheusExporterResults[res.Name] = &storedPrometheusExporterResult{
+					result:   res.Result,
+					received: time.Now(),
+				}
 			case res := <-a.packageManagerResultChan:
 				// received package manager result
 				// Update the stats for push data and also the data for the webserver (pull mode)
@@ -419,16 +577,203 @@ func (a *AgentInstance) Start(parent context.Context) {
 	}()
 
 	// Do initial reload to start the webserver, checkrunner etc...
-	a.Reload()
+	// There is no previous configuration to keep running
+	if err := <-a.startReload(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// customCheckResultChanged reports if the state or output of a custom check changed, the execution time is ignored
+func customCheckResultChanged(old, new *utils.CommandResult) bool {
+	if old == nil || new == nil {
+		return old != new
+	}
+	return old.RC != new.RC || old.Stdout != new.Stdout
+}
+
+// startCheckRun executes the requested check in background, must be called by the agent routine
+func (a *AgentInstance) startCheckRun(req *checkRunRequest) {
+	checkRunner := a.checkRunner
+	customCheckHandler := a.customCheckHandler
+
+	if req.lookup {
+		res := &checkRunResult{}
+		if !(req.custom && customCheckHandler != nil && customCheckHandler.HasCheck(req.name)) &&
+			!(!req.custom && checkRunner != nil && checkRunner.HasCheck(req.name)) {
+			res.err = checkrunner.ErrCheckNotFound
+		}
+		req.done <- res
+		return
+	}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		res := &checkRunResult{}
+		switch {
+		case req.custom && customCheckHandler != nil:
+			res.result, res.err = customCheckHandler.RunCheck(req.name)
+		case !req.custom && checkRunner != nil:
+			res.result, res.err = checkRunner.RunCheck(req.ctx, req.name)
+		default:
+			res.err = checkrunner.ErrCheckNotFound
+		}
+		req.done <- res
+	}()
+}
+
+// doCheckRun sends the check run request to the agent routine and waits for the result
+// With lookup the check does not get executed, only ErrCheckNotFound is returned if the check does not exist
+func (a *AgentInstance) doCheckRun(ctx context.Context, name string, custom, lookup bool) (interface{}, error) {
+	req := &checkRunRequest{
+		ctx:    ctx,
+		name:   name,
+		custom: custom,
+		lookup: lookup,
+		done:   make(chan *checkRunResult, 1),
+	}
+	select {
+	case a.runCheck <- req:
+	case <-a.shutdown:
+		return nil, errors.New("agent is shutting down")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case res := <-req.done:
+		return res.result, res.err
+	case <-a.shutdown:
+		return nil, errors.New("agent is shutting down")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// RunCheck executes the built-in check out of band and returns the result, the result also updates the check result
+func (a *AgentInstance) RunCheck(ctx context.Context, name string) (interface{}, error) {
+	return a.doCheckRun(ctx, name, false, false)
+}
+
+// RunCustomCheck executes the custom check out of band and returns the result, the result also updates the check result
+func (a *AgentInstance) RunCustomCheck(ctx context.Context, name string) (*utils.CommandResult, error) {
+	res, err := a.doCheckRun(ctx, name, true, false)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*utils.CommandResult), nil
+}
+
+// HasCheck returns true if the built-in check (or the custom check if custom is set) exists and is enabled
+func (a *AgentInstance) HasCheck(ctx context.Context, name string, custom bool) bool {
+	_, err := a.doCheckRun(ctx, name, custom, true)
+	return err == nil
 }
 
+// reloadConfiguration loads the configuration file and restarts all changed components
+func (a *AgentInstance) reloadConfiguration(ctx context.Context) error {
+	cfg, err := config.Load(ctx, a.ConfigurationPath)
+	if err != nil {
+		return fmt.Errorf("could not load configuration: %w", err)
+	}
+	previous := a.configuration
+	if err := a.doReload(ctx, cfg); err != nil {
+		// Some components may not be running, so all components get restarted with the previous configuration
+		a.configuration = nil
+		if previous != nil {
+			if restoreErr := a.doReload(ctx, previous); restoreErr != nil {
+				// all components get restarted on the next reload
+				a.configuration = nil
+				return fmt.Errorf("%w (could not restore previous configuration: %s)", err, restoreErr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// startReload sends the reload request to the agent routine, the result will be sent to the returned channel
+func (a *AgentInstance) startReload() <-chan error {
+	done := make(chan error, 1)
+	select {
+	case a.reload <- done:
+	case <-a.shutdown:
+		done <- errors.New("agent is shutting down")
+	}
+	return done
+}
+
+// Reload reloads the configuration file (e.g. on SIGHUP), if the reload fails the previous configuration keeps running
 func (a *AgentInstance) Reload() {
-	// Create new "done" channel and send this to the "a.reload" channel
-	done := make(chan struct{})
+	// Wait until the reload is complete
+	if err := <-a.startReload(); err != nil {
+		log.Errorln("Reload of configuration failed, keep previous configuration: ", err)
+	}
+}
+
+// rollback restores the previous configuration files and reloads the agent with them
+func (a *AgentInstance) rollback(restore func() error) error {
+	if err := restore(); err != nil {
+		return fmt.Errorf("could not restore previous configuration: %w", err)
+	}
+	if err := <-a.startReload(); err != nil {
+		return fmt.Errorf("could not reload previous configuration: %w", err)
+	}
+	return nil
+}
+
+// ReloadWithRollback reloads the configuration after a configuration push. If the new configuration could not be
+// loaded, restore gets called to restore the previous configuration files and the agent gets reloaded with them.
+// If the reload takes longer than reloadTimeout, the error is returned right away and the rollback runs in
+// background as soon as the running reload is complete.
+func (a *AgentInstance) ReloadWithRollback(restore func() error) error {
+	done := a.startReload()
+
+	t := time.NewTimer(reloadTimeout)
+	defer t.Stop()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			return nil
+		}
+		log.Errorln("Reload of new configuration failed, restore previous configuration: ", err)
+		if rollbackErr := a.rollback(restore); rollbackErr != nil {
+			log.Errorln(rollbackErr)
+			return fmt.Errorf("%w (%s)", err, rollbackErr)
+		}
+		return err
+	case <-t.C:
+		err := fmt.Errorf("agent did not get healthy within %s", reloadTimeout)
+		log.Errorln("Reload of new configuration failed, restore previous configuration after the running reload: ", err)
 
-	a.reload <- (done)
-	// Wait until we receive a signal on the done channel, so the reload is complete
-	<-done
+		// We can not rollback while the reload is still running
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			if reloadErr := <-done; reloadErr != nil {
+				log.Errorln("Reload of new configuration failed: ", reloadErr)
+			}
+			if rollbackErr := a.rollback(restore); rollbackErr != nil {
+				log.Errorln(rollbackErr)
+			}
+		}()
+		return err
+	}
+}
+
+// Configuration returns the configuration the agent is running with, the webserver keeps its configuration
+// if no webserver setting changed
+func (a *AgentInstance) Configuration() *config.Configuration {
+	return a.activeConfiguration.Load()
+}
+
+// ReopenLog rotates and reopens the log file (e.g. after the log file was moved by an external logrotate)
+func (a *AgentInstance) ReopenLog() {
+	if a.logHandler != nil {
+		a.logHandler.Reopen()
+	}
 }
 
 func (a *AgentInstance) Shutdown() {
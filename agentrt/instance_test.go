@@ -1,13 +1,20 @@
 package agentrt
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
@@ -182,3 +189,250 @@ func TestAgentShortInterval(t *testing.T) {
 
 	rt.Shutdown()
 }
+
+func TestAgentReloadWithRollback(t *testing.T) {
+	tempDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	writeTestConfig(t, tempDir, exampleConfig, exampleCCConfigNix, exampleCCConfigWin)
+
+	cfgPath := filepath.Join(tempDir, "config.ini")
+	rt := &AgentInstance{
+		ConfigurationPath: cfgPath,
+		LogPath:           filepath.Join(tempDir, "agent.log"),
+		LogRotate:         3,
+		Debug:             true,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rt.Start(ctx)
+	defer rt.Shutdown()
+
+	good, err := os.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfgPath, []byte("[default]\nport = abc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := false
+	err = rt.ReloadWithRollback(func() error {
+		restored = true
+		return os.WriteFile(cfgPath, good, 0600)
+	})
+	if err == nil {
+		t.Fatal("expected reload error")
+	}
+	if !restored {
+		t.Error("previous configuration was not restored")
+	}
+
+	if err := rt.ReloadWithRollback(func() error {
+		t.Error("unexpected restore")
+		return nil
+	}); err != nil {
+		t.Error("unexpected error: ", err)
+	}
+}
+
+func TestAgentReloadKeepsPreviousConfiguration(t *testing.T) {
+	tempDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	writeTestConfig(t, tempDir, exampleConfig, exampleCCConfigNix, exampleCCConfigWin)
+
+	cfgPath := filepath.Join(tempDir, "config.ini")
+	rt := &AgentInstance{
+		ConfigurationPath: cfgPath,
+		LogPath:           filepath.Join(tempDir, "agent.log"),
+		LogRotate:         3,
+		Debug:             true,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rt.Start(ctx)
+	defer rt.Shutdown()
+
+	previous := rt.configuration
+	if previous == nil {
+		t.Fatal("agent did not start")
+	}
+	statusURL := fmt.Sprintf("http://127.0.0.1:%d/", previous.Port)
+
+	// the listener requires a certificate, so the webserver of the new configuration can not start
+	cccPath := filepath.Join(tempDir, "customchecks.ini")
+	if err := os.WriteFile(cfgPath, []byte(fmt.Sprintf("[default]\nlisten = 127.0.0.1:%d tls=required\ncustomchecks = %s\n", dynamicPort(), cccPath)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, config := range []string{"", "[default]\nport = abc\n"} {
+		if config != "" {
+			if err := os.WriteFile(cfgPath, []byte(config), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rt.Reload()
+
+		if rt.configuration != previous {
+			t.Error("previous configuration was not restored")
+		}
+		if rt.checkRunner == nil {
+			t.Error("checks are not running")
+		}
+		resp, err := http.Get(statusURL)
+		if err != nil {
+			t.Fatal("webserver is not running: ", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Error("unexpected status code: ", resp.StatusCode)
+		}
+	}
+}
+
+func TestAgentConfigDiffAfterReload(t *testing.T) {
+	tempDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfgPath := filepath.Join(tempDir, "config.ini")
+	cccPath := filepath.Join(tempDir, "customchecks.ini")
+	port := dynamicPort()
+	cfgData := fmt.Sprintf("[default]\naddress = 127.0.0.1\nport = %d\ncustomchecks = %s\nconfig-update-mode = true\ninterval = 30\n", port, cccPath)
+	if err := os.WriteFile(cfgPath, []byte(cfgData), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cccPath, []byte(exampleCCConfigNix), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := &AgentInstance{
+		ConfigurationPath: cfgPath,
+		LogPath:           filepath.Join(tempDir, "agent.log"),
+		LogRotate:         3,
+		Debug:             true,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rt.Start(ctx)
+	defer rt.Shutdown()
+
+	// the interval does not restart the webserver
+	cfgData = strings.Replace(cfgData, "interval = 30", "interval = 60", 1)
+	if err := os.WriteFile(cfgPath, []byte(cfgData), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rt.Reload()
+
+	push, err := json.Marshal(map[string]string{
+		"configuration":             base64.StdEncoding.EncodeToString([]byte(cfgData)),
+		"customcheck_configuration": base64.StdEncoding.EncodeToString([]byte(exampleCCConfigNix)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/config/diff", port), "application/json", bytes.NewReader(push))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status code: ", resp.StatusCode, string(body))
+	}
+
+	result := struct {
+		Valid         bool              `json:"valid"`
+		ChangedKeys   []json.RawMessage `json:"changed_keys"`
+		ChecksRestart bool              `json:"checks_restart"`
+	}{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || len(result.ChangedKeys) != 0 || result.ChecksRestart {
+		t.Error("the applied configuration was reported as pending: ", string(body))
+	}
+}
+
+func TestAgentReloadWithRollbackTimeout(t *testing.T) {
+	oldTimeout := reloadTimeout
+	reloadTimeout = 100 * time.Millisecond
+	defer func() {
+		reloadTimeout = oldTimeout
+	}()
+
+	// the test is the agent routine, the reload of the new configuration takes longer than the timeout
+	rt := &AgentInstance{
+		reload:   make(chan chan error),
+		shutdown: make(chan struct{}),
+	}
+	go func() {
+		done := <-rt.reload
+		time.Sleep(500 * time.Millisecond)
+		done <- nil
+		// reload of the restored configuration
+		done = <-rt.reload
+		done <- nil
+	}()
+
+	restored := make(chan struct{})
+	start := time.Now()
+	if err := rt.ReloadWithRollback(func() error {
+		close(restored)
+		return nil
+	}); err == nil {
+		t.Error("expected timeout error")
+	}
+	if d := time.Since(start); d >= 500*time.Millisecond {
+		t.Error("reload timeout did not return in time: ", d)
+	}
+
+	select {
+	case <-restored:
+		t.Error("restored while the reload was still running")
+	default:
+	}
+	select {
+	case <-restored:
+	case <-time.After(5 * time.Second):
+		t.Fatal("previous configuration was not restored")
+	}
+	close(rt.shutdown)
+	rt.wg.Wait()
+}
+
+func TestAgentReloadWithRollbackRestoreFailed(t *testing.T) {
+	rt := &AgentInstance{
+		reload:   make(chan chan error),
+		shutdown: make(chan struct{}),
+	}
+	defer close(rt.shutdown)
+	go func() {
+		done := <-rt.reload
+		done <- errors.New("reload error")
+	}()
+
+	// the agent keeps running
+	err := rt.ReloadWithRollback(func() error {
+		return errors.New("restore error")
+	})
+	if err == nil || !strings.Contains(err.Error(), "reload error") || !strings.Contains(err.Error(), "restore error") {
+		t.Error("unexpected error: ", err)
+	}
+}
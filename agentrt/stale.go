@@ -0,0 +1,82 @@
+package agentrt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
+)
+
+// storedCustomCheckResult is the last result of a custom check together with the time it was received
+type storedCustomCheckResult struct {
+	result   *utils.CommandResult
+	received time.Time
+}
+
+// storedPrometheusExporterResult is the last result of a Prometheus exporter together with the time it was received
+type storedPrometheusExporterResult struct {
+	result   string
+	received time.Time
+}
+
+// staleAge returns the age of a result if it is older than stale-result-factor times the interval
+// Returns 0 if the result is not stale
+func staleAge(cfg *config.Configuration, received time.Time, interval int64) time.Duration {
+	if cfg == nil || cfg.StaleResultFactor <= 0 || interval <= 0 {
+		return 0
+	}
+	age := time.Since(received)
+	if age > time.Duration(cfg.StaleResultFactor*interval)*time.Second {
+		return age
+	}
+	return 0
+}
+
+// customCheckResultsWithStale returns the results of all custom checks, stale results get replaced by an UNKNOWN result
+func (a *AgentInstance) customCheckResultsWithStale() map[string]interface{} {
+	intervals := map[string]int64{}
+	if a.configuration != nil {
+		for _, cc := range a.configuration.CustomCheckConfiguration {
+			// Custom checks with a schedule only run at certain times, so there is no fixed interval
+			if cc.Schedule == "" {
+				intervals[cc.Name] = cc.Interval
+			}
+		}
+	}
+
+	results := make(map[string]interface{}, len(a.customCheckResults))
+	for name, stored := range a.customCheckResults {
+		if age := staleAge(a.configuration, stored.received, intervals[name]); age > 0 {
+			results[name] = &utils.CommandResult{
+				Stdout:                    fmt.Sprintf("stale result: last result received %d seconds ago", int64(age.Seconds())),
+				RC:                        utils.Unknown,
+				ExecutionUnixTimestampSec: stored.result.ExecutionUnixTimestampSec,
+			}
+			continue
+		}
+		results[name] = stored.result
+	}
+	return results
+}
+
+// prometheusExporterResultsWithStale returns the results of all exporters, stale results get replaced by a comment
+// so the metrics disappear instead of reporting old values
+func (a *AgentInstance) prometheusExporterResultsWithStale() map[string]string {
+	intervals := map[string]int64{}
+	if a.configuration != nil {
+		for _, exporter := range a.configuration.PrometheusExporterConfiguration {
+			intervals[exporter.Name] = exporter.Interval
+		}
+	}
+
+	results := make(map[string]string, len(a.prometheusExporterResults))
+	for name, stored := range a.prometheusExporterResults {
+		if age := staleAge(a.configuration, stored.received, intervals[name]); age > 0 {
+			results[name] = fmt.Sprintf("# UNKNOWN: stale result: last result received %d seconds ago\n", int64(age.Seconds()))
+			continue
+		}
+		results[name] = stored.result
+	}
+	return results
+}
@@ -0,0 +1,75 @@
+package agentrt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
+)
+
+func TestStaleResults(t *testing.T) {
+	a := &AgentInstance{
+		configuration: &config.Configuration{
+			StaleResultFactor: 3,
+			CustomCheckConfiguration: []*config.CustomCheck{
+				{Name: "fresh", Interval: 60},
+				{Name: "stale", Interval: 60},
+				{Name: "scheduled", Interval: 60, Schedule: "15 2 * * *"},
+			},
+			PrometheusExporterConfiguration: []*config.PrometheusExporter{
+				{Name: "fresh", Interval: 60},
+				{Name: "stale", Interval: 60},
+			},
+		},
+		customCheckResults: map[string]*storedCustomCheckResult{
+			"fresh": {
+				result:   &utils.CommandResult{Stdout: "OK"},
+				received: time.Now().Add(-time.Minute),
+			},
+			"stale": {
+				result:   &utils.CommandResult{Stdout: "OK"},
+				received: time.Now().Add(-time.Hour),
+			},
+			"scheduled": {
+				result:   &utils.CommandResult{Stdout: "OK"},
+				received: time.Now().Add(-time.Hour),
+			},
+		},
+		prometheusExporterResults: map[string]*storedPrometheusExporterResult{
+			"fresh": {
+				result:   "metric 1\n",
+				received: time.Now().Add(-time.Minute),
+			},
+			"stale": {
+				result:   "metric 1\n",
+				received: time.Now().Add(-time.Hour),
+			},
+		},
+	}
+
+	ccResults := a.customCheckResultsWithStale()
+	if res := ccResults["fresh"].(*utils.CommandResult); res.Stdout != "OK" {
+		t.Error("fresh custom check result expected to be kept: ", res.Stdout)
+	}
+	if res := ccResults["scheduled"].(*utils.CommandResult); res.Stdout != "OK" {
+		t.Error("scheduled custom check result expected to be kept: ", res.Stdout)
+	}
+	if res := ccResults["stale"].(*utils.CommandResult); res.RC != utils.Unknown || !strings.HasPrefix(res.Stdout, "stale result") {
+		t.Error("unexpected stale custom check result: ", res.RC, res.Stdout)
+	}
+
+	exporterResults := a.prometheusExporterResultsWithStale()
+	if exporterResults["fresh"] != "metric 1\n" {
+		t.Error("fresh exporter result expected to be kept: ", exporterResults["fresh"])
+	}
+	if !strings.Contains(exporterResults["stale"], "stale result") {
+		t.Error("unexpected stale exporter result: ", exporterResults["stale"])
+	}
+
+	a.configuration.StaleResultFactor = 0
+	if res := a.customCheckResultsWithStale()["stale"].(*utils.CommandResult); res.Stdout != "OK" {
+		t.Error("stale detection expected to be disabled: ", res.Stdout)
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/checks"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/telemetry"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -17,10 +19,44 @@ type CheckRunner struct {
 	Configuration *config.Configuration
 	Result        chan map[string]interface{}
 	Checks        []checks.Check
+	// Telemetry stores the execution statistics of the checks (optional)
+	Telemetry *telemetry.Registry
 
-	mtx      sync.Mutex
-	wg       sync.WaitGroup
-	shutdown chan struct{}
+	resultsMtx  sync.Mutex
+	lastResults map[string]interface{}
+	state       *stateStore
+	workers     chan struct{}
+	groups      []*checkGroup
+	ctx         context.Context
+	wg          sync.WaitGroup
+	shutdown    chan struct{}
+}
+
+var (
+	// ErrCheckNotFound is returned by RunCheck if the check is unknown or disabled
+	ErrCheckNotFound = errors.New("check not found")
+	// ErrCheckRunning is returned by RunCheck if the check is already running
+	ErrCheckRunning = errors.New("check is already running")
+)
+
+// scheduledCheck wraps a check with its individual timeout
+type scheduledCheck struct {
+	check   checks.Check
+	timeout time.Duration
+
+	// running is used to not execute a check again while the previous execution has not returned yet
+	running chan struct{}
+
+	// state stores the counters of stateful checks
+	state *stateStore
+}
+
+// checkGroup contains all checks which share the same interval
+type checkGroup struct {
+	interval time.Duration
+	checks   []*scheduledCheck
+
+	mtx sync.Mutex
 }
 
 func (c *CheckRunner) Shutdown() {
@@ -28,8 +64,13 @@ func (c *CheckRunner) Shutdown() {
 	c.wg.Wait()
 }
 
+// errorPreviousRunning is the result of a check which was not started because the previous execution is still running
+const errorPreviousRunning = "previous execution still running"
+
 type errorResult struct {
 	Error string `json:"error"`
+
+	panicked bool
 }
 
 func runCheck(ctx context.Context, check checks.Check) interface{} {
@@ -42,7 +83,8 @@ func runCheck(ctx context.Context, check checks.Check) interface{} {
 			if err := recover(); err != nil {
 				log.Errorln("Check ", check.Name(), ": !!PANIC!! ", err)
 				result = &errorResult{
-					Error: fmt.Sprint(err),
+					Error:    fmt.Sprint(err),
+					panicked: true,
 				}
 			}
 		}()
@@ -60,90 +102,332 @@ func runCheck(ctx context.Context, check checks.Check) interface{} {
 	return result
 }
 
-func (c *CheckRunner) runChecks(parent context.Context, checks []checks.Check, timeout time.Duration) {
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
+// mergeResults stores the given results as last results of the checks and returns a copy of the last results of all checks
+func (c *CheckRunner) mergeResults(results map[string]interface{}) map[string]interface{} {
+	c.resultsMtx.Lock()
+	defer c.resultsMtx.Unlock()
 
-	log.Infoln("Running ", len(checks), "checks")
-	ctx, cancel := context.WithTimeout(parent, timeout)
-	defer cancel()
+	for name, result := range results {
+		c.lastResults[name] = result
+	}
 
-	done := make(chan struct{})
+	merged := make(map[string]interface{}, len(c.lastResults))
+	for name, result := range c.lastResults {
+		merged[name] = result
+	}
+	return merged
+}
 
-	results := make(map[string]interface{})
-	go func() {
-		// Run checks in a new thread
-		for _, check := range checks {
-			log.Debugln("Begin Check: ", check.Name())
-			results[check.Name()] = runCheck(ctx, check)
-			log.Debugln("Finish Check: ", check.Name())
-		}
-		runtime.GC()
-		// done maybe already to late
-		select {
-		case <-ctx.Done():
-		case done <- struct{}{}:
+// tryStart marks the check as running, returns false if the previous execution has not returned yet
+func (s *scheduledCheck) tryStart() bool {
+	select {
+	case s.running <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// run executes the check with its individual timeout
+// a check that runs into the timeout returns a timeout error result, but the check itself will finish in background
+func (s *scheduledCheck) run(parent context.Context, stats *telemetry.Registry) interface{} {
+	if !s.tryStart() {
+		stats.Record(telemetry.Checks, s.check.Name(), 0, errors.New(errorPreviousRunning))
+		log.Errorln("Check ", s.check.Name(), ": ", errorPreviousRunning)
+		return &errorResult{
+			Error: errorPreviousRunning,
 		}
+	}
+	return s.execute(parent, stats)
+}
+
+// execute runs the check, tryStart must have been called before
+func (s *scheduledCheck) execute(parent context.Context, stats *telemetry.Registry) interface{} {
+	ctx, cancel := context.WithTimeout(parent, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			<-s.running
+		}()
+		result := runCheck(ctx, s.check)
+		s.saveState()
+		done <- result
 	}()
 
-	// Parent thread is waiting that all checks are finished
 	select {
+	case result := <-done:
+		if errResult, ok := result.(*errorResult); ok {
+			if errResult.panicked {
+				stats.RecordPanic(telemetry.Checks, s.check.Name(), time.Since(start))
+			} else {
+				stats.Record(telemetry.Checks, s.check.Name(), time.Since(start), errors.New(errResult.Error))
+			}
+		} else {
+			stats.Record(telemetry.Checks, s.check.Name(), time.Since(start), nil)
+		}
+		return result
 	case <-ctx.Done():
-		err := ctx.Err()
-		log.Errorln("Could not finish executing integrated checks: ", err)
-		if errors.Is(err, context.DeadlineExceeded) {
-			log.Errorln("Consider increasing check interval or disable unnecessary checks")
+		stats.Record(telemetry.Checks, s.check.Name(), time.Since(start), ctx.Err())
+		log.Errorln("Check ", s.check.Name(), ": timeout after ", s.timeout)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Errorln("Consider increasing the timeout of the check or disable it")
 		}
+		return &errorResult{
+			Error: "timeout",
+		}
+	}
+}
+
+// saveState passes the current state of a stateful check to the state store
+func (s *scheduledCheck) saveState() {
+	stateful, ok := s.check.(checks.StatefulCheck)
+	if !ok || s.state == nil {
 		return
-	case <-done:
 	}
+	data, err := stateful.SaveState()
+	if err != nil {
+		log.Errorln("Check ", s.check.Name(), ": could not save state: ", err)
+		return
+	}
+	s.state.set(s.check.Name(), data)
+}
+
+// loadState restores the last state of a stateful check from the state store
+func (s *scheduledCheck) loadState() {
+	stateful, ok := s.check.(checks.StatefulCheck)
+	if !ok {
+		return
+	}
+	if data, ok := s.state.get(s.check.Name()); ok {
+		log.Debugln("Check ", s.check.Name(), ": restore saved state")
+		if err := stateful.LoadState(data); err != nil {
+			log.Errorln("Check ", s.check.Name(), ": could not restore state: ", err)
+		}
+	}
+}
+
+func (c *CheckRunner) runChecks(ctx context.Context, group *checkGroup) {
+	group.mtx.Lock()
+	defer group.mtx.Unlock()
+
+	log.Infoln("Running ", len(group.checks), "checks")
+
+	resultsMtx := sync.Mutex{}
+	results := make(map[string]interface{}, len(group.checks))
+
+	wg := sync.WaitGroup{}
+	for _, check := range group.checks {
+		wg.Add(1)
+		go func(check *scheduledCheck) {
+			defer wg.Done()
+
+			// Wait for a free worker
+			select {
+			case <-ctx.Done():
+				return
+			case c.workers <- struct{}{}:
+			}
+			defer func() {
+				<-c.workers
+			}()
+
+			log.Debugln("Begin Check: ", check.check.Name())
+			result := check.run(ctx, c.Telemetry)
+			log.Debugln("Finish Check: ", check.check.Name())
+
+			resultsMtx.Lock()
+			results[check.check.Name()] = result
+			resultsMtx.Unlock()
+		}(check)
+	}
+	wg.Wait()
+	runtime.GC()
+
+	if err := c.state.save(); err != nil {
+		log.Errorln("Could not save check state: ", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		log.Errorln("Could not finish executing integrated checks: ", err)
+		return
+	}
+
+	// Merge the results with the last results of the checks with other intervals
+	merged := c.mergeResults(results)
 
 	select {
 	case <-ctx.Done():
-		err := ctx.Err()
-		log.Errorln("Could not process integrated checks: ", err)
-		if errors.Is(err, context.DeadlineExceeded) {
-			log.Errorln("Consider increasing check interval or disable unnecessary checks")
-		}
+		log.Errorln("Could not process integrated checks: ", ctx.Err())
 	case <-c.shutdown:
 		log.Errorln("Check: canceled")
 		return
 
 	//Pass check results to Results Channel (AgentInstance)
-	case c.Result <- results:
+	case c.Result <- merged:
 	}
 }
 
+// scheduledCheck returns the enabled check with the given name, nil if the check is unknown or disabled
+func (c *CheckRunner) scheduledCheck(name string) *scheduledCheck {
+	var check *scheduledCheck
+	for _, group := range c.groups {
+		for _, s := range group.checks {
+			if s.check.Name() == name {
+				check = s
+			}
+		}
+	}
+	return check
+}
+
+// HasCheck returns true if the check is enabled and can be executed with RunCheck
+func (c *CheckRunner) HasCheck(name string) bool {
+	return c.scheduledCheck(name) != nil
+}
+
+// RunCheck executes the check out of band with its normal timeout and returns the result
+// The result replaces the last result of the check and gets passed to the Result channel with all other results
+func (c *CheckRunner) RunCheck(ctx context.Context, name string) (interface{}, error) {
+	check := c.scheduledCheck(name)
+	if check == nil {
+		return nil, ErrCheckNotFound
+	}
+	if !check.tryStart() {
+		return nil, ErrCheckRunning
+	}
+
+	// Wait for a free worker
+	select {
+	case <-ctx.Done():
+		<-check.running
+		return nil, ctx.Err()
+	case c.workers <- struct{}{}:
+	}
+	defer func() {
+		<-c.workers
+	}()
+
+	log.Infoln("Run check ", name, " on demand")
+	// the check gets the context of the check runner, so a closed connection does not abort the check
+	result := check.execute(c.ctx, c.Telemetry)
+	if err := c.state.save(); err != nil {
+		log.Errorln("Could not save check state: ", err)
+	}
+
+	merged := c.mergeResults(map[string]interface{}{
+		name: result,
+	})
+	select {
+	case <-c.ctx.Done():
+	case <-c.shutdown:
+	case c.Result <- merged:
+	}
+	return result, nil
+}
+
+// checkGroups groups all checks by their configured interval
+func (c *CheckRunner) checkGroups() []*checkGroup {
+	groups := map[int64]*checkGroup{}
+	for _, check := range c.Checks {
+		interval := c.Configuration.IntervalForCheck(check.Name())
+		group, ok := groups[interval]
+		if !ok {
+			group = &checkGroup{
+				interval: time.Duration(interval) * time.Second,
+			}
+			groups[interval] = group
+		}
+		group.checks = append(group.checks, &scheduledCheck{
+			check:   check,
+			timeout: time.Duration(c.Configuration.TimeoutForCheck(check.Name())) * time.Second,
+			running: make(chan struct{}, 1),
+			state:   c.state,
+		})
+	}
+
+	res := make([]*checkGroup, 0, len(groups))
+	for _, group := range groups {
+		res = append(res, group)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].interval < res[j].interval
+	})
+	return res
+}
+
 // Start the check runner and returns immediatly (SHOULD NOT RUN IN GOROUTINE)
 func (c *CheckRunner) Start(ctx context.Context) error {
 	c.shutdown = make(chan struct{})
+	c.lastResults = make(map[string]interface{})
 
-	checkTimeout := time.Duration(c.Configuration.CheckInterval-1) * time.Second
+	if c.Configuration.StateFile != "" {
+		c.state = newStateStore(c.Configuration.StateFile, time.Duration(c.Configuration.StateMaxAge)*time.Second)
+		if err := c.state.load(); err != nil {
+			log.Errorln("Could not load check state: ", err)
+		}
+	}
 
-	c.wg.Add(1)
-	go func() {
-		defer c.wg.Done()
+	workers := c.Configuration.CheckWorkers
+	if workers <= 0 {
+		workers = 4
+	}
+	c.workers = make(chan struct{}, workers)
 
-		ctx, cancel := context.WithCancel(ctx)
-		defer cancel()
+	splay := c.Configuration.Splay()
+	c.ctx = ctx
+	c.groups = c.checkGroups()
 
-		ticker := time.NewTicker(time.Duration(c.Configuration.CheckInterval) * time.Second)
-		defer ticker.Stop()
+	// Every group of checks with the same interval gets its own ticker
+	for _, group := range c.groups {
+		for _, check := range group.checks {
+			check.loadState()
+		}
 
-		go c.runChecks(ctx, c.Checks, checkTimeout)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case _, ok := <-c.shutdown:
-				if !ok {
+		log.Debugln("Check interval ", group.interval, " for ", len(group.checks), " checks")
+
+		c.wg.Add(1)
+		go func(group *checkGroup) {
+			defer c.wg.Done()
+
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
+			// Delay the first run, so not all agents of a fleet execute their checks at the same time
+			if delay := config.SplayForInterval(splay, group.interval); delay > 0 {
+				log.Debugln("Delay checks with interval ", group.interval, " by ", delay)
+				t := time.NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					return
+				case <-c.shutdown:
+					t.Stop()
 					return
+				case <-t.C:
 				}
-			case <-ticker.C:
-				go c.runChecks(ctx, c.Checks, checkTimeout)
 			}
-		}
-	}()
+
+			ticker := time.NewTicker(group.interval)
+			defer ticker.Stop()
+
+			go c.runChecks(ctx, group)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case _, ok := <-c.shutdown:
+					if !ok {
+						return
+					}
+				case <-ticker.C:
+					go c.runChecks(ctx, group)
+				}
+			}
+		}(group)
+	}
 
 	return nil
 }
@@ -166,3 +166,197 @@ func TestCheckRunnerPanicError(t *testing.T) {
 		t.Fatal("timeout waiting for results")
 	}
 }
+
+type countCheck struct {
+	name  string
+	count int
+}
+
+func (c *countCheck) Name() string {
+	return c.name
+}
+
+func (c *countCheck) Run(ctx context.Context) (interface{}, error) {
+	c.count++
+	return c.count, nil
+}
+
+func (c *countCheck) Configure(config *config.Configuration) (bool, error) {
+	return true, nil
+}
+
+func TestCheckRunnerCheckIntervals(t *testing.T) {
+	cfg := &config.Configuration{
+		CheckInterval: 30,
+		CheckIntervals: map[string]int64{
+			"fast": 2,
+		},
+	}
+
+	c := &CheckRunner{
+		Configuration: cfg,
+		Result:        make(chan map[string]interface{}),
+		Checks: []checks.Check{
+			&countCheck{name: "fast"},
+			&countCheck{name: "slow"},
+		},
+	}
+	err := c.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	timeout := time.After(time.Second * 10)
+	for {
+		select {
+		case res := <-c.Result:
+			fast, _ := res["fast"].(int)
+			if fast < 2 {
+				continue
+			}
+			if slow, ok := res["slow"].(int); !ok || slow != 1 {
+				t.Fatal("expected the last result of the slow check to be kept: ", res["slow"])
+			}
+			return
+		case <-timeout:
+			t.Fatal("timeout waiting for results")
+		}
+	}
+}
+
+type sleepCheck struct {
+	name  string
+	sleep time.Duration
+}
+
+func (c *sleepCheck) Name() string {
+	return c.name
+}
+
+func (c *sleepCheck) Run(ctx context.Context) (interface{}, error) {
+	// ignore the context on purpose to simulate a hanging check
+	time.Sleep(c.sleep)
+	return c.name, nil
+}
+
+func (c *sleepCheck) Configure(config *config.Configuration) (bool, error) {
+	return true, nil
+}
+
+func TestCheckRunnerCheckTimeout(t *testing.T) {
+	cfg := &config.Configuration{
+		CheckInterval: 30,
+		CheckWorkers:  2,
+		CheckTimeouts: map[string]int64{
+			"slow": 1,
+		},
+	}
+
+	c := &CheckRunner{
+		Configuration: cfg,
+		Result:        make(chan map[string]interface{}),
+		Checks: []checks.Check{
+			&sleepCheck{name: "slow", sleep: time.Second * 5},
+			&sleepCheck{name: "fast1"},
+			&sleepCheck{name: "fast2"},
+		},
+	}
+	err := c.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	select {
+	case res := <-c.Result:
+		if len(res) != 3 {
+			t.Fatal("unexpected result: ", res)
+		}
+		errRes, ok := res["slow"].(*errorResult)
+		if !ok || errRes.Error != "timeout" {
+			t.Fatal("expected timeout error result for slow check: ", res["slow"])
+		}
+		if res["fast1"] != "fast1" || res["fast2"] != "fast2" {
+			t.Fatal("expected results of the other checks to be kept: ", res)
+		}
+	case <-time.After(time.Second * 4):
+		t.Fatal("timeout waiting for results")
+	}
+}
+
+func TestScheduledCheckPreviousRunning(t *testing.T) {
+	s := &scheduledCheck{
+		check:   &sleepCheck{name: "slow", sleep: time.Second * 2},
+		timeout: time.Millisecond * 500,
+		running: make(chan struct{}, 1),
+	}
+
+	// the first execution runs into the timeout, but keeps running in background
+	errRes, ok := s.run(context.Background(), nil).(*errorResult)
+	if !ok || errRes.Error != "timeout" {
+		t.Fatal("expected timeout error result: ", errRes)
+	}
+
+	errRes, ok = s.run(context.Background(), nil).(*errorResult)
+	if !ok || errRes.Error != errorPreviousRunning {
+		t.Fatal("expected previous execution still running error result: ", errRes)
+	}
+}
+
+func TestCheckRunnerRunCheck(t *testing.T) {
+	cfg := &config.Configuration{
+		CheckInterval: 3600,
+	}
+
+	c := &CheckRunner{
+		Configuration: cfg,
+		Result:        make(chan map[string]interface{}),
+		Checks: []checks.Check{
+			&countCheck{name: "count"},
+			&countCheck{name: "other"},
+		},
+	}
+	err := c.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	select {
+	case <-c.Result:
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout waiting for results")
+	}
+
+	if _, err := c.RunCheck(context.Background(), "unknown"); err != ErrCheckNotFound {
+		t.Fatal("expected ErrCheckNotFound: ", err)
+	}
+
+	type runResult struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan *runResult, 1)
+	go func() {
+		result, err := c.RunCheck(context.Background(), "count")
+		done <- &runResult{result, err}
+	}()
+
+	select {
+	case res := <-c.Result:
+		if res["count"] != 2 || res["other"] != 1 {
+			t.Fatal("unexpected result: ", res)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout waiting for results")
+	}
+
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if res.result != 2 {
+		t.Fatal("unexpected result: ", res.result)
+	}
+}
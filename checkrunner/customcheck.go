@@ -3,10 +3,13 @@ package checkrunner
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/schedule"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/telemetry"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
 	log "github.com/sirupsen/logrus"
 )
@@ -14,7 +17,12 @@ import (
 type CustomCheckExecutor struct {
 	Configuration *config.CustomCheck
 	ResultOutput  chan *CustomCheckResult
+	Telemetry     *telemetry.Registry
+	// Splay delays the first execution (limited to the interval)
+	Splay time.Duration
 
+	// runMtx prevents the on-demand execution (RunNow) while the check is running
+	runMtx   sync.Mutex
 	wg       sync.WaitGroup
 	shutdown chan struct{}
 }
@@ -24,33 +32,83 @@ func (c *CustomCheckExecutor) Shutdown() {
 	c.wg.Wait()
 }
 
+// sendResult returns the custom check result to the Agent Instance
+func (c *CustomCheckExecutor) sendResult(ctx context.Context, result *utils.CommandResult, onDemand bool) {
+	select {
+	case c.ResultOutput <- &CustomCheckResult{
+		Name:     c.Configuration.Name,
+		Result:   result,
+		OnDemand: onDemand,
+	}:
+	case <-time.After(time.Second * 5):
+		log.Errorln("Internal error: timeout could not save custom check result")
+	case <-c.shutdown:
+		log.Errorln("CustomCheck: canceled")
+	case <-ctx.Done():
+		log.Errorln("CustomCheck: canceled")
+	}
+}
+
 func (c *CustomCheckExecutor) runCheck(ctx context.Context, timeout time.Duration) {
+	c.runMtx.Lock()
+	defer c.runMtx.Unlock()
+
+	c.sendResult(ctx, c.execute(ctx, timeout), false)
+}
+
+// RunNow executes the custom check out of band with its normal timeout, even outside of its schedule
+// The result gets passed to ResultOutput like the result of a scheduled execution
+func (c *CustomCheckExecutor) RunNow(ctx context.Context) (*utils.CommandResult, error) {
+	if !c.runMtx.TryLock() {
+		return nil, ErrCheckRunning
+	}
+	defer c.runMtx.Unlock()
+
+	log.Infoln("Run custom check ", c.Configuration.Name, " on demand")
+	result := c.execute(ctx, time.Duration(c.Configuration.Timeout)*time.Second)
+	c.sendResult(ctx, result, true)
+	return result, nil
+}
+
+func (c *CustomCheckExecutor) execute(ctx context.Context, timeout time.Duration) *utils.CommandResult {
 	log.Debugln("Begin CustomCheck: ", c.Configuration.Name)
+	start := time.Now()
 	result, err := utils.RunCommand(ctx, utils.CommandArgs{
 		Command:       c.Configuration.Command,
 		Timeout:       timeout,
 		Shell:         c.Configuration.Shell,
 		PowershellExe: c.Configuration.PowershellExe,
 	})
+	c.Telemetry.Record(telemetry.CustomChecks, c.Configuration.Name, time.Since(start), err)
 	if err != nil && result.RC == utils.Unknown {
 		log.Infoln("Custom check '", c.Configuration.Name, "' error: ", err)
 	}
-	select {
-	// Return custom check result to Agent Instance
-	case c.ResultOutput <- &CustomCheckResult{
-		Name:   c.Configuration.Name,
-		Result: result,
-	}:
-	case <-time.After(time.Second * 5):
-		log.Errorln("Internal error: timeout could not save custom check result")
-	case <-c.shutdown:
-		log.Errorln("CustomCheck: canceled")
-		return
-	case <-ctx.Done():
-		log.Errorln("CustomCheck: canceled")
+	log.Debugln("Finish CustomCheck: ", c.Configuration.Name)
+	return result
+}
+
+// notScheduled reports that the custom check is outside of its schedule or active window
+// so the last result does not get stale
+func (c *CustomCheckExecutor) notScheduled(ctx context.Context, next time.Time) {
+	stdout := "not scheduled"
+	if !next.IsZero() {
+		stdout = fmt.Sprintf("not scheduled, next execution at %s", next.Format(time.RFC3339))
+	}
+	log.Debugln("CustomCheck: ", c.Configuration.Name, " ", stdout)
+	c.sendResult(ctx, &utils.CommandResult{
+		Stdout:                    stdout,
+		RC:                        utils.Ok,
+		ExecutionUnixTimestampSec: time.Now().Unix(),
+	}, false)
+}
+
+// trigger executes the custom check if it is inside of its active window
+func (c *CustomCheckExecutor) trigger(ctx context.Context, timeout time.Duration, window *schedule.Window, next time.Time) {
+	if window != nil && !window.Contains(time.Now()) {
+		c.notScheduled(ctx, next)
 		return
 	}
-	log.Debugln("Finish CustomCheck: ", c.Configuration.Name)
+	c.runCheck(ctx, timeout)
 }
 
 func (c *CustomCheckExecutor) Start(parent context.Context) error {
@@ -58,9 +116,23 @@ func (c *CustomCheckExecutor) Start(parent context.Context) error {
 	timeout := time.Duration(c.Configuration.Timeout) * time.Second
 	interval := time.Duration(c.Configuration.Interval) * time.Second
 
-	if timeout > interval {
+	var (
+		cron   *schedule.Cron
+		window *schedule.Window
+		err    error
+	)
+	if c.Configuration.Schedule != "" {
+		if cron, err = schedule.ParseCron(c.Configuration.Schedule); err != nil {
+			return fmt.Errorf("custom check %s: %s", c.Configuration.Name, err)
+		}
+	} else if timeout > interval {
 		return errors.New("custom check timeout must be lower or equal to interval")
 	}
+	if c.Configuration.ActiveWindow != "" {
+		if window, err = schedule.ParseWindow(c.Configuration.ActiveWindow); err != nil {
+			return fmt.Errorf("custom check %s: %s", c.Configuration.Name, err)
+		}
+	}
 
 	c.wg.Add(1)
 	go func() {
@@ -69,10 +141,28 @@ func (c *CustomCheckExecutor) Start(parent context.Context) error {
 		ctx, cancel := context.WithCancel(parent)
 		defer cancel()
 
+		if cron != nil {
+			c.runSchedule(ctx, timeout, cron, window)
+			return
+		}
+
+		if delay := config.SplayForInterval(c.Splay, interval); delay > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-c.shutdown:
+				t.Stop()
+				return
+			case <-t.C:
+			}
+		}
+
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
-		c.runCheck(ctx, timeout)
+		c.trigger(ctx, timeout, window, time.Time{})
 		for {
 			select {
 			case <-ctx.Done():
@@ -82,10 +172,42 @@ func (c *CustomCheckExecutor) Start(parent context.Context) error {
 					return
 				}
 			case <-ticker.C:
-				c.runCheck(ctx, timeout)
+				c.trigger(ctx, timeout, window, time.Time{})
 			}
 		}
 	}()
 
 	return nil
 }
+
+// runSchedule executes the custom check at the times of the cron expression instead of the interval
+func (c *CustomCheckExecutor) runSchedule(ctx context.Context, timeout time.Duration, cron *schedule.Cron, window *schedule.Window) {
+	next := cron.Next(time.Now())
+	if next.IsZero() {
+		log.Errorln("Custom check '", c.Configuration.Name, "': schedule ", c.Configuration.Schedule, " never matches")
+		return
+	}
+	// There is no result until the first execution
+	c.notScheduled(ctx, next)
+
+	for {
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case _, ok := <-c.shutdown:
+			if !ok {
+				t.Stop()
+				return
+			}
+		case <-t.C:
+		}
+
+		next = cron.Next(time.Now())
+		c.trigger(ctx, timeout, window, next)
+		if next.IsZero() {
+			return
+		}
+	}
+}
@@ -2,9 +2,12 @@ package checkrunner
 
 import (
 	"context"
+	"reflect"
 	"sync"
+	"time"
 
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/telemetry"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
 	log "github.com/sirupsen/logrus"
 )
@@ -12,6 +15,14 @@ import (
 type CustomCheckResult struct {
 	Name   string
 	Result *utils.CommandResult
+	// OnDemand is set for results of executions requested by RunCheck
+	OnDemand bool
+}
+
+type customCheckReload struct {
+	Configuration []*config.CustomCheck
+	// reloadDone will be set by the reload func
+	reloadDone chan struct{}
 }
 
 // CustomCheckHandler runs custom checks
@@ -20,23 +31,33 @@ type CustomCheckHandler struct {
 	// Do not close before Shutdown completes
 	ResultOutput  chan *CustomCheckResult
 	Configuration []*config.CustomCheck
-
-	executors []*CustomCheckExecutor
-	shutdown  chan struct{}
-	wg        sync.WaitGroup
+	// Telemetry stores the execution statistics (optional)
+	Telemetry *telemetry.Registry
+	// Splay delays the first execution of each executor (limited to the interval)
+	Splay time.Duration
+
+	executors    []*CustomCheckExecutor
+	executorsMtx sync.Mutex
+	ctx          context.Context
+	reload       chan *customCheckReload
+	shutdown     chan struct{}
+	wg           sync.WaitGroup
 }
 
-// stop all custom check executors in parallel
+// stop the given custom check executors in parallel
 // the cancel of the context should cause all executors to stop almost immediatly
-func (c *CustomCheckHandler) stopExecutors() {
-	if len(c.executors) < 1 {
+func (c *CustomCheckHandler) stopExecutors(executors []*CustomCheckExecutor) {
+	if len(executors) < 1 {
 		return
 	}
 
 	stopC := make(chan *CustomCheckExecutor)
+	var wg sync.WaitGroup
 
-	for i := 0; i < len(c.executors); i++ {
+	for i := 0; i < len(executors); i++ {
+		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			for e := range stopC {
 				e.Shutdown()
 				log.Infoln("Custom Check ", e.Configuration.Name, " stopped")
@@ -45,41 +66,108 @@ func (c *CustomCheckHandler) stopExecutors() {
 		}()
 	}
 
-	for _, executor := range c.executors {
+	for _, executor := range executors {
 		stopC <- executor
 	}
 
 	close(stopC)
+	wg.Wait()
 }
 
-// Run the custom checks in background (DO NOT RUN IN GO ROUTINE)
-func (c *CustomCheckHandler) Start(parentCtx context.Context) {
-	c.shutdown = make(chan struct{})
-	c.executors = make([]*CustomCheckExecutor, len(c.Configuration))
+// doReload only restarts the custom checks which have been added, removed or modified
+func (c *CustomCheckHandler) doReload(ctx context.Context, configuration []*config.CustomCheck) {
+	running := make(map[string]*CustomCheckExecutor, len(c.executors))
+	for _, executor := range c.executors {
+		running[executor.Configuration.Name] = executor
+	}
+
+	executors := make([]*CustomCheckExecutor, 0, len(configuration))
+	started := []*CustomCheckExecutor{}
+	for _, checkConfig := range configuration {
+		if executor, ok := running[checkConfig.Name]; ok && reflect.DeepEqual(executor.Configuration, checkConfig) {
+			// Keep the executor running, the configuration did not change
+			executors = append(executors, executor)
+			delete(running, checkConfig.Name)
+			continue
+		}
 
-	for i, checkConfig := range c.Configuration {
-		c.executors[i] = &CustomCheckExecutor{
+		executor := &CustomCheckExecutor{
 			Configuration: checkConfig,
 			ResultOutput:  c.ResultOutput,
+			Telemetry:     c.Telemetry,
+			Splay:         c.Splay,
+		}
+		executors = append(executors, executor)
+		started = append(started, executor)
+	}
+
+	// All executors left in running got removed or modified
+	stopped := make([]*CustomCheckExecutor, 0, len(running))
+	for _, executor := range running {
+		stopped = append(stopped, executor)
+	}
+	c.stopExecutors(stopped)
+
+	for _, executor := range started {
+		log.Infoln("Custom Check ", executor.Configuration.Name, " starting")
+		c.wg.Add(1)
+		if err := executor.Start(ctx); err != nil {
+			log.Errorln(err)
 		}
 	}
 
+	c.executorsMtx.Lock()
+	c.executors = executors
+	c.executorsMtx.Unlock()
+	c.Configuration = configuration
+}
+
+// executor returns the executor of the custom check, nil if the custom check does not exist
+func (c *CustomCheckHandler) executor(name string) *CustomCheckExecutor {
+	c.executorsMtx.Lock()
+	defer c.executorsMtx.Unlock()
+	var executor *CustomCheckExecutor
+	for _, e := range c.executors {
+		if e.Configuration.Name == name {
+			executor = e
+		}
+	}
+	return executor
+}
+
+// HasCheck returns true if the custom check exists and can be executed with RunCheck
+func (c *CustomCheckHandler) HasCheck(name string) bool {
+	return c.executor(name) != nil
+}
+
+// RunCheck executes the custom check out of band and returns the result
+func (c *CustomCheckHandler) RunCheck(name string) (*utils.CommandResult, error) {
+	executor := c.executor(name)
+	if executor == nil {
+		return nil, ErrCheckNotFound
+	}
+	// the check gets the context of the handler, so a closed connection does not abort the check
+	return executor.RunNow(c.ctx)
+}
+
+// Run the custom checks in background (DO NOT RUN IN GO ROUTINE)
+func (c *CustomCheckHandler) Start(parentCtx context.Context) {
+	c.shutdown = make(chan struct{})
+	c.reload = make(chan *customCheckReload)
+	c.executors = nil
+
+	ctx, cancel := context.WithCancel(parentCtx)
+	c.ctx = ctx
+	c.doReload(ctx, c.Configuration)
+
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
-
-		ctx, cancel := context.WithCancel(parentCtx)
 		defer cancel()
 
-		for _, executor := range c.executors {
-			log.Infoln("Custom Check ", executor.Configuration.Name, " starting")
-			c.wg.Add(1)
-			if err := executor.Start(ctx); err != nil {
-				log.Errorln(err)
-			}
-		}
-
-		defer c.stopExecutors()
+		defer func() {
+			c.stopExecutors(c.executors)
+		}()
 
 		for {
 			select {
@@ -89,12 +177,27 @@ func (c *CustomCheckHandler) Start(parentCtx context.Context) {
 				if !ok {
 					return
 				}
+			case r := <-c.reload:
+				c.doReload(ctx, r.Configuration)
+				r.reloadDone <- struct{}{}
 			}
 		}
 
 	}()
 }
 
+// Reload applies a new custom check configuration, only added, removed or modified custom checks get restarted
+func (c *CustomCheckHandler) Reload(configuration []*config.CustomCheck) {
+	done := make(chan struct{})
+
+	c.reload <- &customCheckReload{
+		Configuration: configuration,
+		reloadDone:    done,
+	}
+
+	<-done
+}
+
 // Shutdown custom check runner, waits for completion
 func (c *CustomCheckHandler) Shutdown() {
 	close(c.shutdown)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -61,3 +62,174 @@ outerfor:
 	}
 
 }
+
+func TestReload(t *testing.T) {
+	cc := &CustomCheckHandler{
+		ResultOutput: make(chan *CustomCheckResult),
+		Configuration: []*config.CustomCheck{
+			{
+				Name:     "check_1",
+				Interval: 60,
+				Enabled:  true,
+				Timeout:  1,
+				Command:  getCommandLine(),
+			},
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-cc.ResultOutput:
+			case <-done:
+				return
+			}
+		}
+	}()
+	defer close(done)
+
+	cc.Start(context.Background())
+	defer cc.Shutdown()
+
+	first := cc.executors[0]
+
+	cc.Reload([]*config.CustomCheck{
+		{
+			Name:     "check_1",
+			Interval: 60,
+			Enabled:  true,
+			Timeout:  1,
+			Command:  getCommandLine(),
+		},
+		{
+			Name:     "check_2",
+			Interval: 60,
+			Enabled:  true,
+			Timeout:  1,
+			Command:  getCommandLine(),
+		},
+	})
+	if len(cc.executors) != 2 {
+		t.Fatal("unexpected number of executors (2): ", len(cc.executors))
+	}
+	if cc.executors[0] != first {
+		t.Error("unchanged custom check was restarted")
+	}
+
+	cc.Reload([]*config.CustomCheck{
+		{
+			Name:     "check_1",
+			Interval: 30,
+			Enabled:  true,
+			Timeout:  1,
+			Command:  getCommandLine(),
+		},
+	})
+	if len(cc.executors) != 1 {
+		t.Fatal("unexpected number of executors (1): ", len(cc.executors))
+	}
+	if cc.executors[0] == first {
+		t.Error("modified custom check was not restarted")
+	}
+}
+
+func TestRunNotScheduled(t *testing.T) {
+	tomorrow := time.Now().AddDate(0, 0, 1).Weekday().String()[:3]
+
+	tests := []*config.CustomCheck{
+		{
+			Name:         "check_window",
+			Interval:     60,
+			Enabled:      true,
+			Timeout:      1,
+			Command:      getCommandLine(),
+			ActiveWindow: tomorrow,
+		},
+		{
+			Name:     "check_schedule",
+			Interval: 60,
+			Enabled:  true,
+			Timeout:  1,
+			Command:  getCommandLine(),
+			Schedule: "15 2 1 1 *",
+		},
+	}
+
+	for _, checkConfig := range tests {
+		cc := &CustomCheckHandler{
+			ResultOutput:  make(chan *CustomCheckResult),
+			Configuration: []*config.CustomCheck{checkConfig},
+		}
+		cc.Start(context.Background())
+
+		select {
+		case res := <-cc.ResultOutput:
+			if !strings.HasPrefix(res.Result.Stdout, "not scheduled") {
+				t.Error(checkConfig.Name, ": unexpected result: ", res.Result.Stdout)
+			}
+		case <-time.After(time.Second * 5):
+			t.Error(checkConfig.Name, ": timeout")
+		}
+
+		cc.Shutdown()
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	tomorrow := time.Now().AddDate(0, 0, 1).Weekday().String()[:3]
+
+	cc := &CustomCheckHandler{
+		ResultOutput: make(chan *CustomCheckResult),
+		Configuration: []*config.CustomCheck{
+			{
+				Name:         "check_1",
+				Interval:     60,
+				Enabled:      true,
+				Timeout:      1,
+				Command:      getCommandLine(),
+				ActiveWindow: tomorrow,
+			},
+		},
+	}
+	cc.Start(context.Background())
+	defer cc.Shutdown()
+
+	select {
+	case <-cc.ResultOutput:
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout")
+	}
+
+	if _, err := cc.RunCheck("unknown"); err != ErrCheckNotFound {
+		t.Fatal("expected ErrCheckNotFound: ", err)
+	}
+
+	type runResult struct {
+		result *utils.CommandResult
+		err    error
+	}
+	done := make(chan *runResult, 1)
+	go func() {
+		result, err := cc.RunCheck("check_1")
+		done <- &runResult{result, err}
+	}()
+
+	// the check gets executed outside of its active window
+	select {
+	case res := <-cc.ResultOutput:
+		if !res.OnDemand || !strings.Contains(res.Result.Stdout, "hello world") {
+			t.Fatal("unexpected result: ", res.OnDemand, res.Result.Stdout)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout")
+	}
+
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if !strings.Contains(res.result.Stdout, "hello world") {
+		t.Fatal("unexpected result: ", res.result.Stdout)
+	}
+}
@@ -10,12 +10,16 @@ import (
 	"time"
 
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/telemetry"
 	log "github.com/sirupsen/logrus"
 )
 
 type PrometheusCheckExecutor struct {
 	Configuration *config.PrometheusExporter
 	ResultOutput  chan *PrometheusExporterResult
+	Telemetry     *telemetry.Registry
+	// Splay delays the first execution (limited to the interval)
+	Splay time.Duration
 
 	wg       sync.WaitGroup
 	shutdown chan struct{}
@@ -33,15 +37,19 @@ func (c *PrometheusCheckExecutor) runCheck(ctx context.Context, timeout time.Dur
 		Timeout: timeout,
 	}
 
+	start := time.Now()
 	url := fmt.Sprintf("http://%s:%d%s", "localhost", c.Configuration.Port, c.Configuration.Path)
 	resp, err := client.Get(url)
 	if err != nil {
+		c.Telemetry.Record(telemetry.PrometheusExporters, c.Configuration.Name, time.Since(start), err)
 		log.Infoln("Prometheus Exporter '", c.Configuration.Name, "' error: ", err)
+		return
 	}
 
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
+	c.Telemetry.Record(telemetry.PrometheusExporters, c.Configuration.Name, time.Since(start), err)
 	if err != nil {
 		log.Infoln("Prometheus Exporter Error reading response body '", c.Configuration.Name, "' error: ", err)
 		return
@@ -81,6 +89,19 @@ func (c *PrometheusCheckExecutor) Start(parent context.Context) error {
 		ctx, cancel := context.WithCancel(parent)
 		defer cancel()
 
+		if delay := config.SplayForInterval(c.Splay, interval); delay > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-c.shutdown:
+				t.Stop()
+				return
+			case <-t.C:
+			}
+		}
+
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
@@ -2,9 +2,12 @@ package checkrunner
 
 import (
 	"context"
+	"reflect"
 	"sync"
+	"time"
 
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/telemetry"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -13,29 +16,43 @@ type PrometheusExporterResult struct {
 	Result string
 }
 
+type prometheusExporterReload struct {
+	Configuration []*config.PrometheusExporter
+	// reloadDone will be set by the reload func
+	reloadDone chan struct{}
+}
+
 // PrometheusCheckHandler runs proemtheus exporter
 type PrometheusCheckHandler struct {
 	// ResultOutput channel for check results
 	// Do not close before Shutdown completes
 	ResultOutput  chan *PrometheusExporterResult
 	Configuration []*config.PrometheusExporter
+	// Telemetry stores the execution statistics (optional)
+	Telemetry *telemetry.Registry
+	// Splay delays the first execution of each executor (limited to the interval)
+	Splay time.Duration
 
 	executors []*PrometheusCheckExecutor
+	reload    chan *prometheusExporterReload
 	shutdown  chan struct{}
 	wg        sync.WaitGroup
 }
 
-// stop all custom check executors in parallel
+// stop the given prometheus exporter executors in parallel
 // the cancel of the context should cause all executors to stop almost immediatly
-func (c *PrometheusCheckHandler) stopExecutors() {
-	if len(c.executors) < 1 {
+func (c *PrometheusCheckHandler) stopExecutors(executors []*PrometheusCheckExecutor) {
+	if len(executors) < 1 {
 		return
 	}
 
 	stopC := make(chan *PrometheusCheckExecutor)
+	var wg sync.WaitGroup
 
-	for i := 0; i < len(c.executors); i++ {
+	for i := 0; i < len(executors); i++ {
+		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			for e := range stopC {
 				e.Shutdown()
 				log.Infoln("Prometheus Exporter ", e.Configuration.Name, " stopped")
@@ -44,41 +61,77 @@ func (c *PrometheusCheckHandler) stopExecutors() {
 		}()
 	}
 
-	for _, executor := range c.executors {
+	for _, executor := range executors {
 		stopC <- executor
 	}
 
 	close(stopC)
+	wg.Wait()
 }
 
-// Run the custom checks in background (DO NOT RUN IN GO ROUTINE)
-func (c *PrometheusCheckHandler) Start(parentCtx context.Context) {
-	c.shutdown = make(chan struct{})
-	c.executors = make([]*PrometheusCheckExecutor, len(c.Configuration))
+// doReload only restarts the exporters which have been added, removed or modified
+func (c *PrometheusCheckHandler) doReload(ctx context.Context, configuration []*config.PrometheusExporter) {
+	running := make(map[string]*PrometheusCheckExecutor, len(c.executors))
+	for _, executor := range c.executors {
+		running[executor.Configuration.Name] = executor
+	}
 
-	for i, checkConfig := range c.Configuration {
-		c.executors[i] = &PrometheusCheckExecutor{
+	executors := make([]*PrometheusCheckExecutor, 0, len(configuration))
+	started := []*PrometheusCheckExecutor{}
+	for _, checkConfig := range configuration {
+		if executor, ok := running[checkConfig.Name]; ok && reflect.DeepEqual(executor.Configuration, checkConfig) {
+			// Keep the executor running, the configuration did not change
+			executors = append(executors, executor)
+			delete(running, checkConfig.Name)
+			continue
+		}
+
+		executor := &PrometheusCheckExecutor{
 			Configuration: checkConfig,
 			ResultOutput:  c.ResultOutput,
+			Telemetry:     c.Telemetry,
+			Splay:         c.Splay,
+		}
+		executors = append(executors, executor)
+		started = append(started, executor)
+	}
+
+	// All executors left in running got removed or modified
+	stopped := make([]*PrometheusCheckExecutor, 0, len(running))
+	for _, executor := range running {
+		stopped = append(stopped, executor)
+	}
+	c.stopExecutors(stopped)
+
+	for _, executor := range started {
+		log.Infoln("Prometheus Exporter ", executor.Configuration.Name, " starting")
+		c.wg.Add(1)
+		if err := executor.Start(ctx); err != nil {
+			log.Errorln(err)
 		}
 	}
 
+	c.executors = executors
+	c.Configuration = configuration
+}
+
+// Run the custom checks in background (DO NOT RUN IN GO ROUTINE)
+func (c *PrometheusCheckHandler) Start(parentCtx context.Context) {
+	c.shutdown = make(chan struct{})
+	c.reload = make(chan *prometheusExporterReload)
+	c.executors = nil
+
+	ctx, cancel := context.WithCancel(parentCtx)
+	c.doReload(ctx, c.Configuration)
+
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
-
-		ctx, cancel := context.WithCancel(parentCtx)
 		defer cancel()
 
-		for _, executor := range c.executors {
-			log.Infoln("Custom Check ", executor.Configuration.Name, " starting")
-			c.wg.Add(1)
-			if err := executor.Start(ctx); err != nil {
-				log.Errorln(err)
-			}
-		}
-
-		defer c.stopExecutors()
+		defer func() {
+			c.stopExecutors(c.executors)
+		}()
 
 		for {
 			select {
@@ -88,12 +141,27 @@ func (c *PrometheusCheckHandler) Start(parentCtx context.Context) {
 				if !ok {
 					return
 				}
+			case r := <-c.reload:
+				c.doReload(ctx, r.Configuration)
+				r.reloadDone <- struct{}{}
 			}
 		}
 
 	}()
 }
 
+// Reload applies a new exporter configuration, only added, removed or modified exporters get restarted
+func (c *PrometheusCheckHandler) Reload(configuration []*config.PrometheusExporter) {
+	done := make(chan struct{})
+
+	c.reload <- &prometheusExporterReload{
+		Configuration: configuration,
+		reloadDone:    done,
+	}
+
+	<-done
+}
+
 // Shutdown custom check runner, waits for completion
 func (c *PrometheusCheckHandler) Shutdown() {
 	close(c.shutdown)
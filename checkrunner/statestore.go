@@ -0,0 +1,141 @@
+package checkrunner
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
+	"github.com/shirou/gopsutil/v4/host"
+	log "github.com/sirupsen/logrus"
+)
+
+type checkState struct {
+	Timestamp int64           `json:"timestamp"`
+	State     json.RawMessage `json:"state"`
+}
+
+type stateFile struct {
+	// BootTime is used to discard the state after a reboot, as all counters got reset
+	BootTime uint64                 `json:"boot_time"`
+	Checks   map[string]*checkState `json:"checks"`
+}
+
+// stateStore persists the state of checks which calculate deltas between two check runs
+// All methods are safe to call on a nil stateStore
+type stateStore struct {
+	path   string
+	maxAge time.Duration
+
+	mtx      sync.Mutex
+	bootTime uint64
+	states   map[string]*checkState
+
+	// saveMtx serializes the writes of the state file, all interval groups save their state
+	saveMtx sync.Mutex
+}
+
+func newStateStore(path string, maxAge time.Duration) *stateStore {
+	bootTime, err := host.BootTimeWithContext(context.Background())
+	if err != nil {
+		log.Debugln("State store: could not determine boot time: ", err)
+	}
+	return &stateStore{
+		path:     path,
+		maxAge:   maxAge,
+		bootTime: bootTime,
+		states:   map[string]*checkState{},
+	}
+}
+
+// load reads the state file and discards all states which are older than maxAge
+func (s *stateStore) load() error {
+	if s == nil || utils.FileNotExists(s.path) {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	file := &stateFile{}
+	if err := json.Unmarshal(data, file); err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if file.BootTime != s.bootTime {
+		log.Infoln("State store: system was rebooted, discard saved check state")
+		return nil
+	}
+
+	now := time.Now()
+	for name, state := range file.Checks {
+		if s.maxAge > 0 && now.Sub(time.Unix(state.Timestamp, 0)) > s.maxAge {
+			log.Debugln("State store: discard outdated state of check ", name)
+			continue
+		}
+		s.states[name] = state
+	}
+	return nil
+}
+
+func (s *stateStore) get(name string) ([]byte, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	state, ok := s.states[name]
+	if !ok {
+		return nil, false
+	}
+	return state.State, true
+}
+
+func (s *stateStore) set(name string, data []byte) {
+	if s == nil {
+		return
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.states[name] = &checkState{
+		Timestamp: time.Now().Unix(),
+		State:     data,
+	}
+}
+
+// save writes all states to the state file
+func (s *stateStore) save() error {
+	if s == nil {
+		return nil
+	}
+	// the states are marshaled while holding saveMtx, so an older state never replaces a newer one
+	s.saveMtx.Lock()
+	defer s.saveMtx.Unlock()
+
+	s.mtx.Lock()
+	data, err := json.Marshal(&stateFile{
+		BootTime: s.bootTime,
+		Checks:   s.states,
+	})
+	s.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so we never end up with a half written state file
+	tmpPath := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
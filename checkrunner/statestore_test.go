@@ -0,0 +1,151 @@
+package checkrunner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/checks"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+)
+
+func TestStateStore(t *testing.T) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	statePath := filepath.Join(tmpDir, "check_state.json")
+
+	s := newStateStore(statePath, time.Minute)
+	s.set("disk_io", []byte(`{"sda":{}}`))
+	s.set("net_io", []byte(`{"eth0":{}}`))
+	s.states["net_io"].Timestamp = time.Now().Add(-time.Hour).Unix()
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newStateStore(statePath, time.Minute)
+	if err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := s.get("disk_io"); !ok || string(data) != `{"sda":{}}` {
+		t.Error("unexpected state for disk_io: ", string(data))
+	}
+	if _, ok := s.get("net_io"); ok {
+		t.Error("expected outdated state of net_io to be discarded")
+	}
+
+	s = newStateStore(statePath, time.Minute)
+	s.bootTime = s.bootTime + 1
+	if err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.get("disk_io"); ok {
+		t.Error("expected state to be discarded after a reboot")
+	}
+}
+
+type statefulCheck struct {
+	counter int
+}
+
+func (c *statefulCheck) Name() string {
+	return "stateful"
+}
+
+func (c *statefulCheck) Run(ctx context.Context) (interface{}, error) {
+	c.counter++
+	return c.counter, nil
+}
+
+func (c *statefulCheck) Configure(config *config.Configuration) (bool, error) {
+	return true, nil
+}
+
+func (c *statefulCheck) SaveState() ([]byte, error) {
+	return []byte{byte('0' + c.counter)}, nil
+}
+
+func (c *statefulCheck) LoadState(data []byte) error {
+	c.counter = int(data[0] - '0')
+	return nil
+}
+
+func TestStateStoreConcurrentSave(t *testing.T) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	statePath := filepath.Join(tmpDir, "check_state.json")
+
+	// all interval groups save the state at the end of their run
+	s := newStateStore(statePath, time.Minute)
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 200)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.set(fmt.Sprintf("check%d", i), []byte(`{"value":1}`))
+			errs <- s.save()
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	s = newStateStore(statePath, time.Minute)
+	if err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.states) != 200 {
+		t.Error("unexpected number of saved states: ", len(s.states))
+	}
+}
+
+func TestCheckRunnerState(t *testing.T) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Configuration{
+		CheckInterval: 30,
+		StateFile:     filepath.Join(tmpDir, "check_state.json"),
+		StateMaxAge:   600,
+	}
+
+	for expected := 1; expected <= 2; expected++ {
+		c := &CheckRunner{
+			Configuration: cfg,
+			Result:        make(chan map[string]interface{}),
+			Checks: []checks.Check{
+				&statefulCheck{},
+			},
+		}
+		if err := c.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case res := <-c.Result:
+			if res["stateful"] != expected {
+				t.Error("unexpected result after restart: ", res["stateful"], " expected: ", expected)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("timeout waiting for results")
+		}
+		c.Shutdown()
+	}
+}
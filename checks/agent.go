@@ -1,6 +1,12 @@
 package checks
 
-import "time"
+import (
+	"time"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
+	log "github.com/sirupsen/logrus"
+)
 
 // CheckAgent gathers information about the agent itself
 type CheckAgent struct {
@@ -12,6 +18,9 @@ type CheckAgent struct {
 	MacVersion    string // macOS
 	KernelVersion string // Linux
 	CheckInterval int64  // Checkinterval of the Agent in Seconds
+
+	AutoSslCrtFile   string // AutoSSL certificate, empty if AutoSSL is disabled
+	AutoSslRenewDays int64  // Days before the expiry the AutoSSL certificate gets renewed
 }
 
 // Name will be used in the response as check name
@@ -35,4 +44,43 @@ type resultAgent struct {
 	GOARCH               string `json:"goarch"`                 // Value of runtime.ARCH
 	GOVERSION            string `json:"goversion"`              // Value of runtime.Version()
 	CheckInterval        int64  `json:"check_interval"`         // Check intervall in seconds of the agent
+
+	AutoSsl *resultAgentAutoSsl `json:"autossl,omitempty"` // Only set if AutoSSL is enabled and the certificate exists
+}
+
+type resultAgentAutoSsl struct {
+	NotAfter          string `json:"not_after"`           // e.g.: 2022-01-11T15:58:35Z
+	NotAfterTimestamp int64  `json:"not_after_timestamp"` // e.g.: 1641916715
+	DaysRemaining     int64  `json:"days_remaining"`      // negative if the certificate is expired
+	Issuer            string `json:"issuer"`              // e.g.: CN=openITCOCKPIT Agent CA
+	RenewalDue        bool   `json:"renewal_due"`         // true if the certificate expires within autossl-renew-days
+}
+
+// autoSslResult returns the expiry of the AutoSSL certificate or nil if there is no certificate
+func (c *CheckAgent) autoSslResult(now time.Time) *resultAgentAutoSsl {
+	if c.AutoSslCrtFile == "" || !utils.FileExists(c.AutoSslCrtFile) {
+		return nil
+	}
+	cert, err := utils.ParseCertificateFile(c.AutoSslCrtFile)
+	if err != nil {
+		log.Errorln("Agent check: could not read AutoSSL certificate: ", err)
+		return nil
+	}
+	daysRemaining := utils.CertificateDaysRemaining(cert, now)
+	return &resultAgentAutoSsl{
+		NotAfter:          cert.NotAfter.UTC().Format(time.RFC3339),
+		NotAfterTimestamp: cert.NotAfter.Unix(),
+		DaysRemaining:     daysRemaining,
+		Issuer:            cert.Issuer.String(),
+		RenewalDue:        c.AutoSslRenewDays > 0 && daysRemaining <= c.AutoSslRenewDays,
+	}
+}
+
+// configureAutoSsl stores the AutoSSL settings of the configuration
+func (c *CheckAgent) configureAutoSsl(cfg *config.Configuration) {
+	c.AutoSslCrtFile = ""
+	if cfg.AutoSslEnabled {
+		c.AutoSslCrtFile = cfg.AutoSslCrtFile
+	}
+	c.AutoSslRenewDays = cfg.AutoSslRenewDays
 }
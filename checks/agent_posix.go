@@ -37,6 +37,7 @@ func (c *CheckAgent) Run(ctx context.Context) (interface{}, error) {
 		GOARCH:               runtime.GOARCH,
 		GOVERSION:            runtime.Version(),
 		CheckInterval:        c.CheckInterval,
+		AutoSsl:              c.autoSslResult(now),
 	}, nil
 }
 
@@ -44,6 +45,7 @@ func (c *CheckAgent) Run(ctx context.Context) (interface{}, error) {
 func (c *CheckAgent) Configure(config *config.Configuration) (bool, error) {
 	c.Init()
 	c.CheckInterval = config.CheckInterval
+	c.configureAutoSsl(config)
 	return true, nil
 }
 
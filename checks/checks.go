@@ -23,6 +23,18 @@ type Check interface {
 	Configure(config *config.Configuration) (bool, error)
 }
 
+// StatefulCheck is implemented by checks which calculate rates from the counters of the previous check run
+// The check runner persists the state on disk to not lose the deltas after a restart or reload of the agent
+type StatefulCheck interface {
+	Check
+
+	// SaveState returns the counters of the last check run as json
+	SaveState() ([]byte, error)
+
+	// LoadState restores the counters of a previous check run
+	LoadState(data []byte) error
+}
+
 func ChecksForConfiguration(config *config.Configuration) ([]Check, error) {
 	var res []Check
 	checks := getPlatformChecks()
@@ -31,6 +31,6 @@ func (c *CheckCpu) Name() string {
 
 // Configure the command or return false if the command was disabled
 func (c *CheckCpu) Configure(config *config.Configuration) (bool, error) {
-	c.checkInterval = config.CheckInterval // check interval in seconds (default: 30)
+	c.checkInterval = config.IntervalForCheck(c.Name()) // check interval in seconds (default: 30)
 	return config.CPU, nil
 }
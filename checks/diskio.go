@@ -1,6 +1,8 @@
 package checks
 
 import (
+	"encoding/json"
+
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
 )
 
@@ -65,3 +67,13 @@ type resultDiskIo struct {
 func (c *CheckDiskIo) Configure(config *config.Configuration) (bool, error) {
 	return config.DiskIo, nil
 }
+
+// SaveState returns the counters of the last check run as json
+func (c *CheckDiskIo) SaveState() ([]byte, error) {
+	return json.Marshal(c.lastResults)
+}
+
+// LoadState restores the counters of a previous check run
+func (c *CheckDiskIo) LoadState(data []byte) error {
+	return json.Unmarshal(data, &c.lastResults)
+}
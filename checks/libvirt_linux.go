@@ -7,6 +7,7 @@ package checks
 
 import (
 	"context"
+	"encoding/json"
 	"math"
 	"time"
 
@@ -50,6 +51,13 @@ type lastCpuResultsForDelta struct {
 	VcpuTime   uint64
 }
 
+// libvirtState contains all counters required to calculate the deltas of the next check run
+type libvirtState struct {
+	Netstat   map[string]map[string]*lastNetstatResultsForDelta   `json:"netstat"`
+	Diskstats map[string]map[string]*lastDiskstatsResultsForDelta `json:"diskstats"`
+	Cpu       map[string]*lastCpuResultsForDelta                  `json:"cpu"`
+}
+
 // Name will be used in the response as check name
 func (c *CheckLibvirt) Name() string {
 	return "libvirt"
@@ -348,3 +356,24 @@ func (c *CheckLibvirt) Run(ctx context.Context) (interface{}, error) {
 func (c *CheckLibvirt) Configure(config *config.Configuration) (bool, error) {
 	return config.Libvirt, nil
 }
+
+// SaveState returns the counters of the last check run as json
+func (c *CheckLibvirt) SaveState() ([]byte, error) {
+	return json.Marshal(&libvirtState{
+		Netstat:   c.lastNetstatResults,
+		Diskstats: c.lastDiskstatsResults,
+		Cpu:       c.lastCpuResults,
+	})
+}
+
+// LoadState restores the counters of a previous check run
+func (c *CheckLibvirt) LoadState(data []byte) error {
+	state := &libvirtState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return err
+	}
+	c.lastNetstatResults = state.Netstat
+	c.lastDiskstatsResults = state.Diskstats
+	c.lastCpuResults = state.Cpu
+	return nil
+}
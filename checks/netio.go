@@ -1,6 +1,8 @@
 package checks
 
 import (
+	"encoding/json"
+
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
 )
 
@@ -39,3 +41,13 @@ type resultNetIo struct {
 func (c *CheckNetIo) Configure(config *config.Configuration) (bool, error) {
 	return config.NetIo, nil
 }
+
+// SaveState returns the counters of the last check run as json
+func (c *CheckNetIo) SaveState() ([]byte, error) {
+	return json.Marshal(c.lastResults)
+}
+
+// LoadState restores the counters of a previous check run
+func (c *CheckNetIo) LoadState(data []byte) error {
+	return json.Unmarshal(data, &c.lastResults)
+}
@@ -9,12 +9,22 @@ import (
 	"path/filepath"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/agentrt"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/platformpaths"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+type signalAction int
+
+const (
+	signalShutdown signalAction = iota
+	signalReload
+	signalReopenLog
+)
+
 type RootCmd struct {
 	cmd     *cobra.Command
 	agentRt *agentrt.AgentInstance
@@ -27,6 +37,7 @@ type RootCmd struct {
 	disableLog       bool
 	disableLogRotate bool
 	logRotate        int
+	shutdownTimeout  int
 	shutdown         chan struct{}
 	wg               sync.WaitGroup
 
@@ -109,18 +120,51 @@ func (r *RootCmd) run(cmd *cobra.Command, args []string) {
 	}
 
 	r.agentRt.Start(ctx)
-	defer r.agentRt.Shutdown()
 
 	// Bind linux signal handler
 	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt)
+	signal.Notify(sig, handledSignals...)
 	defer signal.Stop(sig)
 
+	for {
+		select {
+		case s := <-sig:
+			switch actionForSignal(s) {
+			case signalReload:
+				log.Infoln("Received signal ", s, ", reload configuration")
+				r.agentRt.Reload()
+			case signalReopenLog:
+				log.Infoln("Received signal ", s, ", reopen log file")
+				r.agentRt.ReopenLog()
+			default:
+				log.Infoln("Received signal ", s, ", shutdown")
+				r.gracefulShutdown(cancel)
+				return
+			}
+		case <-r.shutdown:
+			r.gracefulShutdown(cancel)
+			return
+		}
+	}
+}
+
+// gracefulShutdown gives the agent the time of --shutdown-timeout to finish running checks and to send the last results.
+// After that time all remaining operations get canceled.
+func (r *RootCmd) gracefulShutdown(cancel context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		r.agentRt.Shutdown()
+		close(done)
+	}()
+
+	t := time.NewTimer(time.Duration(r.shutdownTimeout) * time.Second)
+	defer t.Stop()
+
 	select {
-	case <-sig:
-		return
-	case <-r.shutdown:
-		return
+	case <-done:
+	case <-t.C:
+		log.Errorln("Shutdown did not complete within ", r.shutdownTimeout, " seconds, cancel remaining operations")
+		cancel()
 	}
 }
 
@@ -143,6 +187,10 @@ func New() *RootCmd {
 	r.cmd.PersistentFlags().BoolVar(&r.disableLog, "disable-logfile", false, "disable log file")
 	r.cmd.PersistentFlags().BoolVar(&r.disableLogRotate, "disable-logrotate", false, "disable log file rotation")
 	r.cmd.PersistentFlags().IntVar(&r.logRotate, "log-rotate", 3, "number of log rotate files")
+	r.cmd.PersistentFlags().IntVar(&r.shutdownTimeout, "shutdown-timeout", 10, "maximum time in seconds to wait for a graceful shutdown")
+
+	r.cmd.AddCommand(r.newConfigCmd())
+	r.cmd.AddCommand(r.newHashPasswordCmd())
 
 	r.platformPath = platformpaths.Get()
 
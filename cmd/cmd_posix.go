@@ -3,7 +3,26 @@
 
 package cmd
 
-import "os"
+import (
+	"os"
+	"syscall"
+)
+
+// handledSignals are the signals the agent reacts on
+// SIGHUP reloads the configuration (systemctl reload)
+// SIGUSR1 rotates and reopens the log file (external logrotate)
+// SIGINT and SIGTERM shutdown the agent gracefully
+var handledSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1}
+
+func actionForSignal(s os.Signal) signalAction {
+	switch s {
+	case syscall.SIGHUP:
+		return signalReload
+	case syscall.SIGUSR1:
+		return signalReopenLog
+	}
+	return signalShutdown
+}
 
 func PlatformMain() {
 	if err := New().Execute(); err != nil {
@@ -0,0 +1,44 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package cmd
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestExecuteSignals(t *testing.T) {
+	out := &bytes.Buffer{}
+	tpp := newTestPath(t, false)
+	defer tpp.close()
+
+	r := New()
+	r.platformPath = tpp
+	r.cmd.SetArgs([]string{})
+	r.cmd.SetOut(out)
+	r.cmd.SetErr(out)
+	done := make(chan struct{})
+	go func() {
+		if err := r.Execute(); err != nil {
+			t.Error(err)
+		}
+		close(done)
+	}()
+	time.Sleep(time.Second * 2)
+
+	for _, s := range []syscall.Signal{syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGTERM} {
+		if err := syscall.Kill(syscall.Getpid(), s); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Second)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 15):
+		t.Fatal("agent did not shutdown after SIGTERM")
+	}
+}
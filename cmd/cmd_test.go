@@ -10,6 +10,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -212,3 +214,59 @@ func TestExecuteMissingPlatformPaths(t *testing.T) {
 		t.Error("Unexpected error: ", err)
 	}
 }
+
+func TestExecuteConfigValidate(t *testing.T) {
+	out := &bytes.Buffer{}
+	tpp := newTestPath(t, false)
+	defer tpp.close()
+
+	r := New()
+	r.platformPath = tpp
+	r.cmd.SetArgs([]string{"config", "validate"})
+	r.cmd.SetOut(out)
+	r.cmd.SetErr(out)
+	if err := r.Execute(); err != nil {
+		t.Fatal("unexpected error: ", err, "\n", out.String())
+	}
+	if !strings.Contains(out.String(), "configuration is valid") {
+		t.Error("unexpected output: ", out.String())
+	}
+
+	invalidPath := filepath.Join(tpp.tempPath, "invalid.ini")
+	if err := os.WriteFile(invalidPath, []byte("[default]\ncpustat = true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	r = New()
+	r.platformPath = tpp
+	r.cmd.SetArgs([]string{"config", "validate", "--config", invalidPath})
+	r.cmd.SetOut(out)
+	r.cmd.SetErr(out)
+	if err := r.Execute(); err == nil {
+		t.Error("expected error for invalid configuration")
+	}
+	if !strings.Contains(out.String(), "default.cpustat: unknown key") {
+		t.Error("unexpected output: ", out.String())
+	}
+}
+
+func TestExecuteHashPassword(t *testing.T) {
+	out := &bytes.Buffer{}
+	r := New()
+	r.cmd.SetArgs([]string{"hash-password", "monitor"})
+	r.cmd.SetIn(strings.NewReader("secret\n"))
+	r.cmd.SetOut(out)
+	r.cmd.SetErr(out)
+	if err := r.Execute(); err != nil {
+		t.Fatal("unexpected error: ", err, "\n", out.String())
+	}
+
+	users, err := config.ParseBasicAuth(strings.TrimSpace(out.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Username != "monitor" || !utils.CheckPassword(users[0].Password, "secret") {
+		t.Error("unexpected output: ", out.String())
+	}
+}
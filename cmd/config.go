@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/spf13/cobra"
+)
+
+// newConfigCmd creates the "config" command with all its subcommands
+func (r *RootCmd) newConfigCmd() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the agent configuration",
+		Args:  cobra.NoArgs,
+	}
+
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "validate",
+		Short: "Validate the configuration, custom check and Prometheus exporter files",
+		Long: `Validate the configuration, custom check and Prometheus exporter files.
+Reports unknown keys, type errors and invalid values and exits with a non-zero exit code if any problem was found.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         r.runConfigValidate,
+	})
+
+	return configCmd
+}
+
+func (r *RootCmd) runConfigValidate(cmd *cobra.Command, args []string) error {
+	configPath := r.configPath
+	if configPath == "" {
+		configPath = r.platformPath.ConfigPath()
+		if configPath == "" {
+			return fmt.Errorf("no config path given")
+		}
+	}
+	// The platform path may point to the configuration directory
+	if info, err := os.Stat(configPath); err == nil && info.IsDir() {
+		configPath = filepath.Join(configPath, "config.ini")
+	}
+
+	errs := config.Validate(configPath)
+	if len(errs) == 0 {
+		cmd.Printf("%s: configuration is valid\n", configPath)
+		return nil
+	}
+
+	cmd.PrintErrf("Found %d problem(s):\n", len(errs))
+	for _, err := range errs {
+		if err.Warning {
+			cmd.PrintErrf("  warning: %s\n", err)
+		} else {
+			cmd.PrintErrf("  %s\n", err)
+		}
+	}
+	return fmt.Errorf("configuration is invalid")
+}
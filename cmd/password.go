@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// newHashPasswordCmd creates the "hash-password" command
+func (r *RootCmd) newHashPasswordCmd() *cobra.Command {
+	var algorithm string
+
+	hashCmd := &cobra.Command{
+		Use:   "hash-password [username]",
+		Short: "Create a password hash for the basic authentication of the webserver",
+		Long: `Create a password hash for the basic authentication of the webserver.
+The password is read from the terminal or the first line of stdin. If a username is given,
+the output can be used as value of the auth setting (e.g. auth = username:$2a$10$...).`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password, err := readPassword(cmd)
+			if err != nil {
+				return err
+			}
+			if password == "" {
+				return fmt.Errorf("empty password")
+			}
+
+			hash, err := utils.HashPassword(password, algorithm)
+			if err != nil {
+				return err
+			}
+			if len(args) > 0 {
+				cmd.Printf("%s:%s\n", args[0], hash)
+			} else {
+				cmd.Println(hash)
+			}
+			return nil
+		},
+	}
+	hashCmd.Flags().StringVar(&algorithm, "algorithm", utils.PasswordBcrypt, "Hash algorithm (bcrypt or argon2id)")
+
+	return hashCmd
+}
+
+// readPassword reads the password without echo from the terminal or the first line of stdin
+func readPassword(cmd *cobra.Command) (string, error) {
+	if f, ok := cmd.InOrStdin().(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		cmd.PrintErr("Password: ")
+		password, err := term.ReadPassword(int(f.Fd()))
+		cmd.PrintErrln()
+		if err != nil {
+			return "", err
+		}
+		cmd.PrintErr("Repeat password: ")
+		repeated, err := term.ReadPassword(int(f.Fd()))
+		cmd.PrintErrln()
+		if err != nil {
+			return "", err
+		}
+		if string(password) != string(repeated) {
+			return "", fmt.Errorf("passwords do not match")
+		}
+		return string(password), nil
+	}
+
+	line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -22,6 +22,14 @@ import (
 
 var elog debug.Log
 
+// handledSignals are the signals the agent reacts on
+// On Windows the service manager takes care of stop requests
+var handledSignals = []os.Signal{os.Interrupt}
+
+func actionForSignal(s os.Signal) signalAction {
+	return signalShutdown
+}
+
 type myservice struct{}
 
 func initWbem() {
@@ -146,7 +154,7 @@ func usage(errmsg string) {
 		"%s\n\n"+
 			"usage: %s <command>\n"+
 			"       where <command> is one of\n"+
-			"       install, remove, debug, start, stop.\n",
+			"       install, remove, debug, start, stop, config, hash-password.\n",
 		errmsg, os.Args[0])
 	os.Exit(2)
 }
@@ -309,6 +317,12 @@ func windows_service_main() {
 	case "debug":
 		runService(svcName, true)
 		return
+	case "config", "hash-password":
+		// config subcommands like "config validate" and hash-password are handled by cobra
+		if err := New().Execute(); err != nil {
+			os.Exit(1)
+		}
+		return
 	case "install":
 		err = installService(svcName, "my service")
 	case "remove":
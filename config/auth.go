@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
+)
+
+// BasicAuthUser is a user of the basic authentication of the webserver
+type BasicAuthUser struct {
+	Username string
+	// Password is a bcrypt or argon2 hash (see utils.HashPassword) or the password in plain text
+	Password string
+}
+
+// ParseBasicAuth parses the value of the auth setting.
+// Users (user:password) are separated by line breaks or whitespace. A line is a single user if any of its
+// whitespace separated parts does not contain a ':', so plain text passwords containing spaces keep working.
+// Empty lines and lines starting with # get ignored.
+func ParseBasicAuth(value string) ([]*BasicAuthUser, error) {
+	users := []*BasicAuthUser{}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entries := strings.Fields(line)
+		for _, entry := range entries {
+			if !strings.Contains(entry, ":") {
+				entries = []string{line}
+				break
+			}
+		}
+
+		for _, entry := range entries {
+			cred := strings.SplitN(entry, ":", 2)
+			if len(cred) != 2 || cred[0] == "" {
+				return nil, fmt.Errorf("invalid value (must be username:password)")
+			}
+			if seen[cred[0]] {
+				return nil, fmt.Errorf("duplicate user %s", cred[0])
+			}
+			seen[cred[0]] = true
+
+			if utils.IsPasswordHash(cred[1]) {
+				if err := utils.CheckPasswordHash(cred[1]); err != nil {
+					return nil, fmt.Errorf("invalid password hash of user %s: %w", cred[0], err)
+				}
+			}
+			users = append(users, &BasicAuthUser{
+				Username: cred[0],
+				Password: cred[1],
+			})
+		}
+	}
+	return users, nil
+}
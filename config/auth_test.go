@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestParseBasicAuth(t *testing.T) {
+	users, err := ParseBasicAuth("admin:pass:word monitor:$2y$10$abcdefghijklmnopqrstuuJ0Rj4zR6jzWJtE6hDX9yHcGQhfAtBnq\n# comment\n\nlegacy:with spaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []BasicAuthUser{
+		{Username: "admin", Password: "pass:word"},
+		{Username: "monitor", Password: "$2y$10$abcdefghijklmnopqrstuuJ0Rj4zR6jzWJtE6hDX9yHcGQhfAtBnq"},
+		{Username: "legacy", Password: "with spaces"},
+	}
+	if len(users) != len(expected) {
+		t.Fatal("unexpected users: ", users)
+	}
+	for i := range expected {
+		if *users[i] != expected[i] {
+			t.Errorf("unexpected user %d: %v", i, users[i])
+		}
+	}
+
+	for _, value := range []string{
+		"nocolon",
+		":password",
+		"user:a user:b",
+		"user:$2y$10$tooshort",
+		"user:$argon2id$v=19$m=65536$abc$def",
+	} {
+		if _, err := ParseBasicAuth(value); err == nil {
+			t.Error("expected error for: ", value)
+		}
+	}
+}
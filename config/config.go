@@ -3,9 +3,13 @@ package config
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/go-viper/encoding/ini"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/basiclog"
@@ -32,13 +36,21 @@ type CustomCheck struct {
 	// if not set the command will be just executed as it is
 	Shell         string `mapstructure:"shell"`
 	PowershellExe string `mapstructure:"powershell_exe"`
+	// Schedule is a cron expression (e.g. "15 2 * * *" for 02:15 daily)
+	// If set, the custom check runs at the given times instead of every interval
+	Schedule string `mapstructure:"schedule"`
+	// ActiveWindow limits the execution to a time window (e.g. "Mon-Fri 08:00-18:00")
+	// Outside of the window the custom check reports "not scheduled"
+	ActiveWindow string `mapstructure:"active_window"`
 }
 
 type PushConfiguration struct {
-	Push                    bool   `mapstructure:"enabled"`
-	HostUUID                string `mapstructure:"hostuuid"`
-	URL                     string `mapstructure:"url"`
-	Apikey                  string `mapstructure:"apikey"`
+	Push     bool   `mapstructure:"enabled"`
+	HostUUID string `mapstructure:"hostuuid"`
+	URL      string `mapstructure:"url"`
+	Apikey   string `mapstructure:"apikey"`
+	// ApikeyFile reads the api key from a file (e.g. a mounted secret)
+	ApikeyFile              string `mapstructure:"apikey_file"`
 	Proxy                   string `mapstructure:"proxy"`
 	Timeout                 int64  `mapstructure:"timeout"`
 	VerifyServerCertificate bool   `mapstructure:"verify-server-certificate"`
@@ -74,6 +86,8 @@ type PackagemanagerConfiguration struct {
 type Configuration struct {
 	ConfigurationPath string `json:"-" mapstructure:"-"`
 	viper             *viper.Viper
+	// tlsFiles is the state of the certificate files when the configuration was loaded
+	tlsFiles []fileState
 
 	// TLS
 
@@ -86,18 +100,49 @@ type Configuration struct {
 	AutoSslCrtFile   string `mapstructure:"autossl-crt-file"`
 	AutoSslKeyFile   string `mapstructure:"autossl-key-file"`
 	AutoSslCaFile    string `mapstructure:"autossl-ca-file"`
+	// AutoSslRenewDays is the number of days before the expiry of the AutoSSL certificate the agent requests
+	// a new certificate (0 = disabled)
+	AutoSslRenewDays int64 `mapstructure:"autossl-renew-days"`
+	// AutoSslPushRenewal submits the csr of the renewal to openITCOCKPIT in push mode
+	// Disabled by default, requires an openITCOCKPIT version which signs submitted csrs
+	AutoSslPushRenewal bool `mapstructure:"autossl-push-renewal"`
 
 	// Webserver
 
 	Address   string `mapstructure:"address"`
 	Port      int64  `mapstructure:"port"`
 	BasicAuth string `mapstructure:"auth"`
+	// BasicAuthFile reads the basic auth credentials (username:password) from a file
+	BasicAuthFile string `mapstructure:"auth_file"`
+	// Listen replaces address and port with a list of listen specs, each with its own TLS and auth policy
+	// e.g. "127.0.0.1:3333 tls=none auth=none, 10.0.0.5:3333 tls=required"
+	Listen []string `mapstructure:"listen"`
+
+	// Socket is the path of an additional unix domain socket the webserver listens on (empty = disabled)
+	// The access to the socket is only restricted by the permissions of the socket file
+	Socket string `mapstructure:"socket"`
+	// SocketMode is the file mode of the socket as octal number (e.g. 0660)
+	SocketMode string `mapstructure:"socket-mode"`
+	// SocketOwner changes the owner of the socket ("user", "user:group" or ":group")
+	SocketOwner string `mapstructure:"socket-owner"`
+
+	// HistorySize is the number of check results kept in memory per check for the /history endpoint
+	HistorySize int64 `mapstructure:"history-size"`
+	// HistoryMaxBytes limits the memory used by the history (0 = unlimited)
+	HistoryMaxBytes int64 `mapstructure:"history-max-bytes"`
+	// CheckRunMinInterval is the minimum time in seconds between two on-demand executions of the same check
+	CheckRunMinInterval int64 `mapstructure:"check-run-min-interval"`
 
 	// Config Misc
 
 	ConfigUpdate         bool   `mapstructure:"config-update-mode"`
 	CustomchecksFilePath string `mapstructure:"customchecks"`
 
+	// CustomchecksDir and PrometheusExportersDir are drop-in directories with one or more custom check or
+	// exporter files. The files get merged in lexical order after the single file configuration.
+	CustomchecksDir        string `mapstructure:"customchecks-dir"`
+	PrometheusExportersDir string `mapstructure:"prometheus-exporters-dir"`
+
 	// EnablePPROF for debugging memory leaks with the go tool pprof command
 	EnablePPROF bool `mapstructure:"enable-dev-pprof"`
 
@@ -125,15 +170,40 @@ type Configuration struct {
 	Libvirt         bool  `mapstructure:"libvirt"`
 	Ntp             bool  `mapstructure:"ntp"`
 
+	// CheckIntervals overrides the check interval for single checks
+	// The key is the name of the check (e.g. cpu, processes, docker) and the value the interval in seconds
+	CheckIntervals map[string]int64 `json:"check_intervals" mapstructure:"intervals"`
+
+	// CheckTimeouts overrides the timeout for single checks
+	// The key is the name of the check and the value the timeout in seconds
+	CheckTimeouts map[string]int64 `json:"check_timeouts" mapstructure:"timeouts"`
+
+	// CheckWorkers is the maximum number of checks executed in parallel
+	CheckWorkers int64 `mapstructure:"check-workers"`
+
+	// StateFile stores the counters of checks like disk_io or net_io to calculate the deltas after a restart
+	StateFile   string `mapstructure:"state-file"`
+	StateMaxAge int64  `mapstructure:"state-max-age"` // in seconds
+
+	// StaleResultFactor marks custom check and exporter results as stale if they are older than
+	// StaleResultFactor times their interval (0 = disabled)
+	StaleResultFactor int64 `mapstructure:"stale-result-factor"`
+
+	// MaxSplay is the maximum delay in seconds before the first execution of checks, custom checks,
+	// exporters and the software inventory. The actual delay is derived from the host uuid or the hostname.
+	MaxSplay int64 `mapstructure:"max-splay"`
+
 	// Alfresco
 
 	JmxUser     string `mapstructure:"alfresco-jmxuser"`
 	JmxPassword string `mapstructure:"alfresco-jmxpassword"`
-	JmxAddress  string `mapstructure:"alfresco-jmxaddress"`
-	JmxPort     int64  `mapstructure:"alfresco-jmxport"`
-	JmxPath     string `mapstructure:"alfresco-jmxpath"`
-	JmxQuery    string `mapstructure:"alfresco-jmxquery"`
-	JavaPath    string `mapstructure:"alfresco-javapath"`
+	// JmxPasswordFile reads the jmx password from a file
+	JmxPasswordFile string `mapstructure:"alfresco-jmxpassword_file"`
+	JmxAddress      string `mapstructure:"alfresco-jmxaddress"`
+	JmxPort         int64  `mapstructure:"alfresco-jmxport"`
+	JmxPath         string `mapstructure:"alfresco-jmxpath"`
+	JmxQuery        string `mapstructure:"alfresco-jmxquery"`
+	JavaPath        string `mapstructure:"alfresco-javapath"`
 
 	// WindowsEventLog with all event log types to monitor
 
@@ -160,37 +230,48 @@ type Configuration struct {
 }
 
 var defaultValue = map[string]interface{}{
-	"port":                 3333,
-	"interval":             30,
-	"qemustats":            true,
-	"cpustats":             true,
-	"load":                 true,
-	"memory":               true,
-	"processstats":         true,
-	"netstats":             true,
-	"netio":                true,
-	"sensors":              true,
-	"diskstats":            true,
-	"diskio":               true,
-	"swap":                 true,
-	"userstats":            true,
-	"winservices":          true,
-	"wineventlog":          true,
-	"systemdservices":      true,
-	"alfrescostats":        true,
-	"libvirt":              true,
-	"ntp":                  true,
-	"wineventlog-logtypes": "System,Application",
-	"wineventlog-age":      3600,
-	"wineventlog-cache":    3600,
-	"wineventlog-method":   "WMI",
-	"customchecks":         filepath.Join(platformpaths.Get().ConfigPath(), "customchecks.ini"),
-	"tls-security-level":   "lax",
-	"autossl-folder":       platformpaths.Get().ConfigPath(),
-	"autossl-csr-file":     filepath.Join(platformpaths.Get().ConfigPath(), "agent.csr"),
-	"autossl-crt-file":     filepath.Join(platformpaths.Get().ConfigPath(), "agent.crt"),
-	"autossl-key-file":     filepath.Join(platformpaths.Get().ConfigPath(), "agent.key"),
-	"autossl-ca-file":      filepath.Join(platformpaths.Get().ConfigPath(), "server_ca.crt"),
+	"port":                   3333,
+	"interval":               30,
+	"check-workers":          4,
+	"history-size":           10,
+	"history-max-bytes":      5242880,
+	"check-run-min-interval": 10,
+	"socket-mode":            "0660",
+	"qemustats":              true,
+	"cpustats":               true,
+	"load":                   true,
+	"memory":                 true,
+	"processstats":           true,
+	"netstats":               true,
+	"netio":                  true,
+	"sensors":                true,
+	"diskstats":              true,
+	"diskio":                 true,
+	"swap":                   true,
+	"userstats":              true,
+	"winservices":            true,
+	"wineventlog":            true,
+	"systemdservices":        true,
+	"alfrescostats":          true,
+	"libvirt":                true,
+	"ntp":                    true,
+	"wineventlog-logtypes":   "System,Application",
+	"wineventlog-age":        3600,
+	"wineventlog-cache":      3600,
+	"wineventlog-method":     "WMI",
+	"customchecks":           filepath.Join(platformpaths.Get().ConfigPath(), "customchecks.ini"),
+	"tls-security-level":     "lax",
+	"state-file":             filepath.Join(platformpaths.Get().ConfigPath(), "check_state.json"),
+	"state-max-age":          600,
+	"max-splay":              0,
+	"stale-result-factor":    3,
+	"autossl-folder":         platformpaths.Get().ConfigPath(),
+	"autossl-csr-file":       filepath.Join(platformpaths.Get().ConfigPath(), "agent.csr"),
+	"autossl-crt-file":       filepath.Join(platformpaths.Get().ConfigPath(), "agent.crt"),
+	"autossl-key-file":       filepath.Join(platformpaths.Get().ConfigPath(), "agent.key"),
+	"autossl-ca-file":        filepath.Join(platformpaths.Get().ConfigPath(), "server_ca.crt"),
+	"autossl-renew-days":     30,
+	"autossl-push-renewal":   false,
 }
 
 var oitcDefaultvalue = map[string]interface{}{
@@ -227,7 +308,61 @@ func setConfigurationDefaults(v *viper.Viper) {
 	}
 }
 
-func unmarshalConfiguration(v *viper.Viper) (*Configuration, error) {
+// EnvPrefix is the prefix of the environment variables overriding configuration keys
+// The variables are named OITC_AGENT_<SECTION>_<KEY>, e.g. OITC_AGENT_DEFAULT_PORT or OITC_AGENT_OITC_APIKEY
+const EnvPrefix = "OITC_AGENT"
+
+// structKeys returns the keys of all simple (not nested) fields of the given struct
+func structKeys(s interface{}) []string {
+	keys := []string{}
+	t := reflect.TypeOf(s)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Map, reflect.Pointer, reflect.Struct:
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// bindEnvironment lets environment variables override all configuration keys
+func bindEnvironment(v *viper.Viper) {
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+
+	sections := map[string]interface{}{
+		"default":        Configuration{},
+		"oitc":           PushConfiguration{},
+		"prometheus":     PrometheusConfiguration{},
+		"packagemanager": PackagemanagerConfiguration{},
+	}
+	for section, s := range sections {
+		for _, key := range structKeys(s) {
+			_ = v.BindEnv(section + "." + key)
+		}
+	}
+
+	// The keys of the intervals and timeouts sections are check names, so we can not bind them in advance
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		for _, section := range []string{"intervals", "timeouts"} {
+			prefix := EnvPrefix + "_" + strings.ToUpper(section) + "_"
+			if check := strings.TrimPrefix(name, prefix); check != name && check != "" {
+				v.Set(section+"."+strings.ToLower(check), value)
+			}
+		}
+	}
+}
+
+// unmarshalConfiguration decodes the configuration and loads the custom checks and exporters
+// customChecksPath and exportersPath replace the configured files if set
+func unmarshalConfiguration(v *viper.Viper, customChecksPath, exportersPath string) (*Configuration, error) {
 	cfg := &Configuration{}
 	cfg.Default = cfg
 	cfg.OITC = &PushConfiguration{}
@@ -244,19 +379,40 @@ func unmarshalConfiguration(v *viper.Viper) (*Configuration, error) {
 	cfg.ConfigurationPath = v.ConfigFileUsed()
 	cfg.viper = v
 
-	if cfg.CustomchecksFilePath != "" {
-		if utils.FileExists(cfg.CustomchecksFilePath) {
-			if ccc, err := unmarshalCustomChecks(cfg.CustomchecksFilePath); err != nil {
-				logger, _ := basiclog.New()
-				logger.Errorln("Configuration: could not load custom checks: ", err)
-			} else {
-				cfg.CustomCheckConfiguration = ccc
-			}
+	if err := cfg.readSecretFiles(); err != nil {
+		return nil, err
+	}
+
+	cfg.tlsFiles = newFileStates(cfg.CertificateFile, cfg.KeyFile, cfg.AutoSslCrtFile, cfg.AutoSslKeyFile, cfg.AutoSslCaFile)
+
+	if customChecksPath == "" {
+		customChecksPath = cfg.CustomchecksFilePath
+	}
+	ccFiles := []string{}
+	if customChecksPath != "" {
+		if utils.FileExists(customChecksPath) {
+			ccFiles = append(ccFiles, customChecksPath)
 		} else {
 			logger, _ := basiclog.New()
-			logger.Errorln("Configuration: custom check configuration does not exist: ", cfg.CustomchecksFilePath)
+			logger.Errorln("Configuration: custom check configuration does not exist: ", customChecksPath)
+		}
+	}
+	if cfg.CustomchecksDir != "" {
+		if files, err := dropInFiles(cfg.CustomchecksDir); err != nil {
+			logger, _ := basiclog.New()
+			logger.Errorln("Configuration: could not read custom check directory: ", err)
+		} else {
+			ccFiles = append(ccFiles, files...)
 		}
 	}
+	if len(ccFiles) > 0 {
+		ccc, errs := mergeCustomChecks(ccFiles)
+		for _, err := range errs {
+			logger, _ := basiclog.New()
+			logger.Errorln("Configuration: could not load custom checks: ", err)
+		}
+		cfg.CustomCheckConfiguration = ccc
+	}
 
 	// we have to set at least an empty array if we don't load any configuration
 	if cfg.CustomCheckConfiguration == nil {
@@ -264,17 +420,34 @@ func unmarshalConfiguration(v *viper.Viper) (*Configuration, error) {
 	}
 
 	// Parse Prometheus Exporter configuration
-	if cfg.Prometheus.ExportersFilePath != "" && cfg.Prometheus.Enable {
-		if utils.FileExists(cfg.Prometheus.ExportersFilePath) {
-			if promExporters, err := unmarshalPrometheusExporters(cfg.Prometheus.ExportersFilePath); err != nil {
+	if cfg.Prometheus.Enable {
+		exporterFiles := []string{}
+		if exportersPath == "" {
+			exportersPath = cfg.Prometheus.ExportersFilePath
+		}
+		if exportersPath != "" {
+			if utils.FileExists(exportersPath) {
+				exporterFiles = append(exporterFiles, exportersPath)
+			} else {
 				logger, _ := basiclog.New()
-				logger.Errorln("Configuration: could not load prometheus exporter: ", err)
+				logger.Errorln("Configuration: Prometheus exporter configuration does not exist: ", exportersPath)
+			}
+		}
+		if cfg.PrometheusExportersDir != "" {
+			if files, err := dropInFiles(cfg.PrometheusExportersDir); err != nil {
+				logger, _ := basiclog.New()
+				logger.Errorln("Configuration: could not read Prometheus exporter directory: ", err)
 			} else {
-				cfg.PrometheusExporterConfiguration = promExporters
+				exporterFiles = append(exporterFiles, files...)
 			}
-		} else {
-			logger, _ := basiclog.New()
-			logger.Errorln("Configuration: Prometheus exporter configuration does not exist: ", cfg.CustomchecksFilePath)
+		}
+		if len(exporterFiles) > 0 {
+			promExporters, errs := mergePrometheusExporters(exporterFiles)
+			for _, err := range errs {
+				logger, _ := basiclog.New()
+				logger.Errorln("Configuration: could not load prometheus exporter: ", err)
+			}
+			cfg.PrometheusExporterConfiguration = promExporters
 		}
 	}
 
@@ -286,45 +459,88 @@ func unmarshalConfiguration(v *viper.Viper) (*Configuration, error) {
 	return cfg, nil
 }
 
-// Load configuration from default paths or configPath. The reload func must be short lived or start a go routine.
-func Load(ctx context.Context, configPath string) (*Configuration, error) {
+// Supported configuration formats
+const (
+	FormatIni  = "ini"
+	FormatYaml = "yaml"
+	FormatToml = "toml"
+)
+
+// Format returns the configuration format of the given file based on the file extension
+// Files without a .yaml, .yml or .toml extension are INI files
+func Format(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYaml
+	case ".toml":
+		return FormatToml
+	}
+	return FormatIni
+}
+
+// newViper creates a viper instance for the given file, the format is detected by the file extension
+func newViper(configPath string) *viper.Viper {
 	// Register the INI encoding
 	// As ini support got removed from viper with v1.20.0
 	// https://github.com/spf13/viper/releases/tag/v1.20.0
 	// https://github.com/spf13/viper/blob/master/UPGRADE.md#v120x
+	// YAML and TOML are supported by viper out of the box
 	codecRegistry := viper.NewCodecRegistry()
-	codecRegistry.RegisterCodec("ini", ini.Codec{})
+	codecRegistry.RegisterCodec(FormatIni, ini.Codec{})
 
 	v := viper.NewWithOptions(
 		viper.WithCodecRegistry(codecRegistry),
 	)
 
-	setConfigurationDefaults(v)
-
 	v.SetConfigFile(configPath)
-	v.SetConfigType("ini")
+	v.SetConfigType(Format(configPath))
+	return v
+}
+
+// Load configuration from default paths or configPath. The reload func must be short lived or start a go routine.
+func Load(ctx context.Context, configPath string) (*Configuration, error) {
+	return LoadWithFiles(ctx, configPath, "", "")
+}
+
+// LoadWithFiles loads the configuration like Load, but reads the custom checks and Prometheus exporters from
+// the given files instead of the files configured in the configuration file (e.g. to preview a configuration push).
+// Empty paths fall back to the configured files.
+func LoadWithFiles(ctx context.Context, configPath, customChecksPath, exportersPath string) (*Configuration, error) {
+	v := newViper(configPath)
+	setConfigurationDefaults(v)
+	bindEnvironment(v)
 
 	if err := v.ReadInConfig(); err != nil {
 		return nil, err
 	}
 
-	return unmarshalConfiguration(v)
+	return unmarshalConfiguration(v, customChecksPath, exportersPath)
 }
 
-func unmarshalCustomChecks(configPath string) ([]*CustomCheck, error) {
-	// Register the INI encoding
-	// As ini support got removed from viper with v1.20.0
-	// https://github.com/spf13/viper/releases/tag/v1.20.0
-	// https://github.com/spf13/viper/blob/master/UPGRADE.md#v120x
-	codecRegistry := viper.NewCodecRegistry()
-	codecRegistry.RegisterCodec("ini", ini.Codec{})
+// dropInFiles returns all configuration files (.ini, .yaml, .yml or .toml) of the directory in lexical order
+// Hidden files and files with other extensions (e.g. backups of editors or package managers) get ignored
+func dropInFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
 
-	v := viper.NewWithOptions(
-		viper.WithCodecRegistry(codecRegistry),
-	)
+	files := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".ini", ".yaml", ".yml", ".toml":
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
 
-	v.SetConfigFile(configPath)
-	v.SetConfigType("ini")
+// decodeCustomChecks returns all custom checks (enabled and disabled) of the file sorted by name
+func decodeCustomChecks(configPath string) ([]*CustomCheck, error) {
+	v := newViper(configPath)
 
 	if err := v.ReadInConfig(); err != nil {
 		return nil, err
@@ -349,29 +565,61 @@ func unmarshalCustomChecks(configPath string) ([]*CustomCheck, error) {
 			if strings.TrimSpace(check.Command) == "" {
 				return nil, fmt.Errorf("missing command in custom check: %s", check.Name)
 			}
-			if check.Enabled {
-				checks = append(checks, check)
-			}
+			checks = append(checks, check)
 		}
 	}
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].Name < checks[j].Name
+	})
 
 	return checks, nil
 }
 
-func unmarshalPrometheusExporters(configPath string) ([]*PrometheusExporter, error) {
-	// Register the INI encoding
-	// As ini support got removed from viper with v1.20.0
-	// https://github.com/spf13/viper/releases/tag/v1.20.0
-	// https://github.com/spf13/viper/blob/master/UPGRADE.md#v120x
-	codecRegistry := viper.NewCodecRegistry()
-	codecRegistry.RegisterCodec("ini", ini.Codec{})
+func unmarshalCustomChecks(configPath string) ([]*CustomCheck, error) {
+	checks, err := decodeCustomChecks(configPath)
+	if err != nil {
+		return nil, err
+	}
 
-	v := viper.NewWithOptions(
-		viper.WithCodecRegistry(codecRegistry),
-	)
+	enabled := make([]*CustomCheck, 0)
+	for _, check := range checks {
+		if check.Enabled {
+			enabled = append(enabled, check)
+		}
+	}
+	return enabled, nil
+}
 
-	v.SetConfigFile(configPath)
-	v.SetConfigType("ini")
+// mergeCustomChecks loads the enabled custom checks of all files in the given order
+// A file with an invalid custom check gets skipped. If a custom check is defined in more than one file,
+// only the definition of the first file is used.
+func mergeCustomChecks(files []string) ([]*CustomCheck, []error) {
+	var errs []error
+	definedIn := map[string]string{}
+	enabled := make([]*CustomCheck, 0)
+	for _, file := range files {
+		checks, err := decodeCustomChecks(file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+			continue
+		}
+		for _, check := range checks {
+			if first, ok := definedIn[check.Name]; ok {
+				errs = append(errs, fmt.Errorf("%s: duplicate custom check %s (already defined in %s)", file, check.Name, first))
+				continue
+			}
+			definedIn[check.Name] = file
+			if check.Enabled {
+				enabled = append(enabled, check)
+			}
+		}
+	}
+	return enabled, errs
+}
+
+// decodePrometheusExporters returns all exporters (enabled and disabled) of the file sorted by name
+func decodePrometheusExporters(configPath string) ([]*PrometheusExporter, error) {
+	v := newViper(configPath)
 
 	if err := v.ReadInConfig(); err != nil {
 		return nil, err
@@ -400,15 +648,94 @@ func unmarshalPrometheusExporters(configPath string) ([]*PrometheusExporter, err
 			if strings.TrimSpace(check.Path) == "" {
 				return nil, fmt.Errorf("missing path for prometheus exporter: %s", check.Name)
 			}
-			if check.Enabled {
-				exporters = append(exporters, check)
-			}
+			exporters = append(exporters, check)
 		}
 	}
+	sort.Slice(exporters, func(i, j int) bool {
+		return exporters[i].Name < exporters[j].Name
+	})
 
 	return exporters, nil
 }
 
+// mergePrometheusExporters loads the enabled exporters of all files in the given order
+// A file with an invalid exporter gets skipped. If an exporter is defined in more than one file,
+// only the definition of the first file is used.
+func mergePrometheusExporters(files []string) ([]*PrometheusExporter, []error) {
+	var errs []error
+	definedIn := map[string]string{}
+	enabled := make([]*PrometheusExporter, 0)
+	for _, file := range files {
+		exporters, err := decodePrometheusExporters(file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+			continue
+		}
+		for _, exporter := range exporters {
+			if first, ok := definedIn[exporter.Name]; ok {
+				errs = append(errs, fmt.Errorf("%s: duplicate prometheus exporter %s (already defined in %s)", file, exporter.Name, first))
+				continue
+			}
+			definedIn[exporter.Name] = file
+			if exporter.Enabled {
+				enabled = append(enabled, exporter)
+			}
+		}
+	}
+	return enabled, errs
+}
+
+// IntervalForCheck returns the interval in seconds of the check with the given name
+// Falls back to the global check interval if no individual interval is configured
+func (c *Configuration) IntervalForCheck(name string) int64 {
+	if interval, ok := c.CheckIntervals[name]; ok && interval > 0 {
+		return interval
+	}
+	return c.CheckInterval
+}
+
+// TimeoutForCheck returns the timeout in seconds of the check with the given name
+// Falls back to the interval of the check minus one second if no individual timeout is configured
+func (c *Configuration) TimeoutForCheck(name string) int64 {
+	if timeout, ok := c.CheckTimeouts[name]; ok && timeout > 0 {
+		return timeout
+	}
+	if interval := c.IntervalForCheck(name); interval > 1 {
+		return interval - 1
+	}
+	return 1
+}
+
+// Splay returns the deterministic delay of this host between 0 and max-splay
+// All agents of a fleet get spread over the splay window, but each agent always uses the same delay
+func (c *Configuration) Splay() time.Duration {
+	if c.MaxSplay <= 0 {
+		return 0
+	}
+
+	id := ""
+	if c.OITC != nil {
+		id = c.OITC.HostUUID
+	}
+	if id == "" {
+		id, _ = os.Hostname()
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	maxSplay := uint64(time.Duration(c.MaxSplay) * time.Second / time.Millisecond)
+	return time.Duration(h.Sum64()%maxSplay) * time.Millisecond
+}
+
+// SplayForInterval returns the splay limited to the given interval, so the first execution never
+// gets delayed longer than one interval
+func SplayForInterval(splay, interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+	return splay % interval
+}
+
 func (c *Configuration) SaveConfiguration(config []byte) error {
 	if err := os.WriteFile(c.ConfigurationPath, config, 0600); err != nil {
 		return err
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/platformpaths"
 )
@@ -504,3 +505,319 @@ func TestReadAgentConfigWithCCAndNewConfig(t *testing.T) {
 		t.Error("reload did not work, unexpected number of custom checks (0): ", len(ccc))
 	}
 }
+
+var agentConfigWithCheckIntervals string = `[default]
+interval = 30
+
+[intervals]
+cpu = 15
+processes = 300
+`
+
+func TestReadConfigCheckIntervals(t *testing.T) {
+	cfgdir := saveTempConfig(agentConfigWithCheckIntervals, false)
+	defer os.RemoveAll(cfgdir)
+
+	c, err := Load(context.Background(), filepath.Join(cfgdir, "config.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.IntervalForCheck("cpu") != 15 {
+		t.Error("cpu interval expect to be 15, got: ", c.IntervalForCheck("cpu"))
+	}
+
+	if c.IntervalForCheck("processes") != 300 {
+		t.Error("processes interval expect to be 300, got: ", c.IntervalForCheck("processes"))
+	}
+
+	if c.IntervalForCheck("memory") != 30 {
+		t.Error("memory interval expect to fall back to 30, got: ", c.IntervalForCheck("memory"))
+	}
+}
+
+func TestSplay(t *testing.T) {
+	c := &Configuration{
+		MaxSplay: 300,
+		OITC: &PushConfiguration{
+			HostUUID: "0f47b5b0-7b4d-4d6a-9d1b-6ad3f2d4e0c1",
+		},
+	}
+
+	splay := c.Splay()
+	if splay < 0 || splay >= 300*time.Second {
+		t.Fatal("splay out of range: ", splay)
+	}
+	if c.Splay() != splay {
+		t.Error("splay is not deterministic")
+	}
+
+	c.OITC.HostUUID = "7c1e9a52-3a8f-4a44-8f0e-2f5d9b3c6a11"
+	if c.Splay() == splay {
+		t.Error("expected a different splay for a different host uuid")
+	}
+
+	if d := SplayForInterval(90*time.Second, time.Minute); d != 30*time.Second {
+		t.Error("unexpected splay for interval: ", d)
+	}
+
+	c.MaxSplay = 0
+	if c.Splay() != 0 {
+		t.Error("splay expected to be disabled")
+	}
+}
+
+var customChecksWithSchedule string = `
+[check_backup]
+  command = /usr/local/bin/check_backup
+  schedule = 15 2 * * *
+  timeout = 300
+  enabled = true
+
+[check_batch_jobs]
+  command = /usr/local/bin/check_batch_jobs
+  active_window = Mon-Fri 08:00-18:00
+  interval = 60
+  enabled = true
+`
+
+func TestReadCustomChecksConfigSchedule(t *testing.T) {
+	cfgdir := saveTempConfig(customChecksWithSchedule, true)
+	defer os.RemoveAll(cfgdir)
+
+	ccc, err := unmarshalCustomChecks(filepath.Join(cfgdir, "customchecks.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ccc) != 2 {
+		t.Fatal("unexpected number of custom checks (2): ", len(ccc))
+	}
+
+	for _, customcheck := range ccc {
+		switch customcheck.Name {
+		case "check_backup":
+			if customcheck.Schedule != "15 2 * * *" {
+				t.Error("unexpected schedule: ", customcheck.Schedule)
+			}
+		case "check_batch_jobs":
+			if customcheck.ActiveWindow != "Mon-Fri 08:00-18:00" {
+				t.Error("unexpected active window: ", customcheck.ActiveWindow)
+			}
+		default:
+			t.Error("unexpected custom check: ", customcheck.Name)
+		}
+	}
+}
+
+var agentConfigYaml string = `default:
+  interval: 15
+  port: 3334
+  wineventlog-logtypes:
+    - System
+    - Application
+    - Sophos Cloud AD Sync
+  customchecks: %s
+  intervals:
+    cpu: 5
+prometheus:
+  enabled: true
+  exporters: %s
+`
+
+var customChecksYaml string = `check_multiline:
+  command: |
+    echo hello
+    echo world
+  interval: 30
+  timeout: 10
+  enabled: true
+`
+
+var prometheusExportersYaml string = `node_exporter:
+  port: 9100
+  path: /metrics
+  enabled: true
+`
+
+var agentConfigToml string = `[default]
+interval = 15
+port = 3334
+wineventlog-logtypes = ["System", "Application", "Sophos Cloud AD Sync"]
+customchecks = "%s"
+
+[default.intervals]
+cpu = 5
+
+[prometheus]
+enabled = true
+exporters = "%s"
+`
+
+var customChecksToml string = `[check_multiline]
+command = """
+echo hello
+echo world
+"""
+interval = 30
+timeout = 10
+enabled = true
+`
+
+var prometheusExportersToml string = `[node_exporter]
+port = 9100
+path = "/metrics"
+enabled = true
+`
+
+func TestReadConfigFormats(t *testing.T) {
+	tests := []struct {
+		ext          string
+		config       string
+		customchecks string
+		exporters    string
+	}{
+		{"yaml", agentConfigYaml, customChecksYaml, prometheusExportersYaml},
+		{"yml", agentConfigYaml, customChecksYaml, prometheusExportersYaml},
+		{"toml", agentConfigToml, customChecksToml, prometheusExportersToml},
+	}
+
+	for _, test := range tests {
+		tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		configPath := filepath.Join(tmpDir, "config."+test.ext)
+		ccPath := filepath.Join(tmpDir, "customchecks."+test.ext)
+		exportersPath := filepath.Join(tmpDir, "prometheus_exporters."+test.ext)
+		if err := os.WriteFile(configPath, []byte(fmt.Sprintf(test.config, ccPath, exportersPath)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(ccPath, []byte(test.customchecks), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(exportersPath, []byte(test.exporters), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := Load(context.Background(), configPath)
+		if err != nil {
+			t.Fatal(test.ext, ": ", err)
+		}
+
+		if c.CheckInterval != 15 || c.Port != 3334 {
+			t.Error(test.ext, ": unexpected interval or port: ", c.CheckInterval, c.Port)
+		}
+		if c.IntervalForCheck("cpu") != 5 {
+			t.Error(test.ext, ": unexpected cpu interval: ", c.IntervalForCheck("cpu"))
+		}
+		if len(c.WindowsEventLogTypes) != 3 || c.WindowsEventLogTypes[2] != "Sophos Cloud AD Sync" {
+			t.Error(test.ext, ": unexpected event log types: ", c.WindowsEventLogTypes)
+		}
+		if len(c.CustomCheckConfiguration) != 1 || c.CustomCheckConfiguration[0].Command != "echo hello\necho world\n" {
+			t.Fatal(test.ext, ": unexpected custom checks: ", c.CustomCheckConfiguration)
+		}
+		if len(c.PrometheusExporterConfiguration) != 1 || c.PrometheusExporterConfiguration[0].Port != 9100 {
+			t.Fatal(test.ext, ": unexpected exporters: ", c.PrometheusExporterConfiguration)
+		}
+	}
+}
+
+func TestReadCustomChecksDir(t *testing.T) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ccDir := filepath.Join(tmpDir, "customchecks.d")
+	exportersDir := filepath.Join(tmpDir, "prometheus_exporters.d")
+	for _, dir := range []string{ccDir, exportersDir} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		"config.ini": `[default]
+customchecks = ` + filepath.Join(tmpDir, "customchecks.ini") + `
+customchecks-dir = ` + ccDir + `
+prometheus-exporters-dir = ` + exportersDir + `
+
+[prometheus]
+enabled = true
+exporters =
+`,
+		"customchecks.ini": `[check_a]
+command = echo a
+enabled = true
+`,
+		"customchecks.d/20-other.yaml": `check_a:
+  command: echo duplicate
+  enabled: true
+check_b:
+  command: echo b
+  enabled: true
+`,
+		"customchecks.d/10-mysql.ini": `[check_mysql]
+command = echo mysql
+enabled = true
+
+[check_disabled]
+command = echo disabled
+enabled = false
+`,
+		"customchecks.d/.hidden.ini": `[check_hidden]
+command = echo hidden
+enabled = true
+`,
+		"customchecks.d/10-mysql.ini.bak": `[check_backup]
+command = echo backup
+enabled = true
+`,
+		"prometheus_exporters.d/node.ini": `[node_exporter]
+port = 9100
+path = /metrics
+enabled = true
+`,
+		"prometheus_exporters.d/node2.toml": `[node_exporter]
+port = 9101
+path = "/metrics"
+enabled = true
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := Load(context.Background(), filepath.Join(tmpDir, "config.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, cc := range c.CustomCheckConfiguration {
+		names = append(names, cc.Name+"="+cc.Command)
+	}
+	if strings.Join(names, ",") != "check_a=echo a,check_mysql=echo mysql,check_b=echo b" {
+		t.Error("unexpected custom checks: ", names)
+	}
+
+	if len(c.PrometheusExporterConfiguration) != 1 || c.PrometheusExporterConfiguration[0].Port != 9100 {
+		t.Error("unexpected exporters: ", c.PrometheusExporterConfiguration)
+	}
+
+	errs := Validate(filepath.Join(tmpDir, "config.ini"))
+	report := []string{}
+	for _, err := range errs {
+		report = append(report, err.Error())
+	}
+	all := strings.Join(report, "\n")
+	if len(errs) != 2 || !strings.Contains(all, "check_a: duplicate custom check") || !strings.Contains(all, "node_exporter: duplicate prometheus exporter") {
+		t.Error("unexpected validation result:\n", all)
+	}
+}
@@ -0,0 +1,357 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Diff describes which parts of the agent are affected by a configuration change
+type Diff struct {
+	// Webserver settings like address, port, tls or authentication changed
+	Webserver bool
+	// TLS settings or certificates of the webserver changed
+	TLS bool
+	// Checks settings of the built-in checks changed
+	Checks bool
+	// Push settings of the push client changed
+	Push bool
+	// Packagemanager settings of the software inventory changed
+	Packagemanager bool
+	// Splay the delay before the first execution changed, which affects all scheduled components
+	Splay bool
+
+	CustomChecksAdded    []string
+	CustomChecksRemoved  []string
+	CustomChecksModified []string
+
+	PrometheusExportersAdded    []string
+	PrometheusExportersRemoved  []string
+	PrometheusExportersModified []string
+}
+
+// CustomChecksChanged returns true if any custom check was added, removed or modified
+func (d *Diff) CustomChecksChanged() bool {
+	return len(d.CustomChecksAdded) > 0 || len(d.CustomChecksRemoved) > 0 || len(d.CustomChecksModified) > 0
+}
+
+// PrometheusExportersChanged returns true if any Prometheus exporter was added, removed or modified
+func (d *Diff) PrometheusExportersChanged() bool {
+	return len(d.PrometheusExportersAdded) > 0 || len(d.PrometheusExportersRemoved) > 0 || len(d.PrometheusExportersModified) > 0
+}
+
+// fileState is the size and modification time of a file at the time the configuration was loaded
+// It is used to detect new or renewed certificates, which do not change the configuration itself
+type fileState struct {
+	Path    string
+	Exists  bool
+	Size    int64
+	ModTime time.Time
+}
+
+func newFileStates(paths ...string) []fileState {
+	states := make([]fileState, 0, len(paths))
+	for _, path := range paths {
+		state := fileState{Path: path}
+		if path != "" {
+			if info, err := os.Stat(path); err == nil {
+				state.Exists = true
+				state.Size = info.Size()
+				state.ModTime = info.ModTime()
+			}
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+func filesExist(states []fileState) []bool {
+	exist := make([]bool, 0, len(states))
+	for _, state := range states {
+		exist = append(exist, state.Exists)
+	}
+	return exist
+}
+
+// tlsSettings contains all settings which change the tls configuration of the webserver
+type tlsSettings struct {
+	AutoSslEnabled   bool
+	TlsSecurityLevel string
+	CertificateFile  string
+	KeyFile          string
+	AutoSslCrtFile   string
+	AutoSslKeyFile   string
+	AutoSslCaFile    string
+	TlsFiles         []fileState
+}
+
+func newTlsSettings(c *Configuration) tlsSettings {
+	return tlsSettings{
+		AutoSslEnabled:   c.AutoSslEnabled,
+		TlsSecurityLevel: c.TlsSecurityLevel,
+		CertificateFile:  c.CertificateFile,
+		KeyFile:          c.KeyFile,
+		AutoSslCrtFile:   c.AutoSslCrtFile,
+		AutoSslKeyFile:   c.AutoSslKeyFile,
+		AutoSslCaFile:    c.AutoSslCaFile,
+		TlsFiles:         c.tlsFiles,
+	}
+}
+
+// webserverSettings contains all settings which require a reload of the webserver
+type webserverSettings struct {
+	AutoSslEnabled       bool
+	TlsSecurityLevel     string
+	CertificateFile      string
+	KeyFile              string
+	AutoSslFolder        string
+	AutoSslCsrFile       string
+	AutoSslCrtFile       string
+	AutoSslKeyFile       string
+	AutoSslCaFile        string
+	Address              string
+	Port                 int64
+	Listen               []string
+	BasicAuth            string
+	Socket               string
+	SocketMode           string
+	SocketOwner          string
+	HistorySize          int64
+	HistoryMaxBytes      int64
+	CheckRunMinInterval  int64
+	ConfigUpdate         bool
+	EnablePPROF          bool
+	ConfigurationPath    string
+	CustomchecksFilePath string
+	Prometheus           *PrometheusConfiguration
+	PrometheusExporters  []string
+	// TlsFilesExist only contains if the certificate files exist, as renewed certificates get reloaded
+	// by the webserver without a restart. New certificates may enable TLS, which requires a restart.
+	TlsFilesExist []bool
+}
+
+func newWebserverSettings(c *Configuration) webserverSettings {
+	exporters := make([]string, 0, len(c.PrometheusExporterConfiguration))
+	for _, e := range c.PrometheusExporterConfiguration {
+		exporters = append(exporters, e.Name)
+	}
+	sort.Strings(exporters)
+
+	return webserverSettings{
+		AutoSslEnabled:       c.AutoSslEnabled,
+		TlsSecurityLevel:     c.TlsSecurityLevel,
+		CertificateFile:      c.CertificateFile,
+		KeyFile:              c.KeyFile,
+		AutoSslFolder:        c.AutoSslFolder,
+		AutoSslCsrFile:       c.AutoSslCsrFile,
+		AutoSslCrtFile:       c.AutoSslCrtFile,
+		AutoSslKeyFile:       c.AutoSslKeyFile,
+		AutoSslCaFile:        c.AutoSslCaFile,
+		Address:              c.Address,
+		Port:                 c.Port,
+		Listen:               c.Listen,
+		BasicAuth:            c.BasicAuth,
+		Socket:               c.Socket,
+		SocketMode:           c.SocketMode,
+		SocketOwner:          c.SocketOwner,
+		HistorySize:          c.HistorySize,
+		HistoryMaxBytes:      c.HistoryMaxBytes,
+		CheckRunMinInterval:  c.CheckRunMinInterval,
+		ConfigUpdate:         c.ConfigUpdate,
+		EnablePPROF:          c.EnablePPROF,
+		ConfigurationPath:    c.ConfigurationPath,
+		CustomchecksFilePath: c.CustomchecksFilePath,
+		Prometheus:           c.Prometheus,
+		PrometheusExporters:  exporters,
+		TlsFilesExist:        filesExist(c.tlsFiles),
+	}
+}
+
+// checkSettings returns a copy of the configuration without all settings which are not used by the built-in checks
+func checkSettings(c *Configuration) Configuration {
+	cpy := *c
+	cpy.viper = nil
+	cpy.tlsFiles = nil
+	cpy.Default = nil
+	cpy.ConfigurationPath = ""
+	cpy.CustomchecksFilePath = ""
+	cpy.CustomchecksDir = ""
+	cpy.PrometheusExportersDir = ""
+	cpy.CustomCheckConfiguration = nil
+	cpy.PrometheusExporterConfiguration = nil
+	cpy.Prometheus = nil
+	cpy.Packagemanager = nil
+	cpy.OITC = nil
+	cpy.StaleResultFactor = 0
+
+	// Webserver settings
+	// AutoSslEnabled and AutoSslCrtFile are kept, the agent check reports the expiry of the AutoSSL certificate
+	cpy.TlsSecurityLevel = ""
+	cpy.CertificateFile = ""
+	cpy.KeyFile = ""
+	cpy.AutoSslFolder = ""
+	cpy.AutoSslCsrFile = ""
+	cpy.AutoSslKeyFile = ""
+	cpy.AutoSslCaFile = ""
+	cpy.Address = ""
+	cpy.Port = 0
+	cpy.Listen = nil
+	cpy.BasicAuth = ""
+	cpy.BasicAuthFile = ""
+	cpy.Socket = ""
+	cpy.SocketMode = ""
+	cpy.SocketOwner = ""
+	cpy.HistorySize = 0
+	cpy.HistoryMaxBytes = 0
+	cpy.CheckRunMinInterval = 0
+	cpy.ConfigUpdate = false
+	cpy.EnablePPROF = false
+
+	return cpy
+}
+
+func diffCustomChecks(old, new []*CustomCheck) (added, removed, modified []string) {
+	oldChecks := make(map[string]*CustomCheck, len(old))
+	for _, check := range old {
+		oldChecks[check.Name] = check
+	}
+
+	for _, check := range new {
+		oldCheck, ok := oldChecks[check.Name]
+		if !ok {
+			added = append(added, check.Name)
+		} else if !reflect.DeepEqual(oldCheck, check) {
+			modified = append(modified, check.Name)
+		}
+		delete(oldChecks, check.Name)
+	}
+
+	for name := range oldChecks {
+		removed = append(removed, name)
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(modified)
+	return added, removed, modified
+}
+
+func diffPrometheusExporters(old, new []*PrometheusExporter) (added, removed, modified []string) {
+	oldExporters := make(map[string]*PrometheusExporter, len(old))
+	for _, exporter := range old {
+		oldExporters[exporter.Name] = exporter
+	}
+
+	for _, exporter := range new {
+		oldExporter, ok := oldExporters[exporter.Name]
+		if !ok {
+			added = append(added, exporter.Name)
+		} else if !reflect.DeepEqual(oldExporter, exporter) {
+			modified = append(modified, exporter.Name)
+		}
+		delete(oldExporters, exporter.Name)
+	}
+
+	for name := range oldExporters {
+		removed = append(removed, name)
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(modified)
+	return added, removed, modified
+}
+
+// Compare two configurations and return which parts of the agent have to be restarted
+func Compare(old, new *Configuration) *Diff {
+	d := &Diff{
+		Webserver:      !reflect.DeepEqual(newWebserverSettings(old), newWebserverSettings(new)),
+		TLS:            !reflect.DeepEqual(newTlsSettings(old), newTlsSettings(new)),
+		Checks:         !reflect.DeepEqual(checkSettings(old), checkSettings(new)),
+		Push:           !reflect.DeepEqual(old.OITC, new.OITC),
+		Packagemanager: !reflect.DeepEqual(old.Packagemanager, new.Packagemanager),
+		Splay:          old.Splay() != new.Splay(),
+	}
+
+	d.CustomChecksAdded, d.CustomChecksRemoved, d.CustomChecksModified = diffCustomChecks(old.CustomCheckConfiguration, new.CustomCheckConfiguration)
+	d.PrometheusExportersAdded, d.PrometheusExportersRemoved, d.PrometheusExportersModified = diffPrometheusExporters(old.PrometheusExporterConfiguration, new.PrometheusExporterConfiguration)
+
+	return d
+}
+
+// KeyChange is a configuration key with a different value in the new configuration
+type KeyChange struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// flattenSettings converts the nested settings of viper to dotted keys (e.g. default.port)
+func flattenSettings(prefix string, settings map[string]interface{}, result map[string]string) {
+	for key, value := range settings {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if sub, ok := value.(map[string]interface{}); ok {
+			flattenSettings(key, sub, result)
+			continue
+		}
+		if slice, ok := value.([]interface{}); ok {
+			parts := make([]string, len(slice))
+			for i := range slice {
+				parts[i] = fmt.Sprint(slice[i])
+			}
+			result[key] = strings.Join(parts, ",")
+			continue
+		}
+		result[key] = fmt.Sprint(value)
+	}
+}
+
+func settingsOf(c *Configuration) map[string]string {
+	result := map[string]string{}
+	if c.viper != nil {
+		flattenSettings("", c.viper.AllSettings(), result)
+	}
+	return result
+}
+
+func redactSetting(key, value string) string {
+	if value != "" && isSecretKey(key) {
+		return RedactedSecret
+	}
+	return value
+}
+
+// ChangedKeys returns all keys of the configuration file (including defaults and environment variables) with
+// a different value in the new configuration sorted by key. The values of secrets are redacted.
+func ChangedKeys(old, new *Configuration) []*KeyChange {
+	oldSettings := settingsOf(old)
+	newSettings := settingsOf(new)
+
+	keys := map[string]bool{}
+	for key := range oldSettings {
+		keys[key] = true
+	}
+	for key := range newSettings {
+		keys[key] = true
+	}
+
+	changes := []*KeyChange{}
+	for key := range keys {
+		if oldSettings[key] != newSettings[key] {
+			changes = append(changes, &KeyChange{
+				Key: key,
+				Old: redactSetting(key, oldSettings[key]),
+				New: redactSetting(key, newSettings[key]),
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newDiffTestConfiguration() *Configuration {
+	c := &Configuration{
+		CheckInterval: 30,
+		Port:          3333,
+		CPU:           true,
+		OITC:          &PushConfiguration{},
+		Prometheus:    &PrometheusConfiguration{},
+		CustomCheckConfiguration: []*CustomCheck{
+			{Name: "check_a", Command: "a", Interval: 60, Timeout: 10},
+			{Name: "check_b", Command: "b", Interval: 60, Timeout: 10},
+			{Name: "check_c", Command: "c", Interval: 60, Timeout: 10},
+		},
+		PrometheusExporterConfiguration: []*PrometheusExporter{
+			{Name: "node", Port: 9100, Path: "/metrics", Interval: 60, Timeout: 10},
+		},
+	}
+	c.Default = c
+	return c
+}
+
+func TestCompareUnchanged(t *testing.T) {
+	d := Compare(newDiffTestConfiguration(), newDiffTestConfiguration())
+
+	if d.Webserver || d.Checks || d.Push || d.Packagemanager {
+		t.Error("unexpected changed component: ", d)
+	}
+	if d.CustomChecksChanged() || d.PrometheusExportersChanged() {
+		t.Error("unexpected changed custom checks or exporters: ", d)
+	}
+}
+
+func TestCompareCustomChecks(t *testing.T) {
+	old := newDiffTestConfiguration()
+	new := newDiffTestConfiguration()
+	new.CustomCheckConfiguration = []*CustomCheck{
+		{Name: "check_a", Command: "a", Interval: 60, Timeout: 10},
+		{Name: "check_b", Command: "b2", Interval: 60, Timeout: 10},
+		{Name: "check_d", Command: "d", Interval: 60, Timeout: 10},
+	}
+
+	d := Compare(old, new)
+	if d.Webserver || d.Checks || d.Push || d.Packagemanager {
+		t.Error("unexpected changed component: ", d)
+	}
+	if !reflect.DeepEqual(d.CustomChecksAdded, []string{"check_d"}) {
+		t.Error("unexpected added custom checks: ", d.CustomChecksAdded)
+	}
+	if !reflect.DeepEqual(d.CustomChecksRemoved, []string{"check_c"}) {
+		t.Error("unexpected removed custom checks: ", d.CustomChecksRemoved)
+	}
+	if !reflect.DeepEqual(d.CustomChecksModified, []string{"check_b"}) {
+		t.Error("unexpected modified custom checks: ", d.CustomChecksModified)
+	}
+	if d.PrometheusExportersChanged() {
+		t.Error("unexpected changed exporters")
+	}
+}
+
+func TestCompareComponents(t *testing.T) {
+	old := newDiffTestConfiguration()
+	new := newDiffTestConfiguration()
+	new.CheckInterval = 15
+
+	d := Compare(old, new)
+	if !d.Checks {
+		t.Error("expected changed checks")
+	}
+	if d.Webserver || d.Push || d.Packagemanager {
+		t.Error("unexpected changed component: ", d)
+	}
+
+	new = newDiffTestConfiguration()
+	new.Port = 3334
+	new.PrometheusExporterConfiguration[0].Timeout = 5
+
+	d = Compare(old, new)
+	if !d.Webserver {
+		t.Error("expected changed webserver")
+	}
+	if d.Checks || d.Push || d.Packagemanager {
+		t.Error("unexpected changed component: ", d)
+	}
+	if !reflect.DeepEqual(d.PrometheusExportersModified, []string{"node"}) {
+		t.Error("unexpected modified exporters: ", d.PrometheusExportersModified)
+	}
+
+	new = newDiffTestConfiguration()
+	new.OITC.Push = true
+
+	d = Compare(old, new)
+	if !d.Push {
+		t.Error("expected changed push client")
+	}
+	if d.Checks || d.Webserver || d.Packagemanager {
+		t.Error("unexpected changed component: ", d)
+	}
+}
+
+func TestCompareCertificateUpdate(t *testing.T) {
+	cfgdir := saveTempConfig(agentConfigWithCheckIntervals, false)
+	defer os.RemoveAll(cfgdir)
+
+	crtFile := filepath.Join(cfgdir, "agent.crt")
+	cfg := "[default]\ntry-autossl = true\nautossl-crt-file = " + crtFile + "\n"
+	if err := os.WriteFile(filepath.Join(cfgdir, "config.ini"), []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := Load(context.Background(), filepath.Join(cfgdir, "config.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the certificate gets created by the certificate update of the webserver
+	if err := os.WriteFile(crtFile, []byte("certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	new, err := Load(context.Background(), filepath.Join(cfgdir, "config.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := Compare(old, new); !d.Webserver || !d.TLS || d.Checks {
+		t.Error("expected changed webserver only: ", d)
+	}
+
+	// a renewed certificate gets reloaded by the webserver itself
+	if err := os.WriteFile(crtFile, []byte("renewed certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := Load(context.Background(), filepath.Join(cfgdir, "config.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Compare(new, renewed); d.Webserver || !d.TLS {
+		t.Error("expected changed tls without webserver restart: ", d)
+	}
+}
+
+func TestChangedKeys(t *testing.T) {
+	cfgdir := saveTempConfig(agentConfigWithCheckIntervals, false)
+	defer os.RemoveAll(cfgdir)
+
+	cfgPath := filepath.Join(cfgdir, "config.ini")
+	if err := os.WriteFile(cfgPath, []byte("[default]\nport = 3333\n\n[oitc]\napikey = old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	old, err := Load(context.Background(), cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(cfgPath, []byte("[default]\nport = 3334\n\n[oitc]\napikey = new\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	new, err := Load(context.Background(), cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*KeyChange{
+		{Key: "default.port", Old: "3333", New: "3334"},
+		{Key: "oitc.apikey", Old: RedactedSecret, New: RedactedSecret},
+	}
+	if changes := ChangedKeys(old, new); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+	if d := Compare(old, new); !d.Webserver || d.TLS {
+		t.Error("expected webserver change without tls change: ", d)
+	}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// TLS policies of a listen spec
+const (
+	// ListenTLSDefault uses the TLS settings of the agent (AutoSSL or certfile), plain HTTP if there is no certificate
+	ListenTLSDefault = "default"
+	// ListenTLSNone always uses plain HTTP
+	ListenTLSNone = "none"
+	// ListenTLSRequired uses the TLS settings of the agent, the listener does not start without a certificate
+	ListenTLSRequired = "required"
+)
+
+// Authentication policies of a listen spec
+const (
+	// ListenAuthDefault uses the basic auth of the agent and requires a client certificate if AutoSSL is used
+	ListenAuthDefault = "default"
+	// ListenAuthNone accepts all requests, only allowed for listeners on the loopback interface
+	ListenAuthNone = "none"
+)
+
+// ListenSpec is an address of the webserver with its own TLS and authentication policy
+type ListenSpec struct {
+	// Address is host:port, the host may be empty to listen on all interfaces
+	Address string
+	// Network is tcp4 for IPv4 and tcp6 for IPv6 addresses, so 0.0.0.0 and [::] can be used side by side
+	// Host names and empty hosts use tcp, which listens on IPv4 and IPv6
+	Network string
+	TLS     string
+	Auth    string
+}
+
+func (l *ListenSpec) String() string {
+	return fmt.Sprintf("%s tls=%s auth=%s", l.Address, l.TLS, l.Auth)
+}
+
+func listenNetwork(host string) string {
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return "tcp"
+	case ip.To4() != nil:
+		return "tcp4"
+	default:
+		return "tcp6"
+	}
+}
+
+// Loopback returns true if the listener only accepts connections of the local host
+func (l *ListenSpec) Loopback() bool {
+	host, _, err := net.SplitHostPort(l.Address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ParseListenSpec parses a listen spec like "127.0.0.1:3333 tls=none auth=none" or "[::]:3333"
+// auth=none is only allowed on loopback addresses
+func ParseListenSpec(spec string) (*ListenSpec, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty listen spec")
+	}
+
+	host, port, err := net.SplitHostPort(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %q (must be address:port): %w", fields[0], err)
+	}
+	if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+		return nil, fmt.Errorf("invalid port in listen address %q", fields[0])
+	}
+	l := &ListenSpec{
+		Address: net.JoinHostPort(host, port),
+		Network: listenNetwork(host),
+		TLS:     ListenTLSDefault,
+		Auth:    ListenAuthDefault,
+	}
+
+	for _, option := range fields[1:] {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "tls":
+			switch value {
+			case ListenTLSDefault, ListenTLSNone, ListenTLSRequired:
+				l.TLS = value
+			default:
+				return nil, fmt.Errorf("invalid tls policy %q for %s (must be one of default, none or required)", value, l.Address)
+			}
+		case "auth":
+			switch value {
+			case ListenAuthDefault, ListenAuthNone:
+				l.Auth = value
+			default:
+				return nil, fmt.Errorf("invalid auth policy %q for %s (must be default or none)", value, l.Address)
+			}
+		default:
+			return nil, fmt.Errorf("unknown listen option %q for %s", option, l.Address)
+		}
+	}
+	if l.Auth == ListenAuthNone && !l.Loopback() {
+		return nil, fmt.Errorf("auth=none is only allowed on loopback addresses (%s)", l.Address)
+	}
+	return l, nil
+}
+
+// ListenSpecs returns all addresses of the webserver
+// Falls back to address and port with the default policies if no listen specs are configured
+// tls=none requires basic auth on addresses which are not loopback, the listener would not have any authentication
+// without the client certificate of AutoSSL
+func (c *Configuration) ListenSpecs() ([]*ListenSpec, error) {
+	if len(c.Listen) == 0 {
+		return []*ListenSpec{{
+			Address: net.JoinHostPort(c.Address, strconv.FormatInt(c.Port, 10)),
+			Network: "tcp",
+			TLS:     ListenTLSDefault,
+			Auth:    ListenAuthDefault,
+		}}, nil
+	}
+
+	specs := make([]*ListenSpec, 0, len(c.Listen))
+	seen := map[string]bool{}
+	for _, s := range c.Listen {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		spec, err := ParseListenSpec(s)
+		if err != nil {
+			return nil, err
+		}
+		if spec.TLS == ListenTLSNone && c.BasicAuth == "" && !spec.Loopback() {
+			return nil, fmt.Errorf("tls=none requires basic auth (auth) on addresses which are not loopback (%s)", spec.Address)
+		}
+		if seen[spec.Address] {
+			return nil, fmt.Errorf("duplicate listen address %s", spec.Address)
+		}
+		seen[spec.Address] = true
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no listen address configured")
+	}
+	return specs, nil
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseListenSpec(t *testing.T) {
+	for spec, expected := range map[string]ListenSpec{
+		"127.0.0.1:3333":                    {Address: "127.0.0.1:3333", Network: "tcp4", TLS: ListenTLSDefault, Auth: ListenAuthDefault},
+		"[::]:3333 tls=required":            {Address: "[::]:3333", Network: "tcp6", TLS: ListenTLSRequired, Auth: ListenAuthDefault},
+		" localhost:80 tls=none auth=none ": {Address: "localhost:80", Network: "tcp", TLS: ListenTLSNone, Auth: ListenAuthNone},
+		":3333":                             {Address: ":3333", Network: "tcp", TLS: ListenTLSDefault, Auth: ListenAuthDefault},
+		"[::1]:3333 auth=none":              {Address: "[::1]:3333", Network: "tcp6", TLS: ListenTLSDefault, Auth: ListenAuthNone},
+	} {
+		res, err := ParseListenSpec(spec)
+		if err != nil {
+			t.Error(spec, ": ", err)
+		} else if *res != expected {
+			t.Errorf("unexpected result for %q: %+v", spec, res)
+		}
+	}
+
+	for _, spec := range []string{"", "127.0.0.1", "127.0.0.1:0", "127.0.0.1:99999", "::1:3333", "127.0.0.1:3333 tls=on", "127.0.0.1:3333 auth=basic", "127.0.0.1:3333 foo",
+		// auth=none is only allowed on loopback addresses
+		"10.0.0.5:3333 auth=none", ":3333 tls=none auth=none", "[::]:3333 auth=none", "example.org:3333 auth=none"} {
+		if _, err := ParseListenSpec(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestListenSpecs(t *testing.T) {
+	cfg := &Configuration{Address: "::", Port: 3333}
+	specs, err := cfg.ListenSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// address and port keep listening on IPv4 and IPv6
+	expected := []*ListenSpec{{Address: "[::]:3333", Network: "tcp", TLS: ListenTLSDefault, Auth: ListenAuthDefault}}
+	if !reflect.DeepEqual(specs, expected) {
+		t.Errorf("unexpected listen specs: %+v", specs[0])
+	}
+
+	cfg.Listen = []string{"0.0.0.0:3333", "[::]:3333"}
+	if specs, err := cfg.ListenSpecs(); err != nil {
+		t.Error(err)
+	} else if len(specs) != 2 || specs[0].Network != "tcp4" || specs[1].Network != "tcp6" {
+		t.Error("unexpected listen specs: ", specs)
+	}
+
+	cfg.Listen = []string{"127.0.0.1:3333", "127.0.0.1:3333 tls=none"}
+	if _, err := cfg.ListenSpecs(); err == nil {
+		t.Error("expected error for duplicate address")
+	}
+
+	// without TLS and basic auth the listener would not have any authentication
+	cfg.Listen = []string{"127.0.0.1:3333 tls=none", "0.0.0.0:3334 tls=none"}
+	if _, err := cfg.ListenSpecs(); err == nil {
+		t.Error("expected error for tls=none without basic auth")
+	}
+	cfg.BasicAuth = "user:password"
+	if _, err := cfg.ListenSpecs(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListenConfigurationWithoutAuthentication(t *testing.T) {
+	for _, listen := range []string{"10.0.0.5:3333 tls=none", "10.0.0.5:3333 auth=none"} {
+		cfgdir := saveTempConfig("[default]\nlisten = "+listen+"\n", false)
+		errs := Validate(filepath.Join(cfgdir, "config.ini"))
+		_ = os.RemoveAll(cfgdir)
+
+		found := false
+		for _, err := range errs {
+			if err.Key == "default.listen" && !err.Warning {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected validation error for %q: %v", listen, errs)
+		}
+	}
+}
+
+func TestListenConfiguration(t *testing.T) {
+	cfgdir := saveTempConfig(`[default]
+listen = 127.0.0.1:3333 tls=none auth=none, 10.0.0.5:3333 tls=required
+`, false)
+	defer os.RemoveAll(cfgdir)
+
+	configPath := filepath.Join(cfgdir, "config.ini")
+	cfg, err := Load(context.Background(), configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs, err := cfg.ListenSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 2 {
+		t.Fatal("expected 2 listen specs, got ", len(specs))
+	}
+	if specs[0].Address != "127.0.0.1:3333" || specs[0].TLS != ListenTLSNone || specs[0].Auth != ListenAuthNone {
+		t.Error("unexpected first listen spec: ", specs[0])
+	}
+	if specs[1].Address != "10.0.0.5:3333" || specs[1].TLS != ListenTLSRequired || specs[1].Auth != ListenAuthDefault {
+		t.Error("unexpected second listen spec: ", specs[1])
+	}
+	if errs := Validate(configPath); len(errs) != 0 {
+		t.Error("unexpected validation errors: ", errs)
+	}
+}
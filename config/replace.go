@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// File is the new content of a configuration file
+type File struct {
+	Path string
+	Data []byte
+}
+
+// Backup of configuration files replaced by ReplaceFiles
+type Backup struct {
+	files []*backupFile
+}
+
+type backupFile struct {
+	path string
+	// existed is false if the file was created by ReplaceFiles
+	existed bool
+}
+
+// BackupPath returns the path of the backup of the given configuration file
+func BackupPath(path string) string {
+	return path + ".bak"
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory and renames it to path
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := writeTempFile(path, data)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeTempFile writes the data to a new temporary file next to path and returns the name of the temporary file
+func writeTempFile(path string, data []byte) (string, error) {
+	fh, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	tmp := fh.Name()
+
+	_, err = fh.Write(data)
+	if err == nil {
+		err = fh.Sync()
+	}
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0600)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// ReplaceFiles replaces all given files. The previous version of each file is kept as backup (see BackupPath).
+// First all new files get written to temporary files, so a full disk does not leave a half written configuration.
+// After that the temporary files get renamed one by one. If this fails, all already replaced files get restored.
+func ReplaceFiles(files []*File) (*Backup, error) {
+	tmpFiles := make([]string, 0, len(files))
+	removeTmpFiles := func() {
+		for _, tmp := range tmpFiles {
+			_ = os.Remove(tmp)
+		}
+	}
+
+	for _, file := range files {
+		tmp, err := writeTempFile(file.Path, file.Data)
+		if err != nil {
+			removeTmpFiles()
+			return nil, fmt.Errorf("could not write %s: %w", file.Path, err)
+		}
+		tmpFiles = append(tmpFiles, tmp)
+	}
+
+	backup := &Backup{}
+	for i, file := range files {
+		b := &backupFile{
+			path: file.Path,
+		}
+
+		data, err := os.ReadFile(file.Path)
+		if err == nil {
+			b.existed = true
+			err = writeFileAtomic(BackupPath(file.Path), data)
+		} else if os.IsNotExist(err) {
+			err = nil
+		}
+
+		if err == nil {
+			err = os.Rename(tmpFiles[i], file.Path)
+		}
+		if err != nil {
+			removeTmpFiles()
+			if restoreErr := backup.Restore(); restoreErr != nil {
+				return nil, fmt.Errorf("could not replace %s: %w (restore failed: %s)", file.Path, err, restoreErr)
+			}
+			return nil, fmt.Errorf("could not replace %s: %w", file.Path, err)
+		}
+		backup.files = append(backup.files, b)
+	}
+
+	return backup, nil
+}
+
+// Restore the files replaced by ReplaceFiles. Files which did not exist before get removed.
+func (b *Backup) Restore() error {
+	var firstErr error
+	for i := len(b.files) - 1; i >= 0; i-- {
+		file := b.files[i]
+
+		var err error
+		if file.existed {
+			var data []byte
+			data, err = os.ReadFile(BackupPath(file.path))
+			if err == nil {
+				err = writeFileAtomic(file.path, data)
+			}
+		} else {
+			err = os.Remove(file.path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("could not restore %s: %w", file.path, err)
+		}
+	}
+	return firstErr
+}
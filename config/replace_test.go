@@ -0,0 +1,94 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplaceFiles(t *testing.T) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgPath := filepath.Join(tmpDir, "config.ini")
+	newPath := filepath.Join(tmpDir, "customchecks.ini")
+	if err := os.WriteFile(cfgPath, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := ReplaceFiles([]*File{
+		{Path: cfgPath, Data: []byte("new")},
+		{Path: newPath, Data: []byte("created")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]string{
+		cfgPath:             "new",
+		BackupPath(cfgPath): "old",
+		newPath:             "created",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("unexpected content of %s: %s", path, string(data))
+		}
+	}
+
+	if err := backup.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "old" {
+		t.Error("unexpected content after restore: ", string(data))
+	}
+	if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+		t.Error("created file was not removed by restore")
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Error("unexpected files left: ", entries)
+	}
+}
+
+func TestReplaceFilesError(t *testing.T) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgPath := filepath.Join(tmpDir, "config.ini")
+	if err := os.WriteFile(cfgPath, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ReplaceFiles([]*File{
+		{Path: cfgPath, Data: []byte("new")},
+		{Path: filepath.Join(tmpDir, "missing", "customchecks.ini"), Data: []byte("new")},
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	data, err := os.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "old" {
+		t.Error("file was replaced: ", string(data))
+	}
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// secretKeys are the configuration keys which must never leave the agent
+var secretKeys = []string{"apikey", "auth", "alfresco-jmxpassword"}
+
+// RedactedSecret replaces the values of secrets in configuration files returned by the webserver
+const RedactedSecret = "********"
+
+// secretLine matches a line of an ini, yaml or toml file assigning a value to a secret key
+var secretLine = regexp.MustCompile(`^(\s*(?:` + strings.Join(quoteAll(secretKeys), "|") + `)\s*[=:]\s*)(.*?)\s*$`)
+
+func quoteAll(s []string) []string {
+	quoted := make([]string, len(s))
+	for i := range s {
+		quoted[i] = regexp.QuoteMeta(s[i])
+	}
+	return quoted
+}
+
+// readSecretFile returns the content of the file without the trailing line break
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// readSecretFiles replaces the secrets by the content of the *_file settings
+func (c *Configuration) readSecretFiles() error {
+	var err error
+	if c.BasicAuthFile != "" {
+		if c.BasicAuth, err = readSecretFile(c.BasicAuthFile); err != nil {
+			return err
+		}
+	}
+	if c.JmxPasswordFile != "" {
+		if c.JmxPassword, err = readSecretFile(c.JmxPasswordFile); err != nil {
+			return err
+		}
+	}
+	if c.OITC != nil && c.OITC.ApikeyFile != "" {
+		if c.OITC.Apikey, err = readSecretFile(c.OITC.ApikeyFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitSecretLine returns the prefix (key and separator) and the value of a line assigning a secret
+func splitSecretLine(line string) (string, string, bool) {
+	m := secretLine.FindStringSubmatch(line)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// isSecretKey returns true if the (dotted) key is a secret
+func isSecretKey(key string) bool {
+	name := key[strings.LastIndex(key, ".")+1:]
+	for _, secret := range secretKeys {
+		if name == secret {
+			return true
+		}
+	}
+	return false
+}
+
+func isRedacted(value string) bool {
+	return strings.Trim(value, `"'`) == RedactedSecret
+}
+
+// multiLineSecret returns true if the value of the secret in lines[i] continues on the following lines
+// (yaml block scalars, lists or mappings, toml multi-line strings and arrays, ini line continuations)
+// Such values can not be redacted line by line
+func multiLineSecret(lines []string, i int, value string) bool {
+	if value == "" {
+		// a yaml list or mapping may follow
+		indent := len(lines[i]) - len(strings.TrimLeft(lines[i], " \t"))
+		for _, next := range lines[i+1:] {
+			trimmed := strings.TrimSpace(next)
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			return len(next)-len(strings.TrimLeft(next, " \t")) > indent || strings.HasPrefix(trimmed, "- ") || trimmed == "-"
+		}
+		return false
+	}
+
+	switch value[0] {
+	case '|', '>':
+		return true
+	case '"', '\'':
+		quote := value[:1]
+		if strings.HasPrefix(value, strings.Repeat(quote, 3)) {
+			return !strings.Contains(value[3:], strings.Repeat(quote, 3))
+		}
+		return !strings.Contains(value[1:], quote)
+	case '[', '{':
+		closing := "]"
+		if value[0] == '{' {
+			closing = "}"
+		}
+		return !strings.Contains(value, closing)
+	}
+	return strings.HasSuffix(value, "\\")
+}
+
+// RedactSecrets replaces the values of all secrets (api key, basic auth, jmx password) of the configuration file
+// The result can be passed to RestoreSecrets to get the original secrets back
+// Returns an error if a secret spans multiple lines, because it could not be redacted completely
+func RedactSecrets(data []byte) ([]byte, error) {
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		prefix, value, ok := splitSecretLine(line)
+		if !ok {
+			continue
+		}
+		if multiLineSecret(lines, i, value) {
+			return nil, fmt.Errorf("the value of %s spans multiple lines and can not be redacted", secretKey(prefix))
+		}
+		if value != "" {
+			lines[i] = prefix + `"` + RedactedSecret + `"`
+		}
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// RestoreSecrets replaces all redacted secrets of data with the secrets of the current configuration file
+// Redacted secrets which do not exist in the current file get removed
+// Returns an error if a redacted secret spans multiple lines in the current file
+func RestoreSecrets(data, current []byte) ([]byte, error) {
+	if !bytes.Contains(data, []byte(RedactedSecret)) {
+		return data, nil
+	}
+
+	values := map[string]string{}
+	multiLine := map[string]bool{}
+	currentLines := strings.Split(string(current), "\n")
+	for i, line := range currentLines {
+		if prefix, value, ok := splitSecretLine(line); ok {
+			values[secretKey(prefix)] = value
+			multiLine[secretKey(prefix)] = multiLineSecret(currentLines, i, value)
+		}
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if prefix, value, ok := splitSecretLine(line); ok && isRedacted(value) {
+			key := secretKey(prefix)
+			currentValue, exists := values[key]
+			if !exists {
+				continue
+			}
+			if multiLine[key] {
+				return nil, fmt.Errorf("the current value of %s spans multiple lines and can not be restored", key)
+			}
+			line = prefix + currentValue
+		}
+		lines = append(lines, line)
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// secretKey returns the key name of the prefix of a secret line
+func secretKey(prefix string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(prefix), "=:"))
+}
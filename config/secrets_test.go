@@ -0,0 +1,131 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var agentConfigWithSecrets string = `[default]
+port = 3333
+auth = user:secret
+#auth = commented:secret
+auth_file =
+
+[oitc]
+apikey = abc123
+authfile = /etc/openitcockpit-agent/auth.json
+`
+
+func TestRedactSecrets(t *testing.T) {
+	data, err := RedactSecrets([]byte(agentConfigWithSecrets))
+	if err != nil {
+		t.Fatal(err)
+	}
+	redacted := string(data)
+	if strings.Contains(redacted, "user:secret") || strings.Contains(redacted, "abc123") {
+		t.Error("secrets not redacted:\n", redacted)
+	}
+	if !strings.Contains(redacted, "#auth = commented:secret") || !strings.Contains(redacted, "authfile = /etc/openitcockpit-agent/auth.json") {
+		t.Error("unexpected redaction:\n", redacted)
+	}
+
+	pushed := strings.Replace(redacted, "port = 3333", "port = 3334", 1)
+	if restored, err := RestoreSecrets([]byte(pushed), []byte(agentConfigWithSecrets)); err != nil {
+		t.Error(err)
+	} else if string(restored) != strings.Replace(agentConfigWithSecrets, "port = 3333", "port = 3334", 1) {
+		t.Error("unexpected restored configuration:\n", string(restored))
+	}
+
+	yaml := "oitc:\n  apikey: abc123\n"
+	data, err = RedactSecrets([]byte(yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "oitc:\n  apikey: \"********\"\n" {
+		t.Error("unexpected yaml redaction:\n", string(data))
+	}
+	if restored, err := RestoreSecrets(data, []byte(yaml)); err != nil || string(restored) != yaml {
+		t.Error("unexpected restored yaml: ", err, "\n", string(restored))
+	}
+}
+
+func TestRedactMultiLineSecrets(t *testing.T) {
+	for format, data := range map[string]string{
+		"yaml block scalar":     "default:\n  auth: |\n    user:secret\n  port: 3333\n",
+		"yaml folded scalar":    "default:\n  auth: >-\n    user:secret\n",
+		"yaml list":             "default:\n  auth:\n    - user:secret\n  port: 3333\n",
+		"yaml unindented list":  "auth:\n- user:secret\nport: 3333\n",
+		"yaml quoted string":    "default:\n  auth: \"user:\n    secret\"\n",
+		"toml multi-line":       "[default]\nauth = \"\"\"\nuser:secret\n\"\"\"\nport = 3333\n",
+		"toml multi-line raw":   "[default]\nauth = '''user:\nsecret'''\n",
+		"toml multi-line array": "[oitc]\napikey = [\n  \"abc123\",\n]\n",
+		"ini continuation":      "[default]\nauth = user:\\\nsecret\n",
+	} {
+		if redacted, err := RedactSecrets([]byte(data)); err == nil {
+			t.Errorf("%s: expected error, got:\n%s", format, redacted)
+		}
+
+		// the redacted secret of a pushed configuration can not be replaced by the multi-line value
+		if restored, err := RestoreSecrets([]byte("[default]\nauth = \"********\"\n[oitc]\napikey = \"********\"\n"), []byte(data)); err == nil {
+			t.Errorf("%s: expected restore error, got:\n%s", format, restored)
+		}
+	}
+
+	for format, data := range map[string]string{
+		"yaml empty":        "default:\n  auth:\n  port: 3333\n",
+		"toml single line":  "[default]\nauth = \"\"\"user:secret\"\"\"\n",
+		"yaml quoted":       "default:\n  auth: 'user:secret' # comment\n",
+		"ini empty section": "[default]\nauth =\n\n[oitc]\napikey = abc123\n",
+	} {
+		redacted, err := RedactSecrets([]byte(data))
+		if err != nil {
+			t.Errorf("%s: %s", format, err)
+		} else if strings.Contains(string(redacted), "secret") || strings.Contains(string(redacted), "abc123") {
+			t.Errorf("%s: secrets not redacted:\n%s", format, redacted)
+		}
+	}
+}
+
+func TestReadConfigEnvironmentAndSecretFiles(t *testing.T) {
+	cfgdir := saveTempConfig(agentConfigWithSecrets, false)
+	defer os.RemoveAll(cfgdir)
+
+	apikeyFile := filepath.Join(cfgdir, "apikey")
+	if err := os.WriteFile(apikeyFile, []byte("fromfile\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("OITC_AGENT_DEFAULT_PORT", "4444")
+	t.Setenv("OITC_AGENT_DEFAULT_AUTH", "env:secret")
+	t.Setenv("OITC_AGENT_DEFAULT_ALFRESCO_JMXPASSWORD", "jmx")
+	t.Setenv("OITC_AGENT_OITC_APIKEY_FILE", apikeyFile)
+	t.Setenv("OITC_AGENT_INTERVALS_SYSTEM_LOAD", "5")
+
+	c, err := Load(context.Background(), filepath.Join(cfgdir, "config.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != 4444 {
+		t.Error("unexpected port: ", c.Port)
+	}
+	if c.BasicAuth != "env:secret" {
+		t.Error("unexpected auth: ", c.BasicAuth)
+	}
+	if c.JmxPassword != "jmx" {
+		t.Error("unexpected jmx password: ", c.JmxPassword)
+	}
+	if c.OITC.Apikey != "fromfile" {
+		t.Error("unexpected api key: ", c.OITC.Apikey)
+	}
+	if c.IntervalForCheck("system_load") != 5 {
+		t.Error("unexpected system_load interval: ", c.IntervalForCheck("system_load"))
+	}
+
+	t.Setenv("OITC_AGENT_OITC_APIKEY_FILE", filepath.Join(cfgdir, "missing"))
+	if _, err := Load(context.Background(), filepath.Join(cfgdir, "config.ini")); err == nil {
+		t.Error("expected error for missing secret file")
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// SocketFileMode returns the file mode of the unix domain socket of the webserver
+func (c *Configuration) SocketFileMode() (fs.FileMode, error) {
+	if c.SocketMode == "" {
+		return 0660, nil
+	}
+	mode, err := strconv.ParseUint(c.SocketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid socket mode %q (must be an octal number like 0660)", c.SocketMode)
+	}
+	return fs.FileMode(mode), nil
+}
+
+// SocketOwnerIDs returns the user and group id of the socket owner, -1 keeps the user or group of the agent process
+func (c *Configuration) SocketOwnerIDs() (int, int, error) {
+	if c.SocketOwner == "" {
+		return -1, -1, nil
+	}
+	if runtime.GOOS == "windows" {
+		return -1, -1, errors.New("socket owner is not supported on Windows, use the permissions of the socket folder instead")
+	}
+
+	username, group, _ := strings.Cut(c.SocketOwner, ":")
+	uid, err := lookupID(username, func(name string) (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	})
+	if err != nil {
+		return -1, -1, fmt.Errorf("invalid socket owner: %w", err)
+	}
+	gid, err := lookupID(group, func(name string) (string, error) {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err
+		}
+		return g.Gid, nil
+	})
+	if err != nil {
+		return -1, -1, fmt.Errorf("invalid socket group: %w", err)
+	}
+	return uid, gid, nil
+}
+
+// lookupID returns the numeric id of the user or group name, or -1 if the name is empty
+func lookupID(name string, lookup func(name string) (string, error)) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(id)
+}
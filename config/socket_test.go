@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os/user"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestSocketFileMode(t *testing.T) {
+	for mode, expected := range map[string]uint32{
+		"":     0660,
+		"0600": 0600,
+		"660":  0660,
+	} {
+		cfg := &Configuration{SocketMode: mode}
+		res, err := cfg.SocketFileMode()
+		if err != nil {
+			t.Error(mode, ": ", err)
+		} else if uint32(res) != expected {
+			t.Errorf("unexpected mode for %q: %o", mode, res)
+		}
+	}
+
+	for _, mode := range []string{"0999", "rw-rw----", "01777"} {
+		cfg := &Configuration{SocketMode: mode}
+		if _, err := cfg.SocketFileMode(); err == nil {
+			t.Errorf("expected error for %q", mode)
+		}
+	}
+}
+
+func TestSocketOwnerIDs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket owner is not supported on windows")
+	}
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	uid, _ := strconv.Atoi(current.Uid)
+	gid, _ := strconv.Atoi(current.Gid)
+
+	for owner, expected := range map[string][2]int{
+		"":                     {-1, -1},
+		current.Username:       {uid, -1},
+		"1234:5678":            {1234, 5678},
+		":" + current.Gid:      {-1, gid},
+		current.Username + ":": {uid, -1},
+	} {
+		cfg := &Configuration{SocketOwner: owner}
+		u, g, err := cfg.SocketOwnerIDs()
+		if err != nil {
+			t.Error(owner, ": ", err)
+		} else if u != expected[0] || g != expected[1] {
+			t.Errorf("unexpected ids for %q: %d:%d", owner, u, g)
+		}
+	}
+
+	cfg := &Configuration{SocketOwner: "user-does-not-exist-test"}
+	if _, _, err := cfg.SocketOwnerIDs(); err == nil {
+		t.Error("expected error for unknown user")
+	}
+}
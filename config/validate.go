@@ -0,0 +1,402 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/schedule"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
+)
+
+// ValidationError is a single problem found in a configuration file
+type ValidationError struct {
+	File    string
+	Key     string
+	Message string
+	// Warning is set for problems the agent can start with (e.g. unknown keys)
+	Warning bool
+}
+
+func (e *ValidationError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.File, e.Key, e.Message)
+}
+
+// HasErrors returns true if any of the problems is not only a warning
+func HasErrors(errs []*ValidationError) bool {
+	for _, err := range errs {
+		if !err.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+type validator struct {
+	errors []*ValidationError
+	// invalid contains all keys which could not be decoded
+	invalid map[string]bool
+}
+
+// keyName converts the field names of mapstructure (e.g. "[check_x].timeout" or "Default.port") to config keys
+func keyName(name string) string {
+	return strings.ToLower(strings.NewReplacer("[", "", "]", "").Replace(name))
+}
+
+func (v *validator) add(file, key, format string, args ...interface{}) {
+	v.errors = append(v.errors, &ValidationError{
+		File:    file,
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) warn(file, key, format string, args ...interface{}) {
+	v.add(file, key, format, args...)
+	v.errors[len(v.errors)-1].Warning = true
+}
+
+// decodeErrors returns the single errors of a (joined) mapstructure error
+func decodeErrors(err error) []error {
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, decodeErrors(e)...)
+	}
+	return errs
+}
+
+// deleteKey removes the given dotted key from the nested settings map
+func deleteKey(settings map[string]interface{}, key string) bool {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		sub, ok := settings[part].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		settings = sub
+	}
+	if _, ok := settings[parts[len(parts)-1]]; !ok {
+		return false
+	}
+	delete(settings, parts[len(parts)-1])
+	return true
+}
+
+// decode reads the given file without any defaults and reports unknown keys and type errors
+// Returns false if the file could not be read at all
+func (v *validator) decode(path string, result interface{}) bool {
+	vp := newViper(path)
+	if err := vp.ReadInConfig(); err != nil {
+		v.add(path, "", "could not read file: %s", err)
+		return false
+	}
+
+	// mapstructure does not report unused keys of a struct if one of its fields could not be decoded,
+	// so we remove all invalid keys and decode again until no errors are left
+	settings := vp.AllSettings()
+	for {
+		md := &mapstructure.Metadata{}
+		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			// same settings as viper.Unmarshal
+			DecodeHook: mapstructure.ComposeDecodeHookFunc(
+				mapstructure.StringToTimeDurationHookFunc(),
+				mapstructure.StringToSliceHookFunc(","),
+			),
+			Metadata:         md,
+			Result:           result,
+			WeaklyTypedInput: true,
+		})
+		if err != nil {
+			v.add(path, "", "%s", err)
+			return false
+		}
+
+		err = decoder.Decode(settings)
+		if err == nil {
+			sort.Strings(md.Unused)
+			for _, key := range md.Unused {
+				v.warn(path, keyName(key), "unknown key")
+			}
+			return true
+		}
+
+		removed := false
+		for _, e := range decodeErrors(err) {
+			var decodeErr *mapstructure.DecodeError
+			if errors.As(e, &decodeErr) {
+				key := keyName(decodeErr.Name())
+				v.invalid[key] = true
+				v.add(path, key, "%s", decodeErr.Unwrap())
+				if deleteKey(settings, key) {
+					removed = true
+				}
+			} else {
+				v.add(path, "", "%s", e)
+			}
+		}
+		if !removed {
+			return true
+		}
+	}
+}
+
+func (v *validator) validateConfiguration(path string) *Configuration {
+	raw := &Configuration{}
+	raw.Default = raw
+	if !v.decode(path, raw) {
+		return nil
+	}
+
+	// Decode again with all defaults, so we check the values the agent would actually use
+	vp := newViper(path)
+	setConfigurationDefaults(vp)
+	bindEnvironment(vp)
+	if err := vp.ReadInConfig(); err != nil {
+		return nil
+	}
+	cfg := &Configuration{}
+	cfg.Default = cfg
+	cfg.OITC = &PushConfiguration{}
+	// Type errors are already reported, all other values got decoded anyway
+	_ = vp.Unmarshal(cfg)
+	if err := cfg.readSecretFiles(); err != nil {
+		v.add(path, "", "%s", err)
+	}
+
+	switch cfg.TlsSecurityLevel {
+	case "", "lax", "intermediate", "modern":
+	default:
+		v.add(path, "default.tls-security-level", "invalid value %q (must be one of lax, intermediate or modern)", cfg.TlsSecurityLevel)
+	}
+
+	if cfg.BasicAuth != "" {
+		if _, err := ParseBasicAuth(cfg.BasicAuth); err != nil {
+			v.add(path, "default.auth", "%s", err)
+		}
+	}
+
+	if cfg.Socket != "" {
+		if _, err := cfg.SocketFileMode(); err != nil {
+			v.add(path, "default.socket-mode", "%s", err)
+		}
+		if _, _, err := cfg.SocketOwnerIDs(); err != nil {
+			v.add(path, "default.socket-owner", "%s", err)
+		}
+	}
+
+	if len(cfg.Listen) > 0 {
+		if _, err := cfg.ListenSpecs(); err != nil {
+			v.add(path, "default.listen", "%s", err)
+		}
+	} else if !v.invalid["default.port"] && (cfg.Port <= 0 || cfg.Port > 65535) {
+		v.add(path, "default.port", "invalid port %d", cfg.Port)
+	}
+
+	if (cfg.CertificateFile == "") != (cfg.KeyFile == "") {
+		v.add(path, "default.certfile", "certfile and keyfile have to be set together")
+	}
+	if cfg.CertificateFile != "" {
+		v.checkReadable(path, "default.certfile", cfg.CertificateFile)
+	}
+	if cfg.KeyFile != "" {
+		v.checkReadable(path, "default.keyfile", cfg.KeyFile)
+	}
+	if cfg.AutoSslEnabled {
+		// AutoSSL certificates get created by the agent, so they only have to be readable if they exist
+		for _, key := range []string{"autossl-crt-file", "autossl-key-file", "autossl-ca-file"} {
+			if file := vp.GetString("default." + key); utils.FileExists(file) {
+				v.checkReadable(path, "default."+key, file)
+			}
+		}
+		if cfg.AutoSslRenewDays < 0 {
+			v.add(path, "default.autossl-renew-days", "invalid value %d (must be 0 to disable the renewal or greater)", cfg.AutoSslRenewDays)
+		}
+	}
+
+	for name, interval := range cfg.CheckIntervals {
+		if interval <= 0 {
+			v.add(path, "intervals."+name, "interval has to be greater than 0")
+		}
+	}
+	for name, timeout := range cfg.CheckTimeouts {
+		if timeout <= 0 {
+			v.add(path, "timeouts."+name, "timeout has to be greater than 0")
+		} else if timeout > cfg.IntervalForCheck(name) {
+			v.add(path, "timeouts."+name, "timeout %d is larger than the interval %d", timeout, cfg.IntervalForCheck(name))
+		}
+	}
+
+	return cfg
+}
+
+func (v *validator) checkReadable(path, key, file string) {
+	fh, err := os.Open(file)
+	if err != nil {
+		v.add(path, key, "file is not readable: %s", err)
+		return
+	}
+	_ = fh.Close()
+}
+
+func (v *validator) validateCustomChecks(path string) []string {
+	checks := map[string]*CustomCheck{}
+	if !v.decode(path, &checks) {
+		return nil
+	}
+
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		if name != "default" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		check := checks[name]
+		if check == nil {
+			continue
+		}
+		if strings.TrimSpace(check.Command) == "" {
+			v.add(path, name+".command", "missing command")
+		}
+		if check.Schedule != "" {
+			if _, err := schedule.ParseCron(check.Schedule); err != nil {
+				v.add(path, name+".schedule", "%s", err)
+			}
+		}
+		if check.ActiveWindow != "" {
+			if _, err := schedule.ParseWindow(check.ActiveWindow); err != nil {
+				v.add(path, name+".active_window", "%s", err)
+			}
+		}
+
+		// same defaults as unmarshalCustomChecks
+		interval := check.Interval
+		if interval <= 0 {
+			interval = 60
+		}
+		timeout := check.Timeout
+		if timeout <= 0 {
+			timeout = 15
+		}
+		if check.Schedule == "" && timeout > interval {
+			v.add(path, name+".timeout", "timeout %d is larger than the interval %d", timeout, interval)
+		}
+	}
+	return names
+}
+
+func (v *validator) validatePrometheusExporters(path string) []string {
+	exporters := map[string]*PrometheusExporter{}
+	if !v.decode(path, &exporters) {
+		return nil
+	}
+
+	names := make([]string, 0, len(exporters))
+	for name := range exporters {
+		if name != "default" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		exporter := exporters[name]
+		if exporter == nil {
+			continue
+		}
+		if strings.TrimSpace(exporter.Path) == "" {
+			v.add(path, name+".path", "missing path")
+		}
+		switch exporter.Method {
+		case "", "http", "https":
+		default:
+			v.add(path, name+".method", "invalid value %q (must be http or https)", exporter.Method)
+		}
+		if exporter.Port <= 0 || exporter.Port > 65535 {
+			v.add(path, name+".port", "invalid port %d", exporter.Port)
+		}
+	}
+	return names
+}
+
+// validateFiles validates the single file and all files of the drop-in directory and reports
+// names which are defined in more than one file
+func (v *validator) validateFiles(configPath, file, dir, dirKey, kind string, validate func(path string) []string) {
+	files := []string{}
+	if file != "" && utils.FileExists(file) {
+		files = append(files, file)
+	}
+	if dir != "" {
+		dirFiles, err := dropInFiles(dir)
+		if err != nil {
+			v.add(configPath, dirKey, "could not read directory: %s", err)
+		}
+		files = append(files, dirFiles...)
+	}
+
+	definedIn := map[string]string{}
+	for _, f := range files {
+		for _, name := range validate(f) {
+			if first, ok := definedIn[name]; ok {
+				v.add(f, name, "duplicate %s (already defined in %s)", kind, first)
+				continue
+			}
+			definedIn[name] = f
+		}
+	}
+}
+
+// Validate checks the configuration file and the referenced custom check and Prometheus exporter files
+// for unknown keys, type errors and invalid values. Returns all problems found, or nil if there are none.
+func Validate(configPath string) []*ValidationError {
+	v := &validator{
+		invalid: map[string]bool{},
+	}
+
+	cfg := v.validateConfiguration(configPath)
+	if cfg == nil {
+		return v.errors
+	}
+
+	v.validateFiles(configPath, cfg.CustomchecksFilePath, cfg.CustomchecksDir, "default.customchecks-dir", "custom check", v.validateCustomChecks)
+
+	if cfg.Prometheus != nil && cfg.Prometheus.Enable {
+		if cfg.Prometheus.ExportersFilePath != "" && !utils.FileExists(cfg.Prometheus.ExportersFilePath) {
+			v.warn(configPath, "prometheus.exporters", "file %s does not exist", cfg.Prometheus.ExportersFilePath)
+		}
+		v.validateFiles(configPath, cfg.Prometheus.ExportersFilePath, cfg.PrometheusExportersDir, "default.prometheus-exporters-dir", "prometheus exporter", v.validatePrometheusExporters)
+	}
+
+	return v.errors
+}
+
+// ValidateFiles checks a configuration, custom check and Prometheus exporter file like Validate, but the
+// custom check and exporter files are given explicitly instead of the files referenced by the configuration.
+// Empty paths get skipped.
+func ValidateFiles(configPath, customChecksPath, exportersPath string) []*ValidationError {
+	v := &validator{
+		invalid: map[string]bool{},
+	}
+
+	v.validateConfiguration(configPath)
+	if customChecksPath != "" {
+		v.validateCustomChecks(customChecksPath)
+	}
+	if exportersPath != "" {
+		v.validatePrometheusExporters(exportersPath)
+	}
+
+	return v.errors
+}
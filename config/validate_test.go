@@ -0,0 +1,82 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ccPath := filepath.Join(tmpDir, "customchecks.ini")
+	cfgPath := filepath.Join(tmpDir, "config.ini")
+
+	if err := os.WriteFile(ccPath, []byte(`[check_ok]
+command = /bin/true
+interval = 60
+timeout = 10
+enabled = true
+
+[check_slow]
+command = /bin/true
+interval = 10
+timeout = 30
+commandline = foo
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(cfgPath, []byte(`[default]
+port = abc
+cpustat = true
+auth = nocolon
+tls-security-level = paranoid
+certfile = `+filepath.Join(tmpDir, "missing.crt")+`
+keyfile = `+filepath.Join(tmpDir, "missing.key")+`
+customchecks = `+ccPath+`
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := Validate(cfgPath)
+	expected := []string{
+		"default.port",
+		"default.cpustat: unknown key",
+		"default.auth: invalid value",
+		"default.tls-security-level: invalid value",
+		"default.certfile: file is not readable",
+		"default.keyfile: file is not readable",
+		"check_slow.commandline: unknown key",
+		"check_slow.timeout: timeout 30 is larger than the interval 10",
+	}
+
+	report := []string{}
+	for _, err := range errs {
+		report = append(report, err.Error())
+	}
+	all := strings.Join(report, "\n")
+
+	for _, e := range expected {
+		if !strings.Contains(all, e) {
+			t.Error("expected validation error: ", e, "\ngot:\n", all)
+		}
+	}
+	if strings.Contains(all, "check_ok") {
+		t.Error("unexpected validation error for check_ok:\n", all)
+	}
+}
+
+func TestValidateValid(t *testing.T) {
+	cfgdir := saveTempConfig(agentConfigWithCheckIntervals, false)
+	defer os.RemoveAll(cfgdir)
+
+	if errs := Validate(filepath.Join(cfgdir, "config.ini")); len(errs) != 0 {
+		t.Error("unexpected validation errors: ", errs)
+	}
+}
@@ -31,6 +31,7 @@ type LogHandler struct {
 
 	wg       sync.WaitGroup
 	logFile  *os.File
+	reopen   chan chan struct{}
 	shutdown chan struct{}
 }
 
@@ -100,6 +101,20 @@ func (h *LogHandler) doRotate() {
 	}
 }
 
+// doReopen rotates the log file if logrotate is enabled, otherwise the log file just gets reopened
+// (e.g. after it was moved by an external logrotate)
+func (h *LogHandler) doReopen() {
+	if h.LogPath == "" {
+		return
+	}
+	if h.LogRotate > 0 {
+		h.doRotate()
+		return
+	}
+	h.closeLogFile()
+	h.openLogFile()
+}
+
 // this is a var for testing
 var midnight = func() time.Duration {
 	now := time.Now()
@@ -109,6 +124,7 @@ var midnight = func() time.Duration {
 // Start the log handling (should NOT be run in a go routine). Reload must be called at least once
 func (h *LogHandler) Start(parent context.Context) {
 	h.shutdown = make(chan struct{})
+	h.reopen = make(chan chan struct{})
 
 	if h.DefaultWriter == nil && !h.DisableDefaultWriter {
 		log.Fatalln("internal error: require default log writer")
@@ -171,11 +187,21 @@ func (h *LogHandler) Start(parent context.Context) {
 				h.doRotate()
 				t.Stop()
 				t = time.NewTimer(midnight())
+			case done := <-h.reopen:
+				h.doReopen()
+				done <- struct{}{}
 			}
 		}
 	}()
 }
 
+// Reopen rotates and reopens the log file, waits for completion
+func (h *LogHandler) Reopen() {
+	done := make(chan struct{})
+	h.reopen <- done
+	<-done
+}
+
 // Shutdown all files
 func (h *LogHandler) Shutdown() {
 	close(h.shutdown)
@@ -178,3 +178,41 @@ func TestLogHandlerCancel(t *testing.T) {
 		t.Fatal("timeout for cancel loghandler")
 	}
 }
+
+func TestLogHandlerReopen(t *testing.T) {
+	tempDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stderr := bytes.Buffer{}
+
+	logPath := filepath.Join(tempDir, "agent.log")
+	lh := &LogHandler{
+		LogPath:       logPath,
+		Debug:         true,
+		Verbose:       true,
+		LogRotate:     0,
+		DefaultWriter: &stderr,
+	}
+	midnight = func() time.Duration {
+		return time.Hour
+	}
+	lh.Start(ctx)
+	defer lh.Shutdown()
+
+	// simulate an external logrotate
+	if err := os.Rename(logPath, logPath+".old"); err != nil {
+		t.Fatal(err)
+	}
+
+	lh.Reopen()
+
+	if _, err := os.Stat(logPath); err != nil {
+		t.Fatal("log file was not reopened: ", err)
+	}
+}
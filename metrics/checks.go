@@ -0,0 +1,379 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The following types mirror the json of the check results (see package checks)
+// Only the fields which get exported as metric are listed
+
+type cpuResult struct {
+	PercentageTotal   float64   `json:"cpu_total_percentage"`
+	PercentagePerCore []float64 `json:"cpu_percentage"`
+}
+
+type memoryResult struct {
+	Total     uint64  `json:"total"`
+	Available uint64  `json:"available"`
+	Percent   float64 `json:"percent"`
+	Used      uint64  `json:"used"`
+	Free      uint64  `json:"free"`
+}
+
+type swapResult struct {
+	Total   uint64  `json:"total"`
+	Percent float64 `json:"percent"`
+	Used    uint64  `json:"used"`
+	Free    uint64  `json:"free"`
+	Sin     uint64  `json:"sin"`
+	Sout    uint64  `json:"sout"`
+}
+
+type diskResult struct {
+	Disk struct {
+		Device     string `json:"device"`
+		Mountpoint string `json:"mountpoint"`
+		Fstype     string `json:"fstype"`
+	} `json:"disk"`
+	Usage struct {
+		Total   uint64  `json:"total"`
+		Used    uint64  `json:"used"`
+		Free    uint64  `json:"free"`
+		Percent float64 `json:"percent"`
+	} `json:"usage"`
+}
+
+type diskIoResult struct {
+	ReadBytes           uint64
+	WriteBytes          uint64
+	ReadCount           uint64
+	WriteCount          uint64
+	IoTime              uint64
+	ReadIopsPerSecond   uint64
+	WriteIopsPerSecond  uint64
+	ReadBytesPerSecond  uint64
+	WriteBytesPerSecond uint64
+	LoadPercent         float64
+}
+
+type netIoResult struct {
+	BytesSent                 uint64 `json:"bytes_sent"`
+	BytesReceived             uint64 `json:"bytes_recv"`
+	PacketsSent               uint64 `json:"packets_sent"`
+	PacketsReceived           uint64 `json:"packets_recv"`
+	ErrorIn                   uint64 `json:"errin"`
+	ErrorOut                  uint64 `json:"errout"`
+	DropIn                    uint64 `json:"dropin"`
+	DropOut                   uint64 `json:"dropout"`
+	AvgBytesSentPerSecond     uint64 `json:"avg_bytes_sent_ps"`
+	AvgBytesReceivedPerSecond uint64 `json:"avg_bytes_recv_ps"`
+}
+
+type loadResult struct {
+	Load1  float64 `json:"0"`
+	Load5  float64 `json:"1"`
+	Load15 float64 `json:"2"`
+}
+
+type sensorResult struct {
+	Temperatures []*struct {
+		Label    string  `json:"label"`
+		Current  float64 `json:"current"`
+		High     float64 `json:"high"`
+		Critical float64 `json:"critical"`
+	}
+	Batteries []*struct {
+		ID           int     `json:"id"`
+		Percent      float64 `json:"percent"`
+		Secsleft     float64 `json:"secsleft"`
+		PowerPlugged bool    `json:"power_plugged"`
+	}
+}
+
+type dockerResult struct {
+	Id               string  `json:"id"`
+	Name             string  `json:"name"`
+	Image            string  `json:"image"`
+	SizeRw           int64   `json:"size_rw"`
+	SizeRootFs       int64   `json:"size_root_fs"`
+	State            string  `json:"state"`
+	NetworkRx        float64 `json:"network_rx"`
+	NetworkTx        float64 `json:"network_tx"`
+	CpuPercentage    float64 `json:"cpu_percentage"`
+	MemoryPercentage float64 `json:"memory_percentage"`
+	DiskRead         uint64  `json:"disk_read"`
+	DiskWrite        uint64  `json:"disk_write"`
+	MemoryUsed       float64 `json:"memory_used"`
+}
+
+type systemdResult struct {
+	ActiveState string
+	LoadState   string
+	Name        string
+	SubState    string
+}
+
+type ntpResult struct {
+	SyncStatus bool
+	Offset     float64
+}
+
+type customCheckResult struct {
+	RC                        int   `json:"rc"`
+	ExecutionUnixTimestampSec int64 `json:"execution_unix_timestamp_sec"`
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r *registry) addCpu(cpu *cpuResult) {
+	const help = "CPU usage in percent"
+	r.gauge("cpu_usage_percent", help, cpu.PercentageTotal, "cpu", "total")
+	for i, percent := range cpu.PercentagePerCore {
+		r.gauge("cpu_usage_percent", help, percent, "cpu", strconv.Itoa(i))
+	}
+}
+
+func (r *registry) addMemory(mem *memoryResult) {
+	r.gauge("memory_total_bytes", "Total amount of memory in bytes", float64(mem.Total))
+	r.gauge("memory_available_bytes", "Available memory in bytes", float64(mem.Available))
+	r.gauge("memory_used_bytes", "Used memory in bytes", float64(mem.Used))
+	r.gauge("memory_free_bytes", "Free memory in bytes", float64(mem.Free))
+	r.gauge("memory_usage_percent", "Used memory in percent", mem.Percent)
+}
+
+func (r *registry) addSwap(swap *swapResult) {
+	r.gauge("swap_total_bytes", "Total amount of swap space in bytes", float64(swap.Total))
+	r.gauge("swap_used_bytes", "Used swap space in bytes", float64(swap.Used))
+	r.gauge("swap_free_bytes", "Free swap space in bytes", float64(swap.Free))
+	r.gauge("swap_usage_percent", "Used swap space in percent", swap.Percent)
+	r.counter("swap_in_bytes", "Bytes swapped in from disk (Linux only)", float64(swap.Sin))
+	r.counter("swap_out_bytes", "Bytes swapped out to disk (Linux only)", float64(swap.Sout))
+}
+
+func (r *registry) addDisks(disks []*diskResult) {
+	for _, disk := range disks {
+		if disk == nil {
+			continue
+		}
+		labels := []string{"device", disk.Disk.Device, "mountpoint", disk.Disk.Mountpoint, "fstype", disk.Disk.Fstype}
+		r.gauge("disk_total_bytes", "Total disk space in bytes", float64(disk.Usage.Total), labels...)
+		r.gauge("disk_used_bytes", "Used disk space in bytes", float64(disk.Usage.Used), labels...)
+		r.gauge("disk_free_bytes", "Free disk space in bytes", float64(disk.Usage.Free), labels...)
+		r.gauge("disk_usage_percent", "Used disk space in percent", disk.Usage.Percent, labels...)
+	}
+}
+
+func (r *registry) addDiskIo(diskIo map[string]*diskIoResult) {
+	for _, device := range sortedKeys(diskIo) {
+		stats := diskIo[device]
+		if stats == nil {
+			continue
+		}
+		r.counter("disk_read_bytes", "Bytes read from disk", float64(stats.ReadBytes), "device", device)
+		r.counter("disk_written_bytes", "Bytes written to disk", float64(stats.WriteBytes), "device", device)
+		r.counter("disk_reads", "Read operations", float64(stats.ReadCount), "device", device)
+		r.counter("disk_writes", "Write operations", float64(stats.WriteCount), "device", device)
+		r.counter("disk_io_time_seconds", "Time spent doing I/O operations in seconds", float64(stats.IoTime)/1000, "device", device)
+		r.gauge("disk_read_bytes_per_second", "Bytes read from disk per second", float64(stats.ReadBytesPerSecond), "device", device)
+		r.gauge("disk_written_bytes_per_second", "Bytes written to disk per second", float64(stats.WriteBytesPerSecond), "device", device)
+		r.gauge("disk_reads_per_second", "Read operations per second", float64(stats.ReadIopsPerSecond), "device", device)
+		r.gauge("disk_writes_per_second", "Write operations per second", float64(stats.WriteIopsPerSecond), "device", device)
+		r.gauge("disk_load_percent", "Disk load in percent", stats.LoadPercent, "device", device)
+	}
+}
+
+func (r *registry) addNetIo(netIo map[string]*netIoResult) {
+	for _, iface := range sortedKeys(netIo) {
+		stats := netIo[iface]
+		if stats == nil {
+			continue
+		}
+		r.counter("network_received_bytes", "Bytes received", float64(stats.BytesReceived), "interface", iface)
+		r.counter("network_sent_bytes", "Bytes sent", float64(stats.BytesSent), "interface", iface)
+		r.counter("network_received_packets", "Packets received", float64(stats.PacketsReceived), "interface", iface)
+		r.counter("network_sent_packets", "Packets sent", float64(stats.PacketsSent), "interface", iface)
+		r.counter("network_receive_errors", "Errors while receiving", float64(stats.ErrorIn), "interface", iface)
+		r.counter("network_send_errors", "Errors while sending", float64(stats.ErrorOut), "interface", iface)
+		r.counter("network_receive_drops", "Dropped incoming packets", float64(stats.DropIn), "interface", iface)
+		r.counter("network_send_drops", "Dropped outgoing packets", float64(stats.DropOut), "interface", iface)
+		r.gauge("network_received_bytes_per_second", "Average bytes received per second", float64(stats.AvgBytesReceivedPerSecond), "interface", iface)
+		r.gauge("network_sent_bytes_per_second", "Average bytes sent per second", float64(stats.AvgBytesSentPerSecond), "interface", iface)
+	}
+}
+
+func (r *registry) addLoad(load *loadResult) {
+	r.gauge("load1", "System load average of the last minute", load.Load1)
+	r.gauge("load5", "System load average of the last 5 minutes", load.Load5)
+	r.gauge("load15", "System load average of the last 15 minutes", load.Load15)
+}
+
+func (r *registry) addSensors(sensors *sensorResult) {
+	for _, t := range sensors.Temperatures {
+		if t == nil {
+			continue
+		}
+		r.gauge("temperature_celsius", "Current temperature in degrees Celsius", t.Current, "sensor", t.Label)
+		r.gauge("temperature_high_celsius", "High temperature threshold in degrees Celsius", t.High, "sensor", t.Label)
+		r.gauge("temperature_critical_celsius", "Critical temperature threshold in degrees Celsius", t.Critical, "sensor", t.Label)
+	}
+	for _, b := range sensors.Batteries {
+		if b == nil {
+			continue
+		}
+		id := strconv.Itoa(b.ID)
+		r.gauge("battery_percent", "Battery charge in percent", b.Percent, "battery", id)
+		r.gauge("battery_seconds_left", "Estimated battery runtime in seconds", b.Secsleft, "battery", id)
+		r.gauge("battery_power_plugged", "1 if the power cable is connected", boolValue(b.PowerPlugged), "battery", id)
+	}
+}
+
+func (r *registry) addDocker(containers []*dockerResult) {
+	for _, c := range containers {
+		if c == nil {
+			continue
+		}
+		labels := []string{"id", c.Id, "name", c.Name, "image", c.Image}
+		r.gauge("docker_container_running", "1 if the container is running", boolValue(c.State == "running"), append(labels, "state", c.State)...)
+		r.gauge("docker_container_cpu_usage_percent", "CPU usage of the container in percent", c.CpuPercentage, labels...)
+		r.gauge("docker_container_memory_usage_percent", "Memory usage of the container in percent", c.MemoryPercentage, labels...)
+		r.gauge("docker_container_memory_used_bytes", "Used memory of the container in bytes", c.MemoryUsed, labels...)
+		r.counter("docker_container_network_received_bytes", "Bytes received by the container", c.NetworkRx, labels...)
+		r.counter("docker_container_network_sent_bytes", "Bytes sent by the container", c.NetworkTx, labels...)
+		r.counter("docker_container_disk_read_bytes", "Bytes read by the container (Linux and macOS only)", float64(c.DiskRead), labels...)
+		r.counter("docker_container_disk_written_bytes", "Bytes written by the container (Linux and macOS only)", float64(c.DiskWrite), labels...)
+		r.gauge("docker_container_size_rw_bytes", "Size of the files created or modified by the container in bytes", float64(c.SizeRw), labels...)
+		r.gauge("docker_container_size_root_fs_bytes", "Total size of the file system of the container in bytes", float64(c.SizeRootFs), labels...)
+	}
+}
+
+func (r *registry) addSystemd(units []*systemdResult) {
+	for _, u := range units {
+		if u == nil {
+			continue
+		}
+		r.gauge("systemd_unit_active", "1 if the systemd unit is active", boolValue(u.ActiveState == "active"),
+			"name", u.Name, "active_state", u.ActiveState, "sub_state", u.SubState, "load_state", u.LoadState)
+	}
+}
+
+func (r *registry) addNtp(ntp *ntpResult) {
+	r.gauge("ntp_offset_seconds", "Time offset between the system clock and the NTP server in seconds", ntp.Offset)
+	r.gauge("ntp_synchronized", "1 if the system clock is synchronized with an NTP server", boolValue(ntp.SyncStatus))
+}
+
+func (r *registry) addCustomChecks(customChecks map[string]*customCheckResult) {
+	for _, name := range sortedKeys(customChecks) {
+		cc := customChecks[name]
+		if cc == nil {
+			continue
+		}
+		r.gauge("customcheck_status", "Return code of the custom check (0 ok, 1 warning, 2 critical, 3 unknown)", float64(cc.RC), "check", name)
+		r.gauge("customcheck_last_execution_timestamp_seconds", "Unix timestamp of the last execution of the custom check", float64(cc.ExecutionUnixTimestampSec), "check", name)
+	}
+}
+
+// isErrorResult returns true if the raw check result is an error like {"error":"timeout"}
+// Only a string value counts, so a disk or custom check named error is not mistaken for an error result
+func isErrorResult(raw json.RawMessage) bool {
+	res := struct {
+		Error *string `json:"error"`
+	}{}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return false
+	}
+	return res.Error != nil
+}
+
+// decodeCheck decodes the result of a single check, returns false if the check has no (valid) result
+// Error results are left out, they would decode into zero values
+func decodeCheck(results map[string]json.RawMessage, name string, v interface{}) bool {
+	raw, ok := results[name]
+	if !ok {
+		return false
+	}
+	if isErrorResult(raw) {
+		log.Debugln("Metrics: check ", name, " returned an error")
+		return false
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		log.Debugln("Metrics: could not parse result of check ", name, ": ", err)
+		return false
+	}
+	return true
+}
+
+// Write renders the check result json of the agent in the OpenMetrics text format
+// Checks without a result (disabled or not executed yet) are left out
+func Write(w io.Writer, state []byte) error {
+	results := map[string]json.RawMessage{}
+	if len(state) > 0 {
+		if err := json.Unmarshal(state, &results); err != nil {
+			return fmt.Errorf("could not parse check result: %w", err)
+		}
+	}
+
+	r := newRegistry()
+	cpu := &cpuResult{}
+	if decodeCheck(results, "cpu", cpu) {
+		r.addCpu(cpu)
+	}
+	memory := &memoryResult{}
+	if decodeCheck(results, "memory", memory) {
+		r.addMemory(memory)
+	}
+	swap := &swapResult{}
+	if decodeCheck(results, "swap", swap) {
+		r.addSwap(swap)
+	}
+	disks := []*diskResult{}
+	if decodeCheck(results, "disks", &disks) {
+		r.addDisks(disks)
+	}
+	diskIo := map[string]*diskIoResult{}
+	if decodeCheck(results, "disk_io", &diskIo) {
+		r.addDiskIo(diskIo)
+	}
+	netIo := map[string]*netIoResult{}
+	if decodeCheck(results, "net_io", &netIo) {
+		r.addNetIo(netIo)
+	}
+	load := &loadResult{}
+	if decodeCheck(results, "system_load", load) {
+		r.addLoad(load)
+	}
+	sensors := &sensorResult{}
+	if decodeCheck(results, "sensors", sensors) {
+		r.addSensors(sensors)
+	}
+	docker := []*dockerResult{}
+	if decodeCheck(results, "docker", &docker) {
+		r.addDocker(docker)
+	}
+	systemd := []*systemdResult{}
+	if decodeCheck(results, "systemd_services", &systemd) {
+		r.addSystemd(systemd)
+	}
+	ntp := &ntpResult{}
+	if decodeCheck(results, "ntp", ntp) {
+		r.addNtp(ntp)
+	}
+	customChecks := map[string]*customCheckResult{}
+	if decodeCheck(results, "customchecks", &customChecks) {
+		r.addCustomChecks(customChecks)
+	}
+
+	return r.write(w)
+}
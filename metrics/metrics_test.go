@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testCheckResult = `{
+	"cpu": {"cpu_total_percentage": 12.5, "cpu_percentage": [10, 15]},
+	"memory": {"total": 1024, "available": 512, "percent": 50, "used": 512, "free": 256},
+	"disks": [{"disk": {"device": "/dev/sda1", "mountpoint": "/", "fstype": "ext4"}, "usage": {"total": 100, "used": 25, "free": 75, "percent": 25}}],
+	"disk_io": {"sda": {"ReadBytes": 2048, "IoTime": 1500, "LoadPercent": 3}},
+	"net_io": {"eth0": {"bytes_recv": 4096, "avg_bytes_recv_ps": 10}},
+	"system_load": {"0": 0.5, "1": 0.25, "2": 0.125},
+	"sensors": {"Temperatures": [{"label": "core \"0\"", "current": 42}], "Batteries": []},
+	"docker": [{"id": "abc", "name": "web", "image": "nginx", "state": "running", "cpu_percentage": 1.5}],
+	"systemd_services": [{"Name": "sshd.service", "ActiveState": "active", "SubState": "running", "LoadState": "loaded"}],
+	"ntp": {"SyncStatus": true, "Offset": -0.002},
+	"customchecks": {"check_users": {"stdout": "OK", "rc": 1, "execution_unix_timestamp_sec": 1700000000}},
+	"swap": "invalid",
+	"prometheus_exporters": []
+}`
+
+func TestWrite(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := Write(buf, []byte(testCheckResult)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, expected := range []string{
+		"# TYPE oitc_agent_cpu_usage_percent gauge\n",
+		`oitc_agent_cpu_usage_percent{cpu="total"} 12.5` + "\n",
+		`oitc_agent_cpu_usage_percent{cpu="1"} 15` + "\n",
+		"oitc_agent_memory_total_bytes 1024\n",
+		`oitc_agent_disk_usage_percent{device="/dev/sda1",mountpoint="/",fstype="ext4"} 25` + "\n",
+		"# TYPE oitc_agent_disk_read_bytes counter\n",
+		`oitc_agent_disk_read_bytes_total{device="sda"} 2048` + "\n",
+		`oitc_agent_disk_io_time_seconds_total{device="sda"} 1.5` + "\n",
+		`oitc_agent_network_received_bytes_total{interface="eth0"} 4096` + "\n",
+		"oitc_agent_load15 0.125\n",
+		`oitc_agent_temperature_celsius{sensor="core \"0\""} 42` + "\n",
+		`oitc_agent_docker_container_running{id="abc",name="web",image="nginx",state="running"} 1` + "\n",
+		`oitc_agent_systemd_unit_active{name="sshd.service",active_state="active",sub_state="running",load_state="loaded"} 1` + "\n",
+		"oitc_agent_ntp_offset_seconds -0.002\n",
+		"oitc_agent_ntp_synchronized 1\n",
+		`oitc_agent_customcheck_status{check="check_users"} 1` + "\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("missing %q in:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "oitc_agent_swap") {
+		t.Error("invalid swap result should be skipped")
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Error("missing # EOF")
+	}
+
+	// all samples of a family have to be written together below a single TYPE line
+	seen := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		name := strings.Fields(line)[2]
+		if seen[name] {
+			t.Error("family is written more than once: ", name)
+		}
+		seen[name] = true
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := Write(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "# EOF\n" {
+		t.Error("unexpected output: ", buf.String())
+	}
+
+	if err := Write(buf, []byte("no json")); err == nil {
+		t.Error("expected error for invalid json")
+	}
+}
+
+func TestWriteErrorResults(t *testing.T) {
+	for _, section := range []string{"cpu", "memory", "swap", "system_load", "sensors", "ntp"} {
+		for _, result := range []string{`{"error": "timeout"}`, `{"error": "previous execution still running"}`} {
+			buf := &bytes.Buffer{}
+			if err := Write(buf, []byte(`{"`+section+`": `+result+`}`)); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != "# EOF\n" {
+				t.Errorf("unexpected samples for error result of %s:\n%s", section, buf.String())
+			}
+		}
+	}
+
+	// a custom check named error is not an error result
+	buf := &bytes.Buffer{}
+	if err := Write(buf, []byte(`{"customchecks": {"error": {"stdout": "OK", "rc": 0}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `oitc_agent_customcheck_status{check="error"} 0`) {
+		t.Error("missing custom check:\n", buf.String())
+	}
+}
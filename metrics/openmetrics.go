@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType of the OpenMetrics text format
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Prefix of all metric names
+const Prefix = "oitc_agent_"
+
+const (
+	typeGauge   = "gauge"
+	typeCounter = "counter"
+)
+
+type sample struct {
+	// labels are pairs of label name and value
+	labels []string
+	value  float64
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	samples []*sample
+}
+
+// registry collects the samples of all metric families, so the samples of a family are written together
+type registry struct {
+	families []*family
+	byName   map[string]*family
+}
+
+func newRegistry() *registry {
+	return &registry{
+		byName: map[string]*family{},
+	}
+}
+
+func (r *registry) add(typ, name, help string, value float64, labels ...string) {
+	name = Prefix + name
+	f, ok := r.byName[name]
+	if !ok {
+		f = &family{
+			name: name,
+			help: help,
+			typ:  typ,
+		}
+		r.byName[name] = f
+		r.families = append(r.families, f)
+	}
+	f.samples = append(f.samples, &sample{
+		labels: labels,
+		value:  value,
+	})
+}
+
+// gauge adds a sample to the gauge with the given name, labels are pairs of label name and value
+func (r *registry) gauge(name, help string, value float64, labels ...string) {
+	r.add(typeGauge, name, help, value, labels...)
+}
+
+// counter adds a sample to the counter with the given name (without the _total suffix)
+func (r *registry) counter(name, help string, value float64, labels ...string) {
+	r.add(typeCounter, name, help, value, labels...)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// write all metric families in the OpenMetrics text format
+func (r *registry) write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range r.families {
+		bw.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+		bw.WriteString("# HELP " + f.name + " " + helpEscaper.Replace(f.help) + "\n")
+
+		name := f.name
+		if f.typ == typeCounter {
+			name += "_total"
+		}
+		for _, s := range f.samples {
+			bw.WriteString(name)
+			if len(s.labels) > 0 {
+				bw.WriteByte('{')
+				for i := 0; i+1 < len(s.labels); i += 2 {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(s.labels[i] + `="` + labelValueEscaper.Replace(s.labels[i+1]) + `"`)
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteString(" " + formatValue(s.value) + "\n")
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
@@ -70,6 +70,9 @@ func (s *SoftwareCollector) Start(parentCtx context.Context) error {
 	// convert check interval from minutes (config) to seconds
 	checkInterval := s.Configuration.Packagemanager.CheckInterval * 60
 
+	// Spread the collection (and the metadata refresh of the package manager) of all agents of a fleet
+	splay := config.SplayForInterval(s.Configuration.Splay(), time.Duration(checkInterval)*time.Second)
+
 	// Start a first run delayed after startup
 	s.wg.Add(1)
 	go func() {
@@ -80,7 +83,7 @@ func (s *SoftwareCollector) Start(parentCtx context.Context) error {
 		// after the agent is running for 90 seconds.
 		// this ensures that the agent is running long enough (certificate exchange etc)
 		// to not do the heavy collection work too early.
-		firstRunDelay := 90 * time.Second
+		firstRunDelay := 90*time.Second + splay
 		firstRunTrigger := time.NewTimer(firstRunDelay)
 		checkTimeout := time.Duration(checkInterval-1) * time.Second
 		defer firstRunTrigger.Stop()
@@ -102,9 +105,6 @@ func (s *SoftwareCollector) Start(parentCtx context.Context) error {
 	go func() {
 		defer s.wg.Done()
 
-		ticker := time.NewTicker(time.Duration(checkInterval) * time.Second)
-		defer ticker.Stop()
-
 		// Tell the webserver that we have pending data collection
 		select {
 		case s.Result <- &PackageInfo{
@@ -117,6 +117,19 @@ func (s *SoftwareCollector) Start(parentCtx context.Context) error {
 			log.Warnln("Packagemanager: Unable to send pending status, channel not ready")
 		}
 
+		if splay > 0 {
+			t := time.NewTimer(splay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+		}
+
+		ticker := time.NewTicker(time.Duration(checkInterval) * time.Second)
+		defer ticker.Stop()
+
 		for {
 			select {
 			case <-ctx.Done():
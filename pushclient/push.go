@@ -21,6 +21,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/packagemanager"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/telemetry"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
 	log "github.com/sirupsen/logrus"
 )
@@ -68,6 +69,8 @@ type authConfiguration struct {
 type PushClient struct {
 	StateInput               chan []byte
 	StateInputPackageManager chan packagemanager.PackageInfo
+	// Telemetry stores the statistics of the push requests (optional)
+	Telemetry *telemetry.Registry
 
 	shutdown             chan struct{}
 	wg                   sync.WaitGroup
@@ -77,6 +80,8 @@ type PushClient struct {
 	urlSubmitCheckData   *url.URL
 	urlRegisterAgent     *url.URL
 	urlSubmitPackageInfo *url.URL
+	urlSubmitCsr         *url.URL
+	csrInput             chan *csrRequest
 	apiKeyHeader         string
 	timeout              time.Duration
 }
@@ -110,6 +115,32 @@ type submitPackageInfoRequest struct {
 	Error   string `json:"error"`
 }
 
+type submitCsrRequest struct {
+	Csr       string `json:"csr"`
+	AgentUUID string `json:"agentuuid"`
+	Password  string `json:"password"`
+}
+
+// CertificateResponse contains the certificate signed by openITCOCKPIT
+// Signed is empty if the server did not sign the csr yet
+type CertificateResponse struct {
+	Signed string `json:"signed"`
+	CA     string `json:"ca"`
+	Error  string `json:"error"`
+}
+
+// csrRequest is passed to the push client routine, so the request uses the current auth configuration
+type csrRequest struct {
+	ctx  context.Context
+	csr  []byte
+	done chan *csrResult
+}
+
+type csrResult struct {
+	response *CertificateResponse
+	err      error
+}
+
 func (p *PushClient) saveAuthConfig() error {
 	data, err := json.Marshal(&p.authConfiguration)
 	if err != nil {
@@ -173,13 +204,13 @@ func (p *PushClient) httpRequest(ctx context.Context, url *url.URL, sendJson int
 	return res.StatusCode, nil
 }
 
-func (p *PushClient) registerClient(ctx context.Context, state []byte) {
+func (p *PushClient) registerClient(ctx context.Context, state []byte) error {
 	log.Infoln("Push Client: register client at server")
 
 	log.Debugln("Push Client: test for write permissions on auth configuration")
 	if err := p.saveAuthConfig(); err != nil {
 		log.Errorln("Push Client: unable to write client auth configuration: ", err)
-		return
+		return err
 	}
 
 	hostname, ipaddress := fetchSystemInformation()
@@ -195,45 +226,45 @@ func (p *PushClient) registerClient(ctx context.Context, state []byte) {
 	status, err := p.httpRequest(ctx, p.urlRegisterAgent, &req, &res)
 	if err != nil {
 		log.Errorln("Push Client: ", err)
-		return
+		return err
 	}
 	switch status {
 	case 405:
 		log.Errorln("Push Client: authentication error (probably incorrect api key)")
-		return
+		return errors.New("authentication error")
 	case 403:
 		log.Errorln("Push Client: this agent was already registered with a different password, you have to delete it in openITCOCKPIT and re-register it")
-		return
+		return errors.New("agent already registered with a different password")
 	case 201:
 		if res.AgentUUID != p.authConfiguration.UUID {
 			log.Errorln("Push Client: unexpected agentuuid in server response during registration: ", res.AgentUUID)
-			return
+			return errors.New("unexpected agentuuid in server response")
 		}
 		if res.Password == "" {
 			log.Infoln("Push Client: Waiting for registration on the server")
-			return
+			return nil
 		}
 		p.authConfiguration.Password = res.Password
 		if err := p.saveAuthConfig(); err != nil {
 			log.Errorln("Push Client: unable to write client auth configuration: ", err)
 			p.authConfiguration.Password = ""
-			return
+			return err
 		}
 		log.Infoln("Push Client: server registration successful")
-		p.submitCheckData(ctx, state)
-		return
+		return p.submitCheckData(ctx, state)
 	case 200:
 		if res.AgentUUID != p.authConfiguration.UUID || res.Password != p.authConfiguration.Password {
 			log.Errorln("Push Client: server returned unexpected uuid or password for this agent: ", res.AgentUUID, ":", res.Password)
-			return
+			return errors.New("unexpected uuid or password in server response")
 		}
+		return nil
 	default:
 		if res.Error != "" {
 			log.Errorln("Push Client: could not register client: ", res.Error)
 		} else {
 			log.Errorln("Push Client: unknown error during client registration, http status: ", status)
 		}
-		return
+		return fmt.Errorf("could not register client, http status: %d", status)
 	}
 }
 
@@ -241,7 +272,7 @@ func (p *PushClient) registerClient(ctx context.Context, state []byte) {
 // due to submitCheckData get's triggered when new check results are available
 // custom checks get merged into the "normal" checl results so custom checks do not trigger this function.
 // Only the check interval of the inbuild will trigger this.
-func (p *PushClient) submitCheckData(ctx context.Context, state []byte) {
+func (p *PushClient) submitCheckData(ctx context.Context, state []byte) error {
 	log.Infoln("Push Client: send new state to server")
 
 	if len(state) < 1 {
@@ -260,33 +291,33 @@ func (p *PushClient) submitCheckData(ctx context.Context, state []byte) {
 	status, err := p.httpRequest(ctx, p.urlSubmitCheckData, &req, &res)
 	if err != nil {
 		log.Errorln("Push client: ", err)
-		return
+		return err
 	}
 
 	switch status {
 	case 405:
 		log.Errorln("Push Client: authentication error (probably incorrect api key)")
-		return
+		return errors.New("authentication error")
 	case 200:
 		log.Debugln("Push Client: submitted ", res.ReceivedChecks, " checks")
-		return
+		return nil
 	default:
 		if res.Error != "" {
 			log.Errorln("Push Client: could not send state to server: ", res.Error)
 		} else {
 			log.Errorln("Push Client: unknown error during submit checkdata, http status: ", status)
 		}
-		return
+		return fmt.Errorf("could not send check data to server, http status: %d", status)
 	}
 }
 
-func (p *PushClient) submitSoftwareInventoryData(ctx context.Context, pkgInfo packagemanager.PackageInfo) {
+func (p *PushClient) submitSoftwareInventoryData(ctx context.Context, pkgInfo packagemanager.PackageInfo) error {
 	log.Infoln("Push Client: send new state to server")
 
 	data, err := json.Marshal(&pkgInfo)
 	if err != nil {
 		log.Errorln("Push Client: Could not create json for package manager status: ", err)
-		return
+		return err
 	}
 
 	req := submitCheckDataRequest{
@@ -299,23 +330,83 @@ func (p *PushClient) submitSoftwareInventoryData(ctx context.Context, pkgInfo pa
 	status, err := p.httpRequest(ctx, p.urlSubmitPackageInfo, &req, &res)
 	if err != nil {
 		log.Errorln("Push client: ", err)
-		return
+		return err
 	}
 
 	switch status {
 	case 405:
 		log.Errorln("Push Client: authentication error (probably incorrect api key)")
-		return
+		return errors.New("authentication error")
 	case 200:
 		log.Debugln("Push Client: submitted software inventory data successfully")
-		return
+		return nil
 	default:
 		if res.Error != "" {
 			log.Errorln("Push Client: could not send state to server: ", res.Error)
 		} else {
 			log.Errorln("Push Client: unknown error during submit packagemanager, http status: ", status)
 		}
-		return
+		return fmt.Errorf("could not send software inventory data to server, http status: %d", status)
+	}
+}
+
+func (p *PushClient) submitCsr(ctx context.Context, csr []byte) (*CertificateResponse, error) {
+	log.Infoln("Push Client: send csr to server")
+
+	if p.authConfiguration.Password == "" {
+		return nil, errors.New("agent is not registered at the server yet")
+	}
+
+	req := submitCsrRequest{
+		Csr:       string(csr),
+		AgentUUID: p.authConfiguration.UUID,
+		Password:  p.authConfiguration.Password,
+	}
+	res := &CertificateResponse{}
+
+	status, err := p.httpRequest(ctx, p.urlSubmitCsr, &req, res)
+	if err != nil {
+		log.Errorln("Push client: ", err)
+		return nil, err
+	}
+
+	switch status {
+	case 405:
+		log.Errorln("Push Client: authentication error (probably incorrect api key)")
+		return nil, errors.New("authentication error")
+	case 200:
+		log.Debugln("Push Client: submitted csr successfully")
+		return res, nil
+	default:
+		if res.Error != "" {
+			log.Errorln("Push Client: could not send csr to server: ", res.Error)
+		} else {
+			log.Errorln("Push Client: unknown error during submit csr, http status: ", status)
+		}
+		return nil, fmt.Errorf("could not send csr to server, http status: %d", status)
+	}
+}
+
+// SubmitCsr sends the csr to openITCOCKPIT to renew the AutoSSL certificate (only used with autossl-push-renewal)
+func (p *PushClient) SubmitCsr(ctx context.Context, csr []byte) (*CertificateResponse, error) {
+	req := &csrRequest{
+		ctx:  ctx,
+		csr:  csr,
+		done: make(chan *csrResult, 1),
+	}
+	select {
+	case p.csrInput <- req:
+	case <-p.shutdown:
+		return nil, errors.New("push client is shutting down")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case res := <-req.done:
+		return res.response, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
@@ -325,11 +416,14 @@ func (p *PushClient) updateState(parent context.Context, state []byte) {
 	ctx, cancel := context.WithTimeout(parent, p.timeout)
 	defer cancel()
 
+	start := time.Now()
+	var err error
 	if p.authConfiguration.Password != "" {
-		p.submitCheckData(ctx, state)
+		err = p.submitCheckData(ctx, state)
 	} else {
-		p.registerClient(ctx, state)
+		err = p.registerClient(ctx, state)
 	}
+	p.Telemetry.Record(telemetry.Push, "checkdata", time.Since(start), err)
 }
 
 func (p *PushClient) pushPackageInfo(parent context.Context, newState packagemanager.PackageInfo) {
@@ -359,7 +453,9 @@ func (p *PushClient) pushPackageInfo(parent context.Context, newState packageman
 	defer cancel()
 
 	if p.authConfiguration.Password != "" {
-		p.submitSoftwareInventoryData(ctx, packageManagerState)
+		start := time.Now()
+		err := p.submitSoftwareInventoryData(ctx, packageManagerState)
+		p.Telemetry.Record(telemetry.Push, "packages", time.Since(start), err)
 	}
 }
 
@@ -373,6 +469,7 @@ func (p *PushClient) Shutdown() {
 func (p *PushClient) Start(ctx context.Context, cfg *config.Configuration) error {
 	log.Debugln("Push Client: Starting")
 	p.shutdown = make(chan struct{})
+	p.csrInput = make(chan *csrRequest)
 	p.configuration = *cfg.OITC
 
 	if err := p.readAuthConfig(); err != nil {
@@ -404,6 +501,12 @@ func (p *PushClient) Start(ctx context.Context, cfg *config.Configuration) error
 	}
 	p.urlSubmitPackageInfo.Path = path.Join(p.urlSubmitPackageInfo.Path, "agentconnector", "submit_package_info.json")
 
+	p.urlSubmitCsr, err = url.Parse(p.configuration.URL)
+	if err != nil {
+		return err
+	}
+	p.urlSubmitCsr.Path = path.Join(p.urlSubmitCsr.Path, "agentconnector", "submit_csr.json")
+
 	p.apiKeyHeader = fmt.Sprint("X-OITC-API ", p.configuration.Apikey)
 
 	if p.configuration.Proxy != "" {
@@ -455,6 +558,16 @@ func (p *PushClient) Start(ctx context.Context, cfg *config.Configuration) error
 				if newPackages.Enabled && !newPackages.Pending {
 					p.pushPackageInfo(ctx, newPackages)
 				}
+
+			case req := <-p.csrInput:
+				// the csr of the AutoSSL certificate renewal
+				res := &csrResult{}
+				start := time.Now()
+				reqCtx, cancel := context.WithTimeout(req.ctx, p.timeout)
+				res.response, res.err = p.submitCsr(reqCtx, req.csr)
+				cancel()
+				p.Telemetry.Record(telemetry.Push, "csr", time.Since(start), res.err)
+				req.done <- res
 			}
 		}
 	}()
@@ -0,0 +1,298 @@
+// Package schedule implements cron expressions and recurring time windows
+// which are used to schedule custom checks at certain times
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdayNames = map[string]int{
+	"sun": 0,
+	"mon": 1,
+	"tue": 2,
+	"wed": 3,
+	"thu": 4,
+	"fri": 5,
+	"sat": 6,
+}
+
+var monthNames = map[string]int{
+	"jan": 1,
+	"feb": 2,
+	"mar": 3,
+	"apr": 4,
+	"may": 5,
+	"jun": 6,
+	"jul": 7,
+	"aug": 8,
+	"sep": 9,
+	"oct": 10,
+	"nov": 11,
+	"dec": 12,
+}
+
+var cronShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxNextSearch limits the search for the next execution of expressions which never match (e.g. 30th of february)
+const maxNextSearch = 5 * 366 * 24 * time.Hour
+
+// bounds of a single cron field
+type bounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteBounds  = bounds{0, 59, nil}
+	hourBounds    = bounds{0, 23, nil}
+	domBounds     = bounds{1, 31, nil}
+	monthBounds   = bounds{1, 12, monthNames}
+	weekdayBounds = bounds{0, 7, weekdayNames} // 0 and 7 are sunday
+)
+
+func (b bounds) value(s string) (int, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s'", s)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", v, b.min, b.max)
+	}
+	return v, nil
+}
+
+// parseField parses a single cron field like "*", "*/15", "1,15", "mon-fri" or "8-18/2" into a bit set
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step '%s'", stepPart)
+			}
+		}
+
+		start, end := b.min, b.max
+		if rangePart != "*" {
+			startPart, endPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = b.value(startPart); err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				if end, err = b.value(endPart); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				end = b.max
+			}
+			if end < start {
+				return 0, fmt.Errorf("invalid range '%s'", rangePart)
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+// Cron is a parsed cron expression with the fields minute, hour, day of month, month and day of week
+type Cron struct {
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	weekday uint64
+
+	// if both day fields are restricted, a day matches if one of them matches (like cron does)
+	domRestricted     bool
+	weekdayRestricted bool
+}
+
+// ParseCron parses a cron expression like "15 2 * * *" (02:15 daily) or "*/5 8-18 * * mon-fri"
+// The shortcuts @hourly, @daily, @weekly, @monthly and @yearly are supported as well
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if shortcut, ok := cronShortcuts[strings.ToLower(expr)]; ok {
+		expr = shortcut
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression '%s' must have 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+
+	c := &Cron{
+		domRestricted:     fields[2] != "*",
+		weekdayRestricted: fields[4] != "*",
+	}
+	var err error
+	if c.minute, err = parseField(fields[0], minuteBounds); err != nil {
+		return nil, fmt.Errorf("cron expression '%s': minute: %s", expr, err)
+	}
+	if c.hour, err = parseField(fields[1], hourBounds); err != nil {
+		return nil, fmt.Errorf("cron expression '%s': hour: %s", expr, err)
+	}
+	if c.dom, err = parseField(fields[2], domBounds); err != nil {
+		return nil, fmt.Errorf("cron expression '%s': day of month: %s", expr, err)
+	}
+	if c.month, err = parseField(fields[3], monthBounds); err != nil {
+		return nil, fmt.Errorf("cron expression '%s': month: %s", expr, err)
+	}
+	if c.weekday, err = parseField(fields[4], weekdayBounds); err != nil {
+		return nil, fmt.Errorf("cron expression '%s': day of week: %s", expr, err)
+	}
+	// 7 is an alias for sunday
+	if c.weekday&(1<<7) != 0 {
+		c.weekday |= 1
+	}
+
+	return c, nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	weekdayMatch := c.weekday&(1<<uint(t.Weekday())) != 0
+	if c.domRestricted && c.weekdayRestricted {
+		return domMatch || weekdayMatch
+	}
+	return domMatch && weekdayMatch
+}
+
+// Next returns the first time after t which matches the cron expression
+// Returns the zero time if the expression never matches
+func (c *Cron) Next(t time.Time) time.Time {
+	limit := t.Add(maxNextSearch)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// Window is a recurring time window like "Mon-Fri 08:00-18:00"
+type Window struct {
+	weekdays uint64
+	// start and end in minutes since midnight, the window wraps around midnight if end <= start
+	start int
+	end   int
+}
+
+func parseTimeOfDay(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time '%s' (expected HH:MM)", s)
+	}
+	hour, err := strconv.Atoi(h)
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, fmt.Errorf("invalid time '%s' (expected HH:MM)", s)
+	}
+	minute, err := strconv.Atoi(m)
+	if err != nil || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time '%s' (expected HH:MM)", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// ParseWindow parses a time window like "Mon-Fri 08:00-18:00", "Sat,Sun" or "22:00-06:00"
+// Without weekdays the window is active every day, without a time range the whole day
+func ParseWindow(s string) (*Window, error) {
+	w := &Window{
+		weekdays: 0x7f,
+		start:    0,
+		end:      24 * 60,
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid window '%s' (expected e.g. Mon-Fri 08:00-18:00)", s)
+	}
+
+	for _, field := range fields {
+		if strings.Contains(field, ":") {
+			startPart, endPart, ok := strings.Cut(field, "-")
+			if !ok {
+				return nil, fmt.Errorf("window '%s': invalid time range '%s'", s, field)
+			}
+			var err error
+			if w.start, err = parseTimeOfDay(startPart); err != nil {
+				return nil, fmt.Errorf("window '%s': %s", s, err)
+			}
+			if w.end, err = parseTimeOfDay(endPart); err != nil {
+				return nil, fmt.Errorf("window '%s': %s", s, err)
+			}
+			if w.start == w.end {
+				return nil, fmt.Errorf("window '%s': start and end must not be equal", s)
+			}
+			continue
+		}
+
+		weekdays, err := parseField(field, weekdayBounds)
+		if err != nil {
+			return nil, fmt.Errorf("window '%s': weekdays: %s", s, err)
+		}
+		if weekdays&(1<<7) != 0 {
+			weekdays |= 1
+		}
+		w.weekdays = weekdays & 0x7f
+	}
+
+	return w, nil
+}
+
+func (w *Window) weekdayMatches(t time.Time) bool {
+	return w.weekdays&(1<<uint(t.Weekday())) != 0
+}
+
+// Contains returns true if t is inside of the window
+func (w *Window) Contains(t time.Time) bool {
+	minutes := t.Hour()*60 + t.Minute()
+
+	if w.start < w.end {
+		return w.weekdayMatches(t) && minutes >= w.start && minutes < w.end
+	}
+
+	// The window wraps around midnight (e.g. 22:00-06:00), the weekday refers to the start of the window
+	if minutes >= w.start {
+		return w.weekdayMatches(t)
+	}
+	return minutes < w.end && w.weekdayMatches(t.AddDate(0, 0, -1))
+}
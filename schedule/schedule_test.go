@@ -0,0 +1,101 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"* * * * foo",
+	}
+	for _, expr := range invalid {
+		if _, err := ParseCron(expr); err == nil {
+			t.Error("expected error for cron expression: ", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2024-03-15 is a friday
+	now := time.Date(2024, 3, 15, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"15 2 * * *", time.Date(2024, 3, 16, 2, 15, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 3, 15, 10, 15, 0, 0, time.UTC)},
+		{"0 8 * * mon-fri", time.Date(2024, 3, 18, 8, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"30 12 1 * *", time.Date(2024, 4, 1, 12, 30, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		c, err := ParseCron(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next := c.Next(now); !next.Equal(test.next) {
+			t.Errorf("%s: expected next execution %s, got %s", test.expr, test.next, next)
+		}
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	tests := []struct {
+		window   string
+		time     time.Time
+		contains bool
+	}{
+		{"Mon-Fri 08:00-18:00", time.Date(2024, 3, 15, 8, 0, 0, 0, time.UTC), true},
+		{"Mon-Fri 08:00-18:00", time.Date(2024, 3, 15, 18, 0, 0, 0, time.UTC), false},
+		{"Mon-Fri 08:00-18:00", time.Date(2024, 3, 16, 12, 0, 0, 0, time.UTC), false},
+		{"Sat,Sun", time.Date(2024, 3, 16, 12, 0, 0, 0, time.UTC), true},
+		{"Sat,Sun", time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC), false},
+		{"22:00-06:00", time.Date(2024, 3, 15, 23, 0, 0, 0, time.UTC), true},
+		{"22:00-06:00", time.Date(2024, 3, 15, 5, 59, 0, 0, time.UTC), true},
+		{"22:00-06:00", time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC), false},
+		// friday night belongs to the window which started on friday
+		{"Fri 22:00-06:00", time.Date(2024, 3, 16, 3, 0, 0, 0, time.UTC), true},
+		{"Fri 22:00-06:00", time.Date(2024, 3, 15, 3, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, test := range tests {
+		w, err := ParseWindow(test.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.Contains(test.time) != test.contains {
+			t.Errorf("%s: expected contains %s to be %t", test.window, test.time, test.contains)
+		}
+	}
+}
+
+func TestParseWindowInvalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"Mon-Fri 08:00",
+		"08:00-25:00",
+		"08:00-08:00",
+		"Foo 08:00-18:00",
+		"Mon-Fri 08:00-18:00 extra",
+	}
+	for _, window := range invalid {
+		if _, err := ParseWindow(window); err == nil {
+			t.Error("expected error for window: ", window)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// Categories of the components which report their execution statistics
+const (
+	Checks              = "checks"
+	CustomChecks        = "customchecks"
+	PrometheusExporters = "prometheus_exporters"
+	Push                = "push"
+)
+
+// Stats contains the execution statistics of a single check, exporter or push request
+type Stats struct {
+	LastDuration         float64 `json:"last_duration"`          // Duration of the last execution in seconds
+	LastSuccessTimestamp int64   `json:"last_success_timestamp"` // Unix timestamp of the last successful execution
+	ConsecutiveErrors    int64   `json:"consecutive_errors"`     // Number of failed executions since the last success
+	Panics               int64   `json:"panics"`                 // Number of panics since the agent was started
+}
+
+// Result is the agent_runtime section of the check result
+type Result struct {
+	Goroutines          int               `json:"goroutines"`
+	MemoryRss           uint64            `json:"memory_rss"` // Resident set size of the agent process in bytes
+	Checks              map[string]*Stats `json:"checks"`
+	CustomChecks        map[string]*Stats `json:"customchecks"`
+	PrometheusExporters map[string]*Stats `json:"prometheus_exporters"`
+	Push                map[string]*Stats `json:"push"`
+}
+
+// Registry collects the execution statistics of all components of the agent
+// All methods are safe to call on a nil Registry
+type Registry struct {
+	mtx   sync.Mutex
+	stats map[string]map[string]*Stats
+}
+
+func (r *Registry) get(category, name string) *Stats {
+	if r.stats == nil {
+		r.stats = map[string]map[string]*Stats{}
+	}
+	if r.stats[category] == nil {
+		r.stats[category] = map[string]*Stats{}
+	}
+	s, ok := r.stats[category][name]
+	if !ok {
+		s = &Stats{}
+		r.stats[category][name] = s
+	}
+	return s
+}
+
+// Record stores the duration and the outcome of an execution
+func (r *Registry) Record(category, name string, duration time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	s := r.get(category, name)
+	s.LastDuration = duration.Seconds()
+	if err != nil {
+		s.ConsecutiveErrors++
+	} else {
+		s.ConsecutiveErrors = 0
+		s.LastSuccessTimestamp = time.Now().Unix()
+	}
+}
+
+// RecordPanic stores a failed execution which ended in a panic
+func (r *Registry) RecordPanic(category, name string, duration time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	s := r.get(category, name)
+	s.LastDuration = duration.Seconds()
+	s.ConsecutiveErrors++
+	s.Panics++
+}
+
+// Reset removes all statistics of the given category (e.g. after the custom checks got reloaded)
+func (r *Registry) Reset(category string) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	delete(r.stats, category)
+}
+
+// Remove deletes the statistics of a single check (e.g. after a custom check got removed)
+func (r *Registry) Remove(category, name string) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	delete(r.stats[category], name)
+}
+
+func (r *Registry) copyCategory(category string) map[string]*Stats {
+	res := make(map[string]*Stats, len(r.stats[category]))
+	for name, s := range r.stats[category] {
+		stats := *s
+		res[name] = &stats
+	}
+	return res
+}
+
+// Result returns a copy of all statistics together with information about the agent process
+func (r *Registry) Result(ctx context.Context) *Result {
+	res := &Result{
+		Goroutines: runtime.NumGoroutine(),
+	}
+
+	if p, err := process.NewProcessWithContext(ctx, int32(os.Getpid())); err == nil {
+		if mem, err := p.MemoryInfoWithContext(ctx); err == nil {
+			res.MemoryRss = mem.RSS
+		}
+	}
+
+	if r == nil {
+		r = &Registry{}
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	res.Checks = r.copyCategory(Checks)
+	res.CustomChecks = r.copyCategory(CustomChecks)
+	res.PrometheusExporters = r.copyCategory(PrometheusExporters)
+	res.Push = r.copyCategory(Push)
+
+	return res
+}
@@ -0,0 +1,52 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistryRecord(t *testing.T) {
+	r := &Registry{}
+
+	r.Record(Checks, "cpu", time.Second, nil)
+	r.Record(Checks, "docker", time.Second, errors.New("test"))
+	r.Record(Checks, "docker", time.Second*2, errors.New("test"))
+	r.RecordPanic(Checks, "docker", time.Second)
+
+	res := r.Result(context.Background())
+	if res.Goroutines < 1 {
+		t.Error("expected at least one goroutine")
+	}
+
+	cpu := res.Checks["cpu"]
+	if cpu == nil || cpu.LastSuccessTimestamp == 0 || cpu.ConsecutiveErrors != 0 || cpu.LastDuration != 1 {
+		t.Fatal("unexpected stats for cpu: ", cpu)
+	}
+
+	docker := res.Checks["docker"]
+	if docker == nil || docker.LastSuccessTimestamp != 0 || docker.ConsecutiveErrors != 3 || docker.Panics != 1 {
+		t.Fatal("unexpected stats for docker: ", docker)
+	}
+
+	r.Record(Checks, "docker", time.Second, nil)
+	if docker := r.Result(context.Background()).Checks["docker"]; docker.ConsecutiveErrors != 0 || docker.Panics != 1 {
+		t.Fatal("unexpected stats for docker after success: ", docker)
+	}
+
+	r.Reset(Checks)
+	if len(r.Result(context.Background()).Checks) != 0 {
+		t.Fatal("expected empty check stats after reset")
+	}
+}
+
+func TestRegistryNil(t *testing.T) {
+	var r *Registry
+	r.Record(Push, "checkdata", time.Second, nil)
+	r.RecordPanic(Push, "checkdata", time.Second)
+	r.Reset(Push)
+	if res := r.Result(context.Background()); res.Push == nil || len(res.Push) != 0 {
+		t.Fatal("unexpected result for nil registry")
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
+	"math"
 	"os"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -105,3 +107,31 @@ func CSRFromKeyFile(keyFile, subject string) ([]byte, error) {
 		Bytes: der,
 	}), nil
 }
+
+// ParseCertificateFile reads the first certificate of the PEM encoded certFile
+func ParseCertificateFile(certFile string) (*x509.Certificate, error) {
+	pemData, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCertificatePEM(pemData)
+}
+
+// ParseCertificatePEM parses the first certificate of the PEM encoded data
+func ParseCertificatePEM(pemData []byte) (*x509.Certificate, error) {
+	for {
+		var pemBlock *pem.Block
+		pemBlock, pemData = pem.Decode(pemData)
+		if pemBlock == nil {
+			return nil, fmt.Errorf("no valid PEM encoded certificate found")
+		}
+		if pemBlock.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(pemBlock.Bytes)
+		}
+	}
+}
+
+// CertificateDaysRemaining returns the number of full days until the certificate expires, negative if it is expired
+func CertificateDaysRemaining(cert *x509.Certificate, now time.Time) int64 {
+	return int64(math.Floor(cert.NotAfter.Sub(now).Hours() / 24))
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseCertificateFile(t *testing.T) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Now().Add(10*24*time.Hour + time.Hour).Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "agent"},
+		Issuer:       pkix.Name{CommonName: "agent"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the certificate file of the webserver may also contain the key
+	certFile := filepath.Join(tmpDir, "agent.crt")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	if err := os.WriteFile(certFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := ParseCertificateFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.NotAfter.Equal(notAfter) {
+		t.Error("unexpected expiry: ", cert.NotAfter)
+	}
+	if cert.Issuer.String() != "CN=agent" {
+		t.Error("unexpected issuer: ", cert.Issuer)
+	}
+	if days := CertificateDaysRemaining(cert, time.Now()); days != 10 {
+		t.Error("expected 10 days remaining, got ", days)
+	}
+	if days := CertificateDaysRemaining(cert, notAfter.Add(time.Hour)); days != -1 {
+		t.Error("expected -1 days remaining for an expired certificate, got ", days)
+	}
+
+	if _, err := ParseCertificatePEM([]byte("no certificate")); err == nil {
+		t.Error("expected error for data without certificate")
+	}
+	if _, err := ParseCertificateFile(filepath.Join(tmpDir, "missing.crt")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
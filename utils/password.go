@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hash algorithms supported by HashPassword and CheckPassword
+const (
+	PasswordBcrypt   = "bcrypt"
+	PasswordArgon2id = "argon2id"
+)
+
+// argon2id parameters used by HashPassword (recommendation of RFC 9106 for memory constrained environments)
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// IsPasswordHash returns true if the value is a bcrypt ($2a$, $2b$, $2y$) or argon2 ($argon2id$, $argon2i$) hash
+func IsPasswordHash(value string) bool {
+	return isBcryptHash(value) || isArgon2Hash(value)
+}
+
+func isBcryptHash(value string) bool {
+	return strings.HasPrefix(value, "$2a$") || strings.HasPrefix(value, "$2b$") || strings.HasPrefix(value, "$2y$")
+}
+
+func isArgon2Hash(value string) bool {
+	return strings.HasPrefix(value, "$argon2id$") || strings.HasPrefix(value, "$argon2i$")
+}
+
+// HashPassword returns the hash of the password in the format used by CheckPassword
+func HashPassword(password, algorithm string) (string, error) {
+	switch algorithm {
+	case "", PasswordBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	case PasswordArgon2id:
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	default:
+		return "", fmt.Errorf("unknown password hash algorithm %s (must be %s or %s)", algorithm, PasswordBcrypt, PasswordArgon2id)
+	}
+}
+
+// CheckPasswordHash returns an error if the bcrypt or argon2 hash can not be parsed
+func CheckPasswordHash(hash string) error {
+	switch {
+	case isBcryptHash(hash):
+		_, err := bcrypt.Cost([]byte(hash))
+		return err
+	case isArgon2Hash(hash):
+		_, _, _, err := parseArgon2Hash(hash)
+		return err
+	}
+	return fmt.Errorf("unknown password hash")
+}
+
+type argon2Params struct {
+	variant string
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// parseArgon2Hash parses the PHC string format $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+func parseArgon2Hash(hash string) (*argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, nil, nil, fmt.Errorf("invalid argon2 hash")
+	}
+
+	p := &argon2Params{
+		variant: parts[1],
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2 hash version: %w", err)
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2 hash parameters: %w", err)
+	}
+	if p.time == 0 || p.threads == 0 {
+		return nil, nil, nil, fmt.Errorf("invalid argon2 hash parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2 key: %w", err)
+	}
+	if len(key) == 0 {
+		return nil, nil, nil, fmt.Errorf("invalid argon2 key")
+	}
+	return p, salt, key, nil
+}
+
+// CheckPassword compares the password with a bcrypt hash, an argon2 hash or a plain text password in constant time
+func CheckPassword(expected, password string) bool {
+	switch {
+	case isBcryptHash(expected):
+		return bcrypt.CompareHashAndPassword([]byte(expected), []byte(password)) == nil
+	case isArgon2Hash(expected):
+		p, salt, key, err := parseArgon2Hash(expected)
+		if err != nil {
+			return false
+		}
+		var other []byte
+		if p.variant == "argon2id" {
+			other = argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+		} else {
+			other = argon2.Key([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+		}
+		return subtle.ConstantTimeCompare(key, other) == 1
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
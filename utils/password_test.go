@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword(t *testing.T) {
+	for _, algorithm := range []string{PasswordBcrypt, PasswordArgon2id} {
+		hash, err := HashPassword("secret", algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsPasswordHash(hash) {
+			t.Error("not detected as hash: ", hash)
+		}
+		if err := CheckPasswordHash(hash); err != nil {
+			t.Error(err)
+		}
+		if !CheckPassword(hash, "secret") {
+			t.Error("password does not match hash: ", hash)
+		}
+		if CheckPassword(hash, "wrong") {
+			t.Error("wrong password matches hash: ", hash)
+		}
+	}
+
+	if _, err := HashPassword("secret", "md5"); err == nil {
+		t.Error("expected error for unknown algorithm")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	// htpasswd and PHP create bcrypt hashes with the $2y$ prefix
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	phpHash := "$2y$" + strings.TrimPrefix(string(hash), "$2a$")
+	if !CheckPassword(phpHash, "secret") || CheckPasswordHash(phpHash) != nil {
+		t.Error("could not verify $2y$ hash: ", phpHash)
+	}
+	if !CheckPassword("secret", "secret") || CheckPassword("secret", "secret2") {
+		t.Error("plain text password comparison failed")
+	}
+	if CheckPassword("$argon2id$v=19$m=invalid$abc$def", "secret") {
+		t.Error("invalid argon2 hash matches")
+	}
+	if err := CheckPasswordHash("$argon2id$v=19$m=65536,t=3$abc$def"); err == nil {
+		t.Error("expected error for invalid argon2 hash")
+	}
+}
@@ -0,0 +1,170 @@
+package webserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxPasswordChecks limits the concurrent password verifications, argon2 uses 64MiB of memory per check
+	maxPasswordChecks = 2
+	// maxFailedLogins is the number of failed logins of a remote address within failedLoginWindow,
+	// further requests of the address get rejected without verifying the password
+	maxFailedLogins   = 10
+	failedLoginWindow = time.Minute
+)
+
+type failedLogins struct {
+	count int
+	since time.Time
+}
+
+type basicAuthMiddleware struct {
+	users []*config.BasicAuthUser
+
+	// verified contains the sha256 sum of the last verified password of each user with a hashed password,
+	// so bcrypt or argon2 only have to run once and not on every request
+	verified    map[string][sha256.Size]byte
+	verifiedMtx sync.Mutex
+
+	passwordChecks chan struct{}
+
+	// failed contains the failed logins of each remote address within failedLoginWindow
+	failed    map[string]*failedLogins
+	failedMtx sync.Mutex
+}
+
+func newBasicAuthMiddleware(users []*config.BasicAuthUser) *basicAuthMiddleware {
+	return &basicAuthMiddleware{
+		users:          users,
+		verified:       map[string][sha256.Size]byte{},
+		passwordChecks: make(chan struct{}, maxPasswordChecks),
+		failed:         map[string]*failedLogins{},
+	}
+}
+
+// checkPassword verifies the password, waits if maxPasswordChecks verifications are already running
+func (b *basicAuthMiddleware) checkPassword(expected, password string) bool {
+	b.passwordChecks <- struct{}{}
+	defer func() {
+		<-b.passwordChecks
+	}()
+	return utils.CheckPassword(expected, password)
+}
+
+// blocked returns true if the remote address exceeded maxFailedLogins within failedLoginWindow
+func (b *basicAuthMiddleware) blocked(addr string) bool {
+	b.failedMtx.Lock()
+	defer b.failedMtx.Unlock()
+
+	f, ok := b.failed[addr]
+	if !ok {
+		return false
+	}
+	if time.Since(f.since) >= failedLoginWindow {
+		delete(b.failed, addr)
+		return false
+	}
+	return f.count >= maxFailedLogins
+}
+
+// addFailedLogin counts a failed login of the remote address
+func (b *basicAuthMiddleware) addFailedLogin(addr string) {
+	b.failedMtx.Lock()
+	defer b.failedMtx.Unlock()
+
+	now := time.Now()
+	// drop the addresses which are not limited anymore
+	for a, f := range b.failed {
+		if now.Sub(f.since) >= failedLoginWindow {
+			delete(b.failed, a)
+		}
+	}
+	if f, ok := b.failed[addr]; ok {
+		f.count++
+		return
+	}
+	b.failed[addr] = &failedLogins{count: 1, since: now}
+}
+
+// remoteHost returns the address of the client without the port
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// authenticate compares the credentials in constant time
+func (b *basicAuthMiddleware) authenticate(username, password string) bool {
+	var user *config.BasicAuthUser
+	// always compare against all users, so the time does not depend on the position of the user
+	for _, u := range b.users {
+		if subtle.ConstantTimeCompare([]byte(u.Username), []byte(username)) == 1 {
+			user = u
+		}
+	}
+	if user == nil {
+		// spend the time of a password check anyway, so unknown users can not be detected by the response time
+		b.checkPassword(b.users[0].Password, password)
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(password))
+	b.verifiedMtx.Lock()
+	cached, ok := b.verified[user.Username]
+	b.verifiedMtx.Unlock()
+	if ok && subtle.ConstantTimeCompare(cached[:], sum[:]) == 1 {
+		return true
+	}
+
+	if !b.checkPassword(user.Password, password) {
+		return false
+	}
+	if utils.IsPasswordHash(user.Password) {
+		b.verifiedMtx.Lock()
+		b.verified[user.Username] = sum
+		b.verifiedMtx.Unlock()
+	}
+	return true
+}
+
+func (b *basicAuthMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr := remoteHost(r.RemoteAddr)
+		if b.blocked(addr) {
+			log.Infoln("Webserver: Too many failed logins from client: ", r.RemoteAddr)
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		user, password, ok := r.BasicAuth()
+		if !ok {
+			// clients send the credentials after the challenge, so this is not a failed login
+			w.Header().Set("WWW-Authenticate", `Basic realm="openITCOCKPIT Agent", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		} else if !b.authenticate(user, password) {
+			log.Infoln("Webserver: Invalid username or password from client: ", r.RemoteAddr)
+			b.addFailedLogin(addr)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		} else {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authenticatedKey, true)))
+		}
+	})
+}
+
+// denyMiddleware rejects all requests, used if the authentication could not be configured
+func denyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
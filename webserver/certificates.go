@@ -0,0 +1,254 @@
+package webserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// certificateWatchInterval is the interval the certificate files get checked for changes
+// The files get polled, because tools like certbot replace the files or the symlinks to them,
+// which would break a file system notification on the file itself
+var certificateWatchInterval = 5 * time.Second
+
+// certificateFile is the size and modification time of a certificate file
+type certificateFile struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func (f certificateFile) equal(o certificateFile) bool {
+	return f.exists == o.exists && f.size == o.size && f.modTime.Equal(o.modTime)
+}
+
+func statCertificateFile(path string) certificateFile {
+	if path == "" {
+		return certificateFile{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return certificateFile{}
+	}
+	return certificateFile{
+		exists:  true,
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+}
+
+// certificateStore serves the certificate and client ca of the webserver and reloads them when the files change
+// The last good certificate is kept if the new files could not be loaded
+// All methods are safe to call on a nil certificateStore
+type certificateStore struct {
+	certFile string
+	keyFile  string
+	// caFile is only used for AutoSSL to verify the client certificates
+	caFile string
+
+	mtx sync.RWMutex
+	// base is the tls configuration without certificates
+	base *tls.Config
+	// config is the current tls configuration with certificate and client ca
+	config *tls.Config
+	cert   *tls.Certificate
+	pool   *x509.CertPool
+	// files is the state of the files at the last load
+	files []certificateFile
+
+	shutdown chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newCertificateStore(certFile, keyFile, caFile string) *certificateStore {
+	return &certificateStore{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		shutdown: make(chan struct{}),
+	}
+}
+
+// uses returns true if the store loads the given files
+func (c *certificateStore) uses(certFile, keyFile, caFile string) bool {
+	return c != nil && c.certFile == certFile && c.keyFile == keyFile && c.caFile == caFile
+}
+
+func (c *certificateStore) stat() []certificateFile {
+	return []certificateFile{
+		statCertificateFile(c.certFile),
+		statCertificateFile(c.keyFile),
+		statCertificateFile(c.caFile),
+	}
+}
+
+// load reads the certificate files, the last good certificate is kept on errors
+func (c *certificateStore) load() error {
+	if c == nil {
+		return nil
+	}
+	files := c.stat()
+
+	pem := bytes.Buffer{}
+	certPem, err := os.ReadFile(c.certFile)
+	if err != nil {
+		return c.loadFailed(files, fmt.Errorf("could not read server certificate: %w", err))
+	}
+	pem.Write(certPem)
+	pem.WriteByte('\n')
+	keyPem, err := os.ReadFile(c.keyFile)
+	if err != nil {
+		return c.loadFailed(files, fmt.Errorf("could not read server key: %w", err))
+	}
+
+	var pool *x509.CertPool
+	if c.caFile != "" {
+		var caPem []byte
+		pool, caPem, err = utils.CertPoolFromFiles(c.caFile)
+		if err != nil {
+			return c.loadFailed(files, err)
+		}
+		log.Debugln("Webserver: Loaded ca certificate")
+		pem.Write(caPem)
+	}
+
+	cert, err := tls.X509KeyPair(pem.Bytes(), keyPem)
+	if err != nil {
+		return c.loadFailed(files, fmt.Errorf("could not load tls certificate: %w", err))
+	}
+	log.Debugln("Webserver: Loaded server cerificate")
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.files = files
+	c.cert = &cert
+	c.pool = pool
+	c.update()
+	return nil
+}
+
+// loadFailed remembers the state of the broken files, so they do not get loaded again until they change
+func (c *certificateStore) loadFailed(files []certificateFile, err error) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.files = files
+	return err
+}
+
+// update creates the tls configuration for new clients, the lock has to be held
+func (c *certificateStore) update() {
+	if c.base == nil || c.cert == nil {
+		c.config = nil
+		return
+	}
+	config := c.base.Clone()
+	config.GetConfigForClient = nil
+	config.Certificates = []tls.Certificate{*c.cert}
+	config.ClientCAs = c.pool
+	c.config = config
+}
+
+// tlsConfig returns the tls configuration of the server, every handshake uses the current certificate and client ca
+func (c *certificateStore) tlsConfig(base *tls.Config) *tls.Config {
+	c.mtx.Lock()
+	c.base = base
+	c.update()
+	c.mtx.Unlock()
+
+	config := base.Clone()
+	config.GetCertificate = c.getCertificate
+	config.GetConfigForClient = c.getConfigForClient
+	return config
+}
+
+// withoutClientAuth returns a copy of the tls configuration of the server which does not request client certificates
+func (c *certificateStore) withoutClientAuth(config *tls.Config) *tls.Config {
+	config = config.Clone()
+	config.ClientAuth = tls.NoClientCert
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		clientConfig, err := c.getConfigForClient(hello)
+		if err != nil {
+			return nil, err
+		}
+		clientConfig = clientConfig.Clone()
+		clientConfig.ClientAuth = tls.NoClientCert
+		return clientConfig, nil
+	}
+	return config
+}
+
+func (c *certificateStore) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.cert == nil {
+		return nil, fmt.Errorf("no server certificate")
+	}
+	return c.cert, nil
+}
+
+func (c *certificateStore) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.config == nil {
+		return nil, fmt.Errorf("no server certificate")
+	}
+	return c.config, nil
+}
+
+// reload loads the certificate files again if they changed since the last load
+func (c *certificateStore) reload() {
+	if c == nil {
+		return
+	}
+	files := c.stat()
+	c.mtx.RLock()
+	changed := len(files) != len(c.files)
+	for i := 0; !changed && i < len(files); i++ {
+		changed = !files[i].equal(c.files[i])
+	}
+	c.mtx.RUnlock()
+	if !changed {
+		return
+	}
+
+	log.Infoln("Webserver: Certificate files changed, reload certificate")
+	if err := c.load(); err != nil {
+		log.Errorln("Webserver: Could not reload certificate, keep using the last certificate: ", err)
+	}
+}
+
+// watch reloads the certificate in background when the files change
+func (c *certificateStore) watch() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(certificateWatchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.shutdown:
+				return
+			case <-ticker.C:
+				c.reload()
+			}
+		}
+	}()
+}
+
+// Shutdown stops watching the certificate files
+func (c *certificateStore) Shutdown() {
+	if c == nil {
+		return
+	}
+	close(c.shutdown)
+	c.wg.Wait()
+}
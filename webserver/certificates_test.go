@@ -0,0 +1,143 @@
+package webserver
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
+)
+
+// peerIssuer returns the issuer of the server certificate
+func peerIssuer(t *testing.T, port int64) string {
+	conn, err := tls.Dial("tcp", fmt.Sprintf("localhost:%d", port), &tls.Config{
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Issuer.CommonName
+}
+
+// replaceCertificate copies the certificate and key from testdata, the modification time is set
+// to the future, so the change is detected on file systems with a low time resolution
+func replaceCertificate(t *testing.T, crt *certs, name string, modTime time.Time) {
+	_, filename, _, _ := runtime.Caller(0)
+	templateCertDir := filepath.Join(filepath.Dir(filename), "..", "testdata", "certificates")
+	for src, dest := range map[string]string{name + ".crt": crt.certPath, name + ".key": crt.keyPath} {
+		if err := utils.CopyFile(filepath.Join(templateCertDir, src), dest); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(dest, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func waitForIssuer(t *testing.T, port int64, issuer string) {
+	timeout := time.Now().Add(time.Second * 5)
+	for time.Now().Before(timeout) {
+		if peerIssuer(t, port) == issuer {
+			return
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	t.Fatal("server certificate was not reloaded: ", peerIssuer(t, port))
+}
+
+func TestServerCertificateReload(t *testing.T) {
+	certificateWatchInterval = time.Millisecond * 100
+	defer func() {
+		certificateWatchInterval = 5 * time.Second
+	}()
+
+	crt, err := copyTestCertificates(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(crt.tmpDir)
+	}()
+
+	srv := &Server{
+		StateInput: make(chan []byte),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv.Start(ctx)
+	defer srv.Shutdown()
+
+	port := dynamicPort()
+	srv.Reload(&config.Configuration{
+		Port:            port,
+		KeyFile:         crt.keyPath,
+		CertificateFile: crt.certPath,
+	})
+	if err := srv.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if issuer := peerIssuer(t, port); issuer != "localhost" {
+		t.Fatal("unexpected issuer of the self signed certificate: ", issuer)
+	}
+
+	// the renewed certificate gets used without a reload
+	replaceCertificate(t, crt, "server", time.Now().Add(time.Minute))
+	waitForIssuer(t, port, "CA")
+
+	// a broken certificate does not replace the last good certificate
+	modTime := time.Now().Add(time.Minute * 2)
+	if err := os.WriteFile(crt.certPath, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(crt.certPath, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(certificateWatchInterval * 3)
+	if issuer := peerIssuer(t, port); issuer != "CA" {
+		t.Error("last good certificate was not kept: ", issuer)
+	}
+
+	replaceCertificate(t, crt, "server_self", time.Now().Add(time.Minute*3))
+	waitForIssuer(t, port, "localhost")
+}
+
+func TestCertificateStoreKeepLastGood(t *testing.T) {
+	crt, err := copyTestCertificates(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(crt.tmpDir)
+	}()
+
+	store := newCertificateStore(crt.certPath, crt.keyPath, "")
+	if err := store.load(); err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig := store.tlsConfig(&tls.Config{})
+	good, err := tlsConfig.GetConfigForClient(nil)
+	if err != nil || len(good.Certificates) != 1 {
+		t.Fatal("expected tls configuration with certificate: ", err)
+	}
+
+	if err := os.WriteFile(crt.keyPath, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.load(); err == nil {
+		t.Fatal("expected error for broken key")
+	}
+	current, err := tlsConfig.GetConfigForClient(nil)
+	if err != nil || current != good {
+		t.Error("last good certificate was not kept: ", err)
+	}
+	if cert, err := tlsConfig.GetCertificate(nil); err != nil || cert == nil {
+		t.Error("last good certificate was not kept: ", err)
+	}
+}
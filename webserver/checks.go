@@ -0,0 +1,308 @@
+package webserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/checkrunner"
+	log "github.com/sirupsen/logrus"
+)
+
+type checkInfo struct {
+	Name      string `json:"name"`
+	Timestamp int64  `json:"timestamp"` // Unix timestamp of the last result
+}
+
+type checkList struct {
+	Checks       []*checkInfo `json:"checks"`
+	CustomChecks []*checkInfo `json:"customchecks"`
+}
+
+// getStateSections returns the results of the single checks and the time the check result was received
+// The returned map must not be modified
+func (w *handler) getStateSections() (map[string]json.RawMessage, int64) {
+	w.mtx.RLock()
+	defer w.mtx.RUnlock()
+	return w.stateSections, w.stateTimestamp
+}
+
+// checkTimestamps returns the time of the last successful run of each built-in check from the agent_runtime section
+func checkTimestamps(sections map[string]json.RawMessage) map[string]int64 {
+	runtime := struct {
+		Checks map[string]*struct {
+			LastSuccessTimestamp int64 `json:"last_success_timestamp"`
+		} `json:"checks"`
+	}{}
+	timestamps := map[string]int64{}
+	if raw, ok := sections["agent_runtime"]; ok {
+		if err := json.Unmarshal(raw, &runtime); err != nil {
+			log.Debugln("Webserver: could not parse agent_runtime: ", err)
+		}
+	}
+	for name, stats := range runtime.Checks {
+		if stats != nil {
+			timestamps[name] = stats.LastSuccessTimestamp
+		}
+	}
+	return timestamps
+}
+
+func (w *handler) handleChecks(response http.ResponseWriter, _ *http.Request) {
+	sections, received := w.getStateSections()
+
+	list := &checkList{
+		Checks:       []*checkInfo{},
+		CustomChecks: []*checkInfo{},
+	}
+	timestamps := checkTimestamps(sections)
+	for name := range sections {
+		timestamp := timestamps[name]
+		if timestamp == 0 {
+			timestamp = received
+		}
+		list.Checks = append(list.Checks, &checkInfo{
+			Name:      name,
+			Timestamp: timestamp,
+		})
+	}
+
+	customChecks := map[string]*struct {
+		ExecutionUnixTimestampSec int64 `json:"execution_unix_timestamp_sec"`
+	}{}
+	if raw, ok := sections["customchecks"]; ok {
+		if err := json.Unmarshal(raw, &customChecks); err != nil {
+			log.Debugln("Webserver: could not parse custom check results: ", err)
+		}
+	}
+	for name, result := range customChecks {
+		info := &checkInfo{
+			Name: name,
+		}
+		if result != nil {
+			info.Timestamp = result.ExecutionUnixTimestampSec
+		}
+		list.CustomChecks = append(list.CustomChecks, info)
+	}
+
+	sort.Slice(list.Checks, func(i, j int) bool {
+		return list.Checks[i].Name < list.Checks[j].Name
+	})
+	sort.Slice(list.CustomChecks, func(i, j int) bool {
+		return list.CustomChecks[i].Name < list.CustomChecks[j].Name
+	})
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		log.Errorln("Webserver: Could not create json for check list: ", err)
+		http.Error(response, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJson(response, data)
+}
+
+func (w *handler) handleCheck(response http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)["name"]
+	sections, _ := w.getStateSections()
+
+	result, ok := sections[name]
+	if !ok {
+		http.Error(response, "check not found", http.StatusNotFound)
+		return
+	}
+	writeProjection(response, request, result)
+}
+
+func (w *handler) handleCustomCheck(response http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)["name"]
+	sections, _ := w.getStateSections()
+
+	customChecks := map[string]json.RawMessage{}
+	if raw, ok := sections["customchecks"]; ok {
+		if err := json.Unmarshal(raw, &customChecks); err != nil {
+			log.Errorln("Webserver: Could not parse custom check results: ", err)
+			http.Error(response, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	result, ok := customChecks[name]
+	if !ok {
+		http.Error(response, "custom check not found", http.StatusNotFound)
+		return
+	}
+	writeProjection(response, request, result)
+}
+
+func (w *handler) handleCheckRun(response http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)["name"]
+	w.runCheck(response, request, name, false, func() (interface{}, error) {
+		return w.CheckExecutor.RunCheck(request.Context(), name)
+	})
+}
+
+func (w *handler) handleCustomCheckRun(response http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)["name"]
+	w.runCheck(response, request, name, true, func() (interface{}, error) {
+		return w.CheckExecutor.RunCustomCheck(request.Context(), name)
+	})
+}
+
+// runCheck executes the check on demand if the rate limit allows it and writes the fresh result
+func (w *handler) runCheck(response http.ResponseWriter, request *http.Request, name string, custom bool, run func() (interface{}, error)) {
+	if w.CheckExecutor == nil {
+		http.Error(response, "check execution not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	// unknown checks must not use up the rate limit of a check which gets configured later
+	if !w.CheckExecutor.HasCheck(request.Context(), name, custom) {
+		http.Error(response, "check not found", http.StatusNotFound)
+		return
+	}
+	key := "check/" + name
+	if custom {
+		key = "customcheck/" + name
+	}
+	if wait, ok := w.RunLimiter.allow(key); !ok {
+		retryAfter := int64(math.Ceil(wait.Seconds()))
+		response.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		http.Error(response, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	log.Debugln("Webserver: Run ", key, " on demand for ", request.RemoteAddr)
+	result, err := run()
+	switch {
+	case errors.Is(err, checkrunner.ErrCheckNotFound):
+		http.Error(response, "check not found", http.StatusNotFound)
+		return
+	case errors.Is(err, checkrunner.ErrCheckRunning):
+		http.Error(response, "check is already running", http.StatusConflict)
+		return
+	case err != nil:
+		log.Errorln("Webserver: Could not run ", key, ": ", err)
+		http.Error(response, "check execution not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Errorln("Webserver: Could not create json for check result: ", err)
+		http.Error(response, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJson(response, data)
+}
+
+func writeJson(response http.ResponseWriter, data []byte) {
+	response.Header().Add("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	if _, err := response.Write(data); err != nil {
+		log.Errorln("Webserver: ", err)
+	}
+}
+
+// writeProjection writes the check result reduced to the fields of the ?fields= query parameter
+func writeProjection(response http.ResponseWriter, request *http.Request, result json.RawMessage) {
+	fields := request.URL.Query().Get("fields") // ?fields=usage.percent,disk.mountpoint
+	if fields == "" {
+		writeJson(response, result)
+		return
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(result))
+	// keep the numbers as they are, e.g. large counters would lose precision as float64
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		log.Errorln("Webserver: Could not parse check result: ", err)
+		http.Error(response, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	projected, _ := project(value, parseFields(fields))
+	data, err := json.Marshal(projected)
+	if err != nil {
+		log.Errorln("Webserver: Could not create json for check result: ", err)
+		http.Error(response, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJson(response, data)
+}
+
+// fieldTree contains the requested sub fields of each field, a nil fieldTree selects the whole value
+type fieldTree map[string]fieldTree
+
+// parseFields parses a comma separated list of dotted field paths (e.g. "usage.percent,disk.mountpoint")
+// The field "*" matches every key of an object
+func parseFields(fields string) fieldTree {
+	tree := fieldTree{}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		node := tree
+		parts := strings.Split(field, ".")
+		for i, part := range parts {
+			sub, exists := node[part]
+			if exists && sub == nil {
+				// the parent field is already selected completely
+				break
+			}
+			if i == len(parts)-1 {
+				node[part] = nil
+				break
+			}
+			if !exists {
+				sub = fieldTree{}
+				node[part] = sub
+			}
+			node = sub
+		}
+	}
+	return tree
+}
+
+// project returns only the selected fields of the value. Lists get projected element by element.
+// Returns false if none of the fields exist, or nil if the value has no fields at all.
+func project(value interface{}, tree fieldTree) (interface{}, bool) {
+	if tree == nil {
+		return value, true
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		res := map[string]interface{}{}
+		for key, val := range v {
+			sub, ok := tree[key]
+			if !ok {
+				sub, ok = tree["*"]
+			}
+			if !ok {
+				continue
+			}
+			if projected, ok := project(val, sub); ok {
+				res[key] = projected
+			}
+		}
+		return res, len(res) > 0
+	case []interface{}:
+		res := make([]interface{}, 0, len(v))
+		for _, val := range v {
+			// keep empty objects, so the elements still match the elements of the full result
+			if projected, _ := project(val, tree); projected != nil {
+				res = append(res, projected)
+			}
+		}
+		return res, true
+	}
+	return nil, false
+}
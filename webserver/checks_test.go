@@ -0,0 +1,268 @@
+package webserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/checkrunner"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
+)
+
+func TestProject(t *testing.T) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(`{
+		"disks": [{"disk": {"device": "sda", "mountpoint": "/"}, "usage": {"percent": 10, "free": 5}}],
+		"disk_io": {"sda": {"ReadBytes": 1, "WriteBytes": 2}, "sdb": {"ReadBytes": 3, "WriteBytes": 4}},
+		"cpu": 5
+	}`), &value); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		fields   string
+		expected string
+	}{
+		{"cpu", `{"cpu": 5}`},
+		{"disks.usage.percent,disks.disk.mountpoint", `{"disks": [{"disk": {"mountpoint": "/"}, "usage": {"percent": 10}}]}`},
+		{"disk_io.*.ReadBytes", `{"disk_io": {"sda": {"ReadBytes": 1}, "sdb": {"ReadBytes": 3}}}`},
+		{"cpu,cpu.unknown", `{"cpu": 5}`},
+		{"unknown", `{}`},
+	} {
+		var expected interface{}
+		if err := json.Unmarshal([]byte(test.expected), &expected); err != nil {
+			t.Fatal(err)
+		}
+		projected, _ := project(value, parseFields(test.fields))
+		if !reflect.DeepEqual(projected, expected) {
+			t.Errorf("unexpected projection for %s: %v", test.fields, projected)
+		}
+	}
+}
+
+func getJson(t *testing.T, url string, v interface{}) int {
+	r, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Body.Close()
+	if r.StatusCode == http.StatusOK && v != nil {
+		if err := json.Unmarshal(body, v); err != nil {
+			t.Fatal(err, ": ", string(body))
+		}
+	}
+	return r.StatusCode
+}
+
+func TestWebserverHandlerChecks(t *testing.T) {
+	stateInput := make(chan []byte)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &handler{
+		StateInput:    stateInput,
+		Configuration: &config.Configuration{},
+	}
+	w.Start(ctx)
+	defer w.Shutdown()
+
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	stateInput <- []byte(`{
+		"disks": [{"disk": {"device": "sda"}, "usage": {"percent": 10, "free": 5}}],
+		"customchecks": {"check_users": {"stdout": "OK", "rc": 0, "execution_unix_timestamp_sec": 1700000000}},
+		"agent_runtime": {"checks": {"disks": {"last_success_timestamp": 1700000001}}}
+	}`)
+
+	list := &checkList{}
+	if status := getJson(t, ts.URL+"/checks", list); status != http.StatusOK {
+		t.Fatal("unexpected status code: ", status)
+	}
+	if len(list.Checks) != 3 || list.Checks[2].Name != "disks" || list.Checks[2].Timestamp != 1700000001 {
+		t.Errorf("unexpected checks: %+v", list.Checks)
+	}
+	if list.Checks[0].Name != "agent_runtime" || list.Checks[0].Timestamp == 0 {
+		t.Errorf("unexpected timestamp of agent_runtime: %+v", list.Checks[0])
+	}
+	if len(list.CustomChecks) != 1 || list.CustomChecks[0].Name != "check_users" || list.CustomChecks[0].Timestamp != 1700000000 {
+		t.Errorf("unexpected custom checks: %+v", list.CustomChecks)
+	}
+
+	var disks []map[string]interface{}
+	if status := getJson(t, ts.URL+"/checks/disks?fields=usage.percent", &disks); status != http.StatusOK {
+		t.Fatal("unexpected status code: ", status)
+	}
+	expected := []map[string]interface{}{{"usage": map[string]interface{}{"percent": float64(10)}}}
+	if !reflect.DeepEqual(disks, expected) {
+		t.Error("unexpected disks: ", disks)
+	}
+
+	cc := map[string]interface{}{}
+	if status := getJson(t, ts.URL+"/customchecks/check_users", &cc); status != http.StatusOK {
+		t.Fatal("unexpected status code: ", status)
+	}
+	if cc["stdout"] != "OK" {
+		t.Error("unexpected custom check result: ", cc)
+	}
+
+	if status := getJson(t, ts.URL+"/checks/unknown", nil); status != http.StatusNotFound {
+		t.Error("unexpected status code for unknown check: ", status)
+	}
+	if status := getJson(t, ts.URL+"/customchecks/unknown", nil); status != http.StatusNotFound {
+		t.Error("unexpected status code for unknown custom check: ", status)
+	}
+}
+
+func TestWebserverHandlerChecksAuth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &handler{
+		StateInput: make(chan []byte),
+		Configuration: &config.Configuration{
+			BasicAuth: testBasicAuth,
+		},
+	}
+	w.Start(ctx)
+	defer w.Shutdown()
+
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	for _, path := range []string{"/checks", "/checks/cpu", "/customchecks/check_users"} {
+		if status := getJson(t, ts.URL+path, nil); status != http.StatusUnauthorized {
+			t.Errorf("unexpected status code for %s without credentials: %d", path, status)
+		}
+	}
+	for _, path := range []string{"/checks/cpu/run", "/customchecks/check_users/run"} {
+		if r := postJson(t, ts.URL+path, nil); r.StatusCode != http.StatusUnauthorized {
+			t.Errorf("unexpected status code for %s without credentials: %d", path, r.StatusCode)
+		}
+	}
+}
+
+type testCheckExecutor struct {
+	runs int
+	// memory enables the memory check like a configuration reload would do
+	memory bool
+}
+
+func (e *testCheckExecutor) RunCheck(_ context.Context, name string) (interface{}, error) {
+	switch {
+	case name == "cpu", name == "memory" && e.memory:
+		e.runs++
+		return map[string]interface{}{"percent": 5}, nil
+	case name == "disks":
+		return nil, checkrunner.ErrCheckRunning
+	}
+	return nil, checkrunner.ErrCheckNotFound
+}
+
+func (e *testCheckExecutor) HasCheck(_ context.Context, name string, custom bool) bool {
+	if custom {
+		return name == "check_users"
+	}
+	return name == "cpu" || name == "disks" || name == "memory" && e.memory
+}
+
+func (e *testCheckExecutor) RunCustomCheck(_ context.Context, name string) (*utils.CommandResult, error) {
+	if name != "check_users" {
+		return nil, checkrunner.ErrCheckNotFound
+	}
+	e.runs++
+	return &utils.CommandResult{Stdout: "OK"}, nil
+}
+
+func postJson(t *testing.T, url string, v interface{}) *http.Response {
+	r, err := http.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Body.Close()
+	if r.StatusCode == http.StatusOK && v != nil {
+		if err := json.Unmarshal(body, v); err != nil {
+			t.Fatal(err, ": ", string(body))
+		}
+	}
+	return r
+}
+
+func TestWebserverHandlerCheckRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	executor := &testCheckExecutor{}
+	w := &handler{
+		StateInput:    make(chan []byte),
+		Configuration: &config.Configuration{},
+		CheckExecutor: executor,
+		RunLimiter:    newRunLimiter(time.Minute),
+	}
+	w.Start(ctx)
+	defer w.Shutdown()
+
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	cpu := map[string]interface{}{}
+	if r := postJson(t, ts.URL+"/checks/cpu/run", &cpu); r.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status code: ", r.StatusCode)
+	}
+	if cpu["percent"] != float64(5) {
+		t.Error("unexpected check result: ", cpu)
+	}
+
+	result := &utils.CommandResult{}
+	if r := postJson(t, ts.URL+"/customchecks/check_users/run", result); r.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status code: ", r.StatusCode)
+	}
+	if result.Stdout != "OK" {
+		t.Error("unexpected custom check result: ", result)
+	}
+
+	// the second execution within the interval gets rejected
+	r := postJson(t, ts.URL+"/checks/cpu/run", nil)
+	if r.StatusCode != http.StatusTooManyRequests {
+		t.Fatal("unexpected status code for rate limited check: ", r.StatusCode)
+	}
+	if r.Header.Get("Retry-After") != "60" {
+		t.Error("unexpected Retry-After header: ", r.Header.Get("Retry-After"))
+	}
+	if executor.runs != 2 {
+		t.Error("rate limited check got executed: ", executor.runs)
+	}
+
+	if r := postJson(t, ts.URL+"/checks/disks/run", nil); r.StatusCode != http.StatusConflict {
+		t.Error("unexpected status code for running check: ", r.StatusCode)
+	}
+	if r := postJson(t, ts.URL+"/checks/unknown/run", nil); r.StatusCode != http.StatusNotFound {
+		t.Error("unexpected status code for unknown check: ", r.StatusCode)
+	}
+	if r := postJson(t, ts.URL+"/customchecks/unknown/run", nil); r.StatusCode != http.StatusNotFound {
+		t.Error("unexpected status code for unknown custom check: ", r.StatusCode)
+	}
+
+	// requests for an unknown check must not use up the rate limit of the check
+	if r := postJson(t, ts.URL+"/checks/memory/run", nil); r.StatusCode != http.StatusNotFound {
+		t.Error("unexpected status code for unknown check: ", r.StatusCode)
+	}
+	executor.memory = true
+	if r := postJson(t, ts.URL+"/checks/memory/run", nil); r.StatusCode != http.StatusOK {
+		t.Error("unexpected status code for check after it got enabled: ", r.StatusCode)
+	}
+}
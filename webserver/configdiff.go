@@ -0,0 +1,126 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	log "github.com/sirupsen/logrus"
+)
+
+type configurationDiffResult struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors,omitempty"`
+
+	ChangedKeys []*config.KeyChange `json:"changed_keys"`
+
+	CustomChecksAdded    []string `json:"custom_checks_added"`
+	CustomChecksRemoved  []string `json:"custom_checks_removed"`
+	CustomChecksModified []string `json:"custom_checks_modified"`
+
+	PrometheusExportersAdded    []string `json:"prometheus_exporters_added"`
+	PrometheusExportersRemoved  []string `json:"prometheus_exporters_removed"`
+	PrometheusExportersModified []string `json:"prometheus_exporters_modified"`
+
+	WebserverRestart      bool `json:"webserver_restart"`
+	TLSChange             bool `json:"tls_change"`
+	ChecksRestart         bool `json:"checks_restart"`
+	PushRestart           bool `json:"push_restart"`
+	PackagemanagerRestart bool `json:"packagemanager_restart"`
+}
+
+// emptyIfNil makes sure the lists get encoded as [] instead of null
+func emptyIfNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// activeConfiguration returns the configuration the agent is running with
+// w.Configuration is only updated by reloads which change a webserver setting
+func (w *handler) activeConfiguration() *config.Configuration {
+	if w.Reloader != nil {
+		if cfg := w.Reloader.Configuration(); cfg != nil {
+			return cfg
+		}
+	}
+	return w.Configuration
+}
+
+// handleConfigDiff accepts the same request as handleConfigPush, but only returns what the push would change
+// Nothing gets written to the configuration files
+func (w *handler) handleConfigDiff(response http.ResponseWriter, request *http.Request) {
+	defer func() {
+		_ = request.Body.Close()
+	}()
+
+	if !w.Configuration.ConfigUpdate {
+		http.Error(response, "config update is disabled", http.StatusForbidden)
+		return
+	}
+
+	files, ok := w.readConfigurationPush(response, request)
+	if !ok {
+		return
+	}
+
+	pushed, err := writePushedFiles(files)
+	if err != nil {
+		log.Errorln("Webserver: Could not write configuration for diff: ", err)
+		http.Error(response, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer pushed.remove()
+
+	result := &configurationDiffResult{
+		ChangedKeys: []*config.KeyChange{},
+	}
+	validationErrors := pushed.validate()
+	for _, e := range validationErrors {
+		result.Errors = append(result.Errors, e.Error())
+	}
+	result.Valid = !config.HasErrors(validationErrors)
+
+	if result.Valid {
+		newCfg, err := config.LoadWithFiles(request.Context(), pushed.paths[0], pushed.paths[1], pushed.paths[2])
+		if err != nil {
+			result.Valid = false
+			result.Errors = append(result.Errors, err.Error())
+		} else {
+			current := w.activeConfiguration()
+			newCfg.ConfigurationPath = current.ConfigurationPath
+
+			diff := config.Compare(current, newCfg)
+			result.ChangedKeys = config.ChangedKeys(current, newCfg)
+			result.CustomChecksAdded = diff.CustomChecksAdded
+			result.CustomChecksRemoved = diff.CustomChecksRemoved
+			result.CustomChecksModified = diff.CustomChecksModified
+			result.PrometheusExportersAdded = diff.PrometheusExportersAdded
+			result.PrometheusExportersRemoved = diff.PrometheusExportersRemoved
+			result.PrometheusExportersModified = diff.PrometheusExportersModified
+			result.WebserverRestart = diff.Webserver
+			result.TLSChange = diff.TLS
+			result.ChecksRestart = diff.Checks || diff.Splay
+			result.PushRestart = diff.Push
+			result.PackagemanagerRestart = diff.Packagemanager || diff.Splay
+		}
+	}
+	result.CustomChecksAdded = emptyIfNil(result.CustomChecksAdded)
+	result.CustomChecksRemoved = emptyIfNil(result.CustomChecksRemoved)
+	result.CustomChecksModified = emptyIfNil(result.CustomChecksModified)
+	result.PrometheusExportersAdded = emptyIfNil(result.PrometheusExportersAdded)
+	result.PrometheusExportersRemoved = emptyIfNil(result.PrometheusExportersRemoved)
+	result.PrometheusExportersModified = emptyIfNil(result.PrometheusExportersModified)
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Errorln("Webserver: Could not create json for configuration diff: ", err)
+		http.Error(response, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	response.Header().Add("Content-Type", "application/json")
+	if _, err := response.Write(data); err != nil {
+		log.Errorln("Webserver: ", err)
+	}
+}
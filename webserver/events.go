@@ -0,0 +1,321 @@
+package webserver
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/packagemanager"
+	log "github.com/sirupsen/logrus"
+)
+
+// Names of the server-sent events, one for each input of the handler
+const (
+	eventChecks     = "checks"
+	eventPrometheus = "prometheus"
+	eventPackages   = "packages"
+)
+
+const (
+	// eventModeFull sends all subscribed results with every event
+	eventModeFull = "full"
+	// eventModeChanged only sends the subscribed results which changed since the last event of the stream
+	eventModeChanged = "changed"
+)
+
+var (
+	// eventKeepAlive is the interval of the comments sent to keep idle connections open
+	eventKeepAlive = 15 * time.Second
+	// eventWriteTimeout replaces the write timeout of the server for event streams
+	eventWriteTimeout = 30 * time.Second
+	// eventBuffer is the number of updates queued for a slow subscriber before updates get dropped
+	eventBuffer = 8
+)
+
+// stateUpdate is passed to all subscribers of the event stream when the handler receives a new state
+type stateUpdate struct {
+	event     string
+	timestamp int64
+	// results by subscription key, e.g. "cpu", "customchecks.check_users", "prometheus.node_exporter" or "packages"
+	results map[string]json.RawMessage
+}
+
+type eventData struct {
+	Timestamp int64                      `json:"timestamp"`
+	Results   map[string]json.RawMessage `json:"results"`
+}
+
+// eventBroker passes the state updates to all subscribed event streams
+// All methods are safe to call on a nil eventBroker
+type eventBroker struct {
+	mtx         sync.Mutex
+	subscribers map[chan *stateUpdate]struct{}
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{
+		subscribers: map[chan *stateUpdate]struct{}{},
+	}
+}
+
+func (b *eventBroker) subscribe() chan *stateUpdate {
+	if b == nil {
+		return nil
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	updates := make(chan *stateUpdate, eventBuffer)
+	b.subscribers[updates] = struct{}{}
+	return updates
+}
+
+func (b *eventBroker) unsubscribe(updates chan *stateUpdate) {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	delete(b.subscribers, updates)
+}
+
+// publish passes the update to all subscribers without blocking, the update gets dropped for subscribers which
+// did not process the previous updates yet
+func (b *eventBroker) publish(update *stateUpdate) {
+	if b == nil || update == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for updates := range b.subscribers {
+		select {
+		case updates <- update:
+		default:
+			log.Debugln("Webserver: Event stream is too slow, drop ", update.event, " event")
+		}
+	}
+}
+
+// checksUpdate splits the check result into the results of the single checks and custom checks
+func checksUpdate(sections map[string]json.RawMessage, timestamp int64) *stateUpdate {
+	if sections == nil {
+		return nil
+	}
+	update := &stateUpdate{
+		event:     eventChecks,
+		timestamp: timestamp,
+		results:   make(map[string]json.RawMessage, len(sections)),
+	}
+	for name, result := range sections {
+		if name != "customchecks" {
+			update.results[name] = result
+			continue
+		}
+		customChecks := map[string]json.RawMessage{}
+		if err := json.Unmarshal(result, &customChecks); err != nil {
+			log.Debugln("Webserver: could not parse custom check results: ", err)
+		}
+		for ccName, ccResult := range customChecks {
+			update.results["customchecks."+ccName] = ccResult
+		}
+	}
+	return update
+}
+
+func prometheusUpdate(state map[string]string) *stateUpdate {
+	update := &stateUpdate{
+		event:     eventPrometheus,
+		timestamp: time.Now().Unix(),
+		results:   make(map[string]json.RawMessage, len(state)),
+	}
+	for name, result := range state {
+		data, err := json.Marshal(result)
+		if err != nil {
+			log.Errorln("Webserver Prometheus: Could not create json for exporter result: ", err)
+			continue
+		}
+		update.results["prometheus."+name] = data
+	}
+	return update
+}
+
+func packagesUpdate(pkgInfo packagemanager.PackageInfo) *stateUpdate {
+	data, err := json.Marshal(&pkgInfo)
+	if err != nil {
+		log.Errorln("Webserver Packagemanager: Could not create json for package manager status: ", err)
+		return nil
+	}
+	return &stateUpdate{
+		event:     eventPackages,
+		timestamp: time.Now().Unix(),
+		results: map[string]json.RawMessage{
+			eventPackages: data,
+		},
+	}
+}
+
+// eventStream writes the subscribed results of the state updates to a single client
+type eventStream struct {
+	response   http.ResponseWriter
+	controller *http.ResponseController
+	// filter contains the subscribed keys, a key also subscribes all keys below it (e.g. "customchecks")
+	// all results are subscribed if the filter is empty
+	filter []string
+	mode   string
+	// sent contains the hashes of the last sent results
+	sent map[string][sha256.Size]byte
+}
+
+func (s *eventStream) subscribed(key string) bool {
+	if len(s.filter) == 0 {
+		return true
+	}
+	for _, f := range s.filter {
+		if key == f || strings.HasPrefix(key, f+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// write sends the subscribed results of the update as event, nothing is sent if no subscribed result is left
+func (s *eventStream) write(update *stateUpdate) error {
+	data := &eventData{
+		Timestamp: update.timestamp,
+		Results:   map[string]json.RawMessage{},
+	}
+	for key, result := range update.results {
+		if !s.subscribed(key) {
+			continue
+		}
+		hash := sha256.Sum256(result)
+		if last, ok := s.sent[key]; ok && last == hash && s.mode == eventModeChanged {
+			continue
+		}
+		s.sent[key] = hash
+		data.Results[key] = result
+	}
+	if len(data.Results) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return s.send(fmt.Sprintf("event: %s\ndata: %s\n\n", update.event, payload))
+}
+
+// send writes the raw event and flushes it to the client
+func (s *eventStream) send(event string) error {
+	if err := s.controller.SetWriteDeadline(time.Now().Add(eventWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := s.response.Write([]byte(event)); err != nil {
+		return err
+	}
+	return s.controller.Flush()
+}
+
+// parseEventFilter parses a comma separated list of subscription keys (e.g. "cpu,customchecks.check_users")
+func parseEventFilter(filter string) []string {
+	keys := []string{}
+	for _, key := range strings.Split(filter, ",") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// handleEvents streams the new check results as server-sent events
+// ?checks=cpu,customchecks.check_users limits the stream to the given checks, ?mode=changed only sends changed results
+func (w *handler) handleEvents(response http.ResponseWriter, request *http.Request) {
+	mode := request.URL.Query().Get("mode")
+	switch mode {
+	case "":
+		mode = eventModeFull
+	case eventModeFull, eventModeChanged:
+	default:
+		http.Error(response, "mode must be full or changed", http.StatusBadRequest)
+		return
+	}
+
+	controller := http.NewResponseController(response)
+	// the stream is open much longer than the timeouts of the server allow
+	if err := controller.SetReadDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Errorln("Webserver: ", err)
+	}
+
+	updates := w.events.subscribe()
+	if updates == nil {
+		http.Error(response, "event stream not available", http.StatusServiceUnavailable)
+		return
+	}
+	defer w.events.unsubscribe(updates)
+
+	stream := &eventStream{
+		response:   response,
+		controller: controller,
+		filter:     parseEventFilter(request.URL.Query().Get("checks")),
+		mode:       mode,
+		sent:       map[string][sha256.Size]byte{},
+	}
+
+	response.Header().Set("Content-Type", "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.WriteHeader(http.StatusOK)
+
+	// Start with the current state, so the client does not have to wait for the next check result
+	sections, timestamp := w.getStateSections()
+	initial := []*stateUpdate{checksUpdate(sections, timestamp)}
+	if state := w.getPrometheusState(); len(state) > 0 {
+		initial = append(initial, prometheusUpdate(state))
+	}
+	if pkgInfo := w.getPackageManagerState(); pkgInfo.Enabled {
+		initial = append(initial, packagesUpdate(pkgInfo))
+	}
+	for _, update := range initial {
+		if update == nil {
+			continue
+		}
+		if err := stream.write(update); err != nil {
+			log.Debugln("Webserver: Event stream closed: ", err)
+			return
+		}
+	}
+	// Send the headers if there was no result yet
+	if err := stream.send(": connected\n\n"); err != nil {
+		log.Debugln("Webserver: Event stream closed: ", err)
+		return
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-request.Context().Done():
+			return
+		case <-w.shutdown:
+			return
+		case update := <-updates:
+			err = stream.write(update)
+		case <-keepAlive.C:
+			err = stream.send(": keep-alive\n\n")
+		}
+		if err != nil {
+			log.Debugln("Webserver: Event stream closed: ", err)
+			return
+		}
+	}
+}
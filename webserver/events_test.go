@@ -0,0 +1,145 @@
+package webserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+)
+
+// readEvent returns the name and data of the next event, comments are skipped
+func readEvent(t *testing.T, reader *bufio.Reader) (string, *eventData) {
+	var name string
+	data := &eventData{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), data); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// openEvents opens the event stream, the returned body must be closed before the server
+func openEvents(t *testing.T, url string) (*bufio.Reader, io.Closer) {
+	client := &http.Client{
+		Timeout: time.Second * 5,
+	}
+	r, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status code: ", r.StatusCode)
+	}
+	if r.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatal("unexpected content type: ", r.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(r.Body), r.Body
+}
+
+func resultKeys(data *eventData) string {
+	keys := []string{}
+	for key := range data.Results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func TestWebserverHandlerEvents(t *testing.T) {
+	stateInput := make(chan []byte)
+	prometheusInput := make(chan map[string]string)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &handler{
+		StateInput:      stateInput,
+		PrometheusInput: prometheusInput,
+		Configuration:   &config.Configuration{},
+	}
+	w.Start(ctx)
+	defer w.Shutdown()
+
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	stateInput <- []byte(`{"cpu": {"percent": 1}, "memory": {"percent": 2}, "customchecks": {"check_users": {"rc": 0}}}`)
+
+	full, body := openEvents(t, ts.URL+"/events")
+	defer body.Close()
+	name, data := readEvent(t, full)
+	if name != eventChecks || resultKeys(data) != "cpu,customchecks.check_users,memory" {
+		t.Fatal("unexpected initial event: ", name, " ", resultKeys(data))
+	}
+
+	changed, body := openEvents(t, ts.URL+"/events?checks=cpu,customchecks&mode=changed")
+	defer body.Close()
+	name, data = readEvent(t, changed)
+	if name != eventChecks || resultKeys(data) != "cpu,customchecks.check_users" {
+		t.Fatal("unexpected initial event: ", name, " ", resultKeys(data))
+	}
+
+	stateInput <- []byte(`{"cpu": {"percent": 1}, "memory": {"percent": 2}, "customchecks": {"check_users": {"rc": 2}}}`)
+	name, data = readEvent(t, changed)
+	if name != eventChecks || resultKeys(data) != "customchecks.check_users" {
+		t.Fatal("unexpected event: ", name, " ", resultKeys(data))
+	}
+	if string(data.Results["customchecks.check_users"]) != `{"rc":2}` {
+		t.Error("unexpected custom check result: ", string(data.Results["customchecks.check_users"]))
+	}
+	name, data = readEvent(t, full)
+	if name != eventChecks || resultKeys(data) != "cpu,customchecks.check_users,memory" {
+		t.Fatal("unexpected event: ", name, " ", resultKeys(data))
+	}
+
+	// the prometheus exporters are not subscribed by the changed stream
+	prometheusInput <- map[string]string{"node_exporter": "node_load1 0.5"}
+	name, data = readEvent(t, full)
+	if name != eventPrometheus || resultKeys(data) != "prometheus.node_exporter" {
+		t.Fatal("unexpected event: ", name, " ", resultKeys(data))
+	}
+
+	stateInput <- []byte(`{"cpu": {"percent": 3}, "memory": {"percent": 2}, "customchecks": {"check_users": {"rc": 2}}}`)
+	name, data = readEvent(t, changed)
+	if name != eventChecks || resultKeys(data) != "cpu" {
+		t.Fatal("unexpected event: ", name, " ", resultKeys(data))
+	}
+}
+
+func TestWebserverHandlerEventsMode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &handler{
+		StateInput:    make(chan []byte),
+		Configuration: &config.Configuration{},
+	}
+	w.Start(ctx)
+	defer w.Shutdown()
+
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	if status := getJson(t, ts.URL+"/events?mode=unknown", nil); status != http.StatusBadRequest {
+		t.Error("unexpected status code for invalid mode: ", status)
+	}
+}
@@ -1,18 +1,24 @@
 package webserver
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/metrics"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/packagemanager"
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
 	log "github.com/sirupsen/logrus"
@@ -22,23 +28,6 @@ type contextKey string
 
 const authenticatedKey contextKey = "Authenticated"
 
-type basicAuthMiddleware struct {
-	Username string
-	Password string
-}
-
-func (b *basicAuthMiddleware) Middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user, password, ok := r.BasicAuth()
-		if !ok || user != b.Username || password != b.Password {
-			log.Infoln("Webserver: Invalid username or password from client: ", r.RemoteAddr)
-			http.Error(w, "Forbidden", http.StatusForbidden)
-		} else {
-			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authenticatedKey, true)))
-		}
-	})
-}
-
 func tlsAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
@@ -50,6 +39,13 @@ func tlsAuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// socketAuthMiddleware authenticates all requests, the access to the unix domain socket is restricted by its file permissions
+func socketAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authenticatedKey, true)))
+	})
+}
+
 func debugMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Debugln("Webserver: Request: ", r.RemoteAddr, " ", r.Method, " ", r.URL)
@@ -71,19 +67,35 @@ type handler struct {
 	PrometheusInput     <-chan map[string]string
 	PackageManagerInput <-chan packagemanager.PackageInfo
 	Reloader            Reloader
+	CheckExecutor       CheckExecutor
 	Configuration       *config.Configuration
+	// History stores the last check results (optional)
+	History *history
+	// RunLimiter limits the on-demand check executions (optional)
+	RunLimiter *runLimiter
+	// Certificates serves the tls certificates, nil if tls is disabled
+	Certificates *certificateStore
 
 	mtx                 sync.RWMutex
 	prometheusMtx       sync.RWMutex
 	packageManagerMtx   sync.RWMutex
 	shutdown            chan struct{}
 	state               []byte
+	stateSections       map[string]json.RawMessage
+	stateTimestamp      int64
 	prometheusState     map[string]string
 	packageManagerState packagemanager.PackageInfo
+	events              *eventBroker
 	wg                  sync.WaitGroup
 
-	router              *mux.Router
+	routers             map[routerAuth]*mux.Router
 	basicAuthMiddleware *basicAuthMiddleware
+
+	// closing is closed before the server closes the connections, so running configuration pushes can respond
+	closing       chan struct{}
+	closed        bool
+	pushMtx       sync.Mutex
+	pushResponses sync.WaitGroup
 }
 
 func (w *handler) getState() []byte {
@@ -100,6 +112,17 @@ func (w *handler) setState(newState []byte) {
 	defer w.mtx.Unlock()
 	log.Debugln("Webserver: set new state")
 	w.state = newState
+	w.stateTimestamp = time.Now().Unix()
+
+	// keep the results of the single checks for the /checks endpoints
+	w.stateSections = map[string]json.RawMessage{}
+	if err := json.Unmarshal(newState, &w.stateSections); err != nil {
+		log.Errorln("Webserver: could not parse check result: ", err)
+	}
+
+	if err := w.History.add(newState); err != nil {
+		log.Errorln("Webserver: could not store check result history: ", err)
+	}
 }
 
 func (w *handler) getPrometheusState() map[string]string {
@@ -166,6 +189,48 @@ func (w *handler) handleStatus(response http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+// handleMetrics returns the results of the built-in checks and custom checks in the OpenMetrics text format
+func (w *handler) handleMetrics(response http.ResponseWriter, _ *http.Request) {
+	buf := &bytes.Buffer{}
+	if err := metrics.Write(buf, w.getState()); err != nil {
+		log.Errorln("Webserver: Could not create metrics: ", err)
+		http.Error(response, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Add("Content-Type", metrics.ContentType)
+	response.WriteHeader(http.StatusOK)
+	if _, err := response.Write(buf.Bytes()); err != nil {
+		log.Errorln("Webserver: ", err)
+	}
+}
+
+func (w *handler) handleHistory(response http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query() // ?check=disks&since=1700000000
+
+	var since int64
+	if s := query.Get("since"); s != "" {
+		var err error
+		if since, err = strconv.ParseInt(s, 10, 64); err != nil {
+			http.Error(response, "invalid since timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+
+	data, err := json.Marshal(w.History.get(query.Get("check"), since))
+	if err != nil {
+		log.Errorln("Webserver: Could not create json for history: ", err)
+		http.Error(response, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Add("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	if _, err := response.Write(data); err != nil {
+		log.Errorln("Webserver: ", err)
+	}
+}
+
 func (w *handler) handlePrometheusExporterStatus(response http.ResponseWriter, r *http.Request) {
 	exporter := r.URL.Query().Get("exporter") // ?exporter=node_exporter
 
@@ -235,6 +300,23 @@ type configurationPush struct {
 	Configuration                   string `json:"configuration"`
 	CustomCheckConfiguration        string `json:"customcheck_configuration"`
 	PrometheusExporterConfiguration string `json:"prometheus_exporter"`
+
+	// The formats (ini, yaml or toml) are detected by the file extension of the configuration files
+	// They are optional for a push, but if set they have to match the format of the file in use
+	ConfigurationFormat                   string `json:"configuration_format,omitempty"`
+	CustomCheckConfigurationFormat        string `json:"customcheck_configuration_format,omitempty"`
+	PrometheusExporterConfigurationFormat string `json:"prometheus_exporter_format,omitempty"`
+}
+
+// checkFormat returns an error if the pushed format does not match the format of the file
+func checkFormat(name, pushed, path string) error {
+	if pushed == "" {
+		return nil
+	}
+	if format := config.Format(path); !strings.EqualFold(pushed, format) {
+		return fmt.Errorf("%s format %s does not match the format %s of %s", name, pushed, format, path)
+	}
+	return nil
 }
 
 func (w *handler) handleConfigRead(response http.ResponseWriter, request *http.Request) {
@@ -247,7 +329,11 @@ func (w *handler) handleConfigRead(response http.ResponseWriter, request *http.R
 		return
 	}
 
-	r := configurationPush{}
+	r := configurationPush{
+		ConfigurationFormat:                   config.Format(w.Configuration.ConfigurationPath),
+		CustomCheckConfigurationFormat:        config.Format(w.Configuration.CustomchecksFilePath),
+		PrometheusExporterConfigurationFormat: config.Format(w.Configuration.Prometheus.ExportersFilePath),
+	}
 
 	data, err := w.Configuration.ReadConfigurationFile()
 	if err != nil {
@@ -255,7 +341,14 @@ func (w *handler) handleConfigRead(response http.ResponseWriter, request *http.R
 		http.Error(response, "internal server error", http.StatusInternalServerError)
 		return
 	}
-	r.Configuration = base64.StdEncoding.EncodeToString(data)
+	// Secrets like the api key or the basic auth credentials never leave the agent
+	redacted, err := config.RedactSecrets(data)
+	if err != nil {
+		log.Errorln("Webserver: Could not redact configuration file: ", err)
+		http.Error(response, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	r.Configuration = base64.StdEncoding.EncodeToString(redacted)
 
 	data = w.Configuration.ReadCustomCheckConfiguration()
 	r.CustomCheckConfiguration = base64.StdEncoding.EncodeToString(data)
@@ -276,73 +369,279 @@ func (w *handler) handleConfigRead(response http.ResponseWriter, request *http.R
 	}
 }
 
-func (w *handler) handleConfigPush(response http.ResponseWriter, request *http.Request) {
-	defer func() {
-		_ = request.Body.Close()
-	}()
-
-	if !w.Configuration.ConfigUpdate {
-		http.Error(response, "config update is disabled", http.StatusForbidden)
-		return
-	}
-
+// readConfigurationPush decodes the configurationPush of the request body and returns the new content of the
+// configuration, custom check and Prometheus exporter files. Writes an error response if the push is invalid.
+func (w *handler) readConfigurationPush(response http.ResponseWriter, request *http.Request) ([]*config.File, bool) {
 	body, err := io.ReadAll(request.Body)
 	if err != nil {
 		log.Errorln("Webserver: Could not read body: ", err)
 		http.Error(response, "could not read body", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 
 	r := configurationPush{}
 	if err := json.Unmarshal(body, &r); err != nil {
 		log.Errorln("Webserver: Could not parse json for configuration push: ", err)
 		http.Error(response, "invalid json or base64 string", http.StatusInternalServerError)
-		return
+		return nil, false
+	}
+
+	for _, err := range []error{
+		checkFormat("configuration", r.ConfigurationFormat, w.Configuration.ConfigurationPath),
+		checkFormat("custom check configuration", r.CustomCheckConfigurationFormat, w.Configuration.CustomchecksFilePath),
+		checkFormat("Prometheus Exporter configuration", r.PrometheusExporterConfigurationFormat, w.Configuration.Prometheus.ExportersFilePath),
+	} {
+		if err != nil {
+			log.Errorln("Webserver: ", err)
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return nil, false
+		}
 	}
 
 	cfgData, err := base64.StdEncoding.DecodeString(r.Configuration)
 	if err != nil {
 		log.Errorln("Webserver: Could not decode configuration string for configuration push: ", err)
 		http.Error(response, "invalid json or base64 string", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 
 	cccData, err := base64.StdEncoding.DecodeString(r.CustomCheckConfiguration)
 	if err != nil {
 		log.Errorln("Webserver: Could not decode custom check configuration string for configuration push: ", err)
 		http.Error(response, "invalid json or base64 string", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 
 	prometheusData, err := base64.StdEncoding.DecodeString(r.PrometheusExporterConfiguration)
 	if err != nil {
 		log.Errorln("Webserver: Could not decode Prometheus Exporter configuration string for configuration push: ", err)
 		http.Error(response, "invalid json or base64 string", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 
 	if len(cfgData) == 0 {
 		log.Errorln("Webserver: received empty configuration for configuration push: ", err)
 		http.Error(response, "invalid json or base64 string", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// Keep the current secrets if the configuration was read with redacted secrets before
+	if current, err := w.Configuration.ReadConfigurationFile(); err == nil {
+		if cfgData, err = config.RestoreSecrets(cfgData, current); err != nil {
+			log.Errorln("Webserver: Could not restore secrets for configuration push: ", err)
+			http.Error(response, "could not restore redacted secrets", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+
+	return []*config.File{
+		{Path: w.Configuration.ConfigurationPath, Data: cfgData},
+		{Path: w.Configuration.CustomchecksFilePath, Data: cccData},
+		{Path: w.Configuration.Prometheus.ExportersFilePath, Data: prometheusData},
+	}, true
+}
+
+func (w *handler) handleConfigPush(response http.ResponseWriter, request *http.Request) {
+	defer func() {
+		_ = request.Body.Close()
+	}()
+
+	if !w.Configuration.ConfigUpdate {
+		http.Error(response, "config update is disabled", http.StatusForbidden)
 		return
 	}
 
-	if err := w.Configuration.SaveConfiguration(cfgData); err != nil {
-		log.Errorln("Webserver: ", err)
+	files, ok := w.readConfigurationPush(response, request)
+	if !ok {
+		return
+	}
+
+	// Nothing gets touched if any of the files is invalid
+	validationErrors, err := validatePushedFiles(files)
+	if err != nil {
+		log.Errorln("Webserver: Could not validate configuration push: ", err)
+		writeConfigurationPushResult(response, http.StatusInternalServerError, &configurationPushResult{
+			Message: "could not validate configuration",
+		})
+		return
+	}
+	result := &configurationPushResult{}
+	for _, e := range validationErrors {
+		log.Warningln("Webserver: Configuration push: ", e)
+		result.Errors = append(result.Errors, e.Error())
+	}
+	if config.HasErrors(validationErrors) {
+		result.Message = "invalid configuration"
+		writeConfigurationPushResult(response, http.StatusBadRequest, result)
+		return
 	}
 
-	if err := w.Configuration.SaveCustomCheckConfiguration(cccData); err != nil {
+	pushed := []*config.File{}
+	for _, file := range files {
+		if file.Path != "" {
+			pushed = append(pushed, file)
+		}
+	}
+	backup, err := config.ReplaceFiles(pushed)
+	if err != nil {
 		log.Errorln("Webserver: ", err)
+		result.Message = "could not save configuration: " + err.Error()
+		writeConfigurationPushResult(response, http.StatusInternalServerError, result)
+		return
 	}
 
-	if err := w.Configuration.SavePrometheusExporterConfiguration(prometheusData); err != nil {
+	if w.Reloader == nil {
+		result.Success = true
+		result.Message = "configuration saved"
+		writeConfigurationPushResult(response, http.StatusOK, result)
+		return
+	}
+
+	if w.beginPushResponse() {
+		defer w.pushResponses.Done()
+	}
+
+	// The reload keeps running if the webserver gets restarted and closes this connection
+	reloadResult := make(chan error, 1)
+	go func() {
+		reloadResult <- w.Reloader.ReloadWithRollback(backup.Restore)
+	}()
+
+	select {
+	case <-w.closing:
+		// The reload restarts the webserver, respond before the connection gets closed
+		result.Success = true
+		result.Message = "configuration saved, the webserver restarts to apply it"
+		writeConfigurationPushResult(response, http.StatusAccepted, result)
+		if f, ok := response.(http.Flusher); ok {
+			f.Flush()
+		}
+	case err := <-reloadResult:
+		if err != nil {
+			result.Message = "configuration rolled back: " + err.Error()
+			writeConfigurationPushResult(response, http.StatusInternalServerError, result)
+			return
+		}
+		result.Success = true
+		result.Message = "configuration applied"
+		writeConfigurationPushResult(response, http.StatusOK, result)
+	case <-request.Context().Done():
+		log.Debugln("Webserver: Connection closed during reload after configuration push")
+	}
+}
+
+type configurationPushResult struct {
+	Success bool     `json:"success"`
+	Message string   `json:"message"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+func writeConfigurationPushResult(response http.ResponseWriter, status int, result *configurationPushResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Errorln("Webserver: Could not create json for configuration push: ", err)
+		http.Error(response, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	response.Header().Add("Content-Type", "application/json")
+	// the response is complete after a flush, even if the server closes the connection afterwards
+	response.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	response.WriteHeader(status)
+	if _, err := response.Write(data); err != nil {
 		log.Errorln("Webserver: ", err)
 	}
+}
 
-	if w.Reloader != nil {
-		// Reload Agent Instance via Reloader interface
-		go w.Reloader.Reload()
+// beginPushResponse registers a configuration push which waits for the reload, returns false if the server
+// gets closed already
+func (w *handler) beginPushResponse() bool {
+	w.pushMtx.Lock()
+	defer w.pushMtx.Unlock()
+	if w.closed {
+		return false
 	}
+	w.pushResponses.Add(1)
+	return true
+}
+
+// beforeClose notifies the running configuration pushes that the server closes the connections and waits until
+// they sent their response
+func (w *handler) beforeClose() {
+	w.pushMtx.Lock()
+	if !w.closed && w.closing != nil {
+		close(w.closing)
+	}
+	w.closed = true
+	w.pushMtx.Unlock()
+	w.pushResponses.Wait()
+}
+
+// pushedFiles are the files of a configuration push written to a temporary directory
+type pushedFiles struct {
+	dir string
+	// paths of the temporary configuration, custom check and Prometheus exporter files (empty if not used)
+	paths []string
+	// realPaths maps the temporary files to the real configuration files
+	realPaths map[string]string
+}
+
+// writePushedFiles writes the pushed files to a temporary directory
+// The caller has to remove the directory with remove
+func writePushedFiles(files []*config.File) (*pushedFiles, error) {
+	tmpDir, err := os.MkdirTemp("", "openitcockpit-agent-push-*")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pushedFiles{
+		dir:       tmpDir,
+		paths:     make([]string, len(files)),
+		realPaths: map[string]string{},
+	}
+	// keep the file names, so the format gets detected by the extension
+	for i, file := range files {
+		if file.Path == "" {
+			continue
+		}
+		dir := filepath.Join(tmpDir, strconv.Itoa(i))
+		if err := os.Mkdir(dir, 0700); err != nil {
+			p.remove()
+			return nil, err
+		}
+		p.paths[i] = filepath.Join(dir, filepath.Base(file.Path))
+		if err := os.WriteFile(p.paths[i], file.Data, 0600); err != nil {
+			p.remove()
+			return nil, err
+		}
+		p.realPaths[p.paths[i]] = file.Path
+	}
+	return p, nil
+}
+
+func (p *pushedFiles) remove() {
+	_ = os.RemoveAll(p.dir)
+}
+
+// validate the pushed files. The file names of the validation errors are the names of the real configuration files
+func (p *pushedFiles) validate() []*config.ValidationError {
+	errs := config.ValidateFiles(p.paths[0], p.paths[1], p.paths[2])
+	for _, e := range errs {
+		if path, ok := p.realPaths[e.File]; ok {
+			e.File = path
+		}
+	}
+	return errs
+}
+
+// validatePushedFiles writes the pushed files to a temporary directory and validates them
+func validatePushedFiles(files []*config.File) ([]*config.ValidationError, error) {
+	p, err := writePushedFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	defer p.remove()
+
+	return p.validate(), nil
 }
 
 func (w *handler) handlerCsr(response http.ResponseWriter, request *http.Request) {
@@ -415,62 +714,130 @@ func (w *handler) handlerUpdateCert(response http.ResponseWriter, request *http.
 
 	log.Debugln("Webserver: Certificate update successful, start reload")
 
+	// Use the new certificate for the next connections without a restart of the webserver
+	w.Certificates.reload()
 	if w.Reloader != nil {
+		// a restart is still required if tls was not enabled yet
 		go w.Reloader.Reload()
 	}
 }
 
+// routerAuth is the authentication of a router
+type routerAuth struct {
+	// tls requires a client certificate if AutoSSL is enabled
+	tls bool
+	// basic requires the basic auth credentials if basic auth is configured
+	basic bool
+	// trusted authenticates all requests, used for the unix domain socket
+	trusted bool
+}
+
 // Handler can be used by http.Server to handle http connections
 func (w *handler) Handler() *mux.Router {
+	return w.routerFor(routerAuth{tls: true, basic: true})
+}
+
+// ListenHandler can be used by http.Server to handle the connections of a listener with its own authentication
+// policy, tlsAuth requires a client certificate if AutoSSL is enabled, basicAuth the configured credentials
+func (w *handler) ListenHandler(tlsAuth, basicAuth bool) *mux.Router {
+	return w.routerFor(routerAuth{tls: tlsAuth, basic: basicAuth})
+}
+
+// SocketHandler can be used by http.Server to handle the connections of the unix domain socket
+// There is no authentication, the access is restricted by the permissions of the socket file
+func (w *handler) SocketHandler() *mux.Router {
+	return w.routerFor(routerAuth{trusted: true})
+}
+
+// routerFor returns the router with the given authentication, the routers are created on first use
+func (w *handler) routerFor(auth routerAuth) *mux.Router {
 	w.mtx.Lock()
 	defer w.mtx.Unlock()
 	w.prometheusMtx.Lock()
 	defer w.prometheusMtx.Unlock()
-	if w.router == nil {
-		routes := mux.NewRouter()
-		if log.GetLevel() == log.DebugLevel {
-			log.Debugln("Webserver: Activate Handler Debug Middleware")
-			routes.Use(debugMiddleware)
-		}
-		if isAutosslEnabled(w.Configuration) {
-			log.Infoln("Webserver: Activate TLS authentication")
-			routes.Use(tlsAuthMiddleware)
-		}
-		if w.Configuration.BasicAuth != "" {
-			log.Infoln("Webserver: Activate Basic authentication")
-			cred := strings.SplitN(w.Configuration.BasicAuth, ":", 2)
-			if len(cred) != 2 {
-				log.Fatalln("Webserver: Invalid basic auth configuration")
-			}
-			w.basicAuthMiddleware = &basicAuthMiddleware{
-				Username: cred[0],
-				Password: cred[1],
-			}
+	if w.routers == nil {
+		w.routers = map[routerAuth]*mux.Router{}
+	}
+	if router, ok := w.routers[auth]; ok {
+		return router
+	}
+	router := w.newRouter(auth)
+	w.routers[auth] = router
+	return router
+}
+
+// configureBasicAuth parses the basic auth users of the configuration, must be called with w.mtx locked or
+// before the handler gets used
+func (w *handler) configureBasicAuth() error {
+	if w.basicAuthMiddleware != nil || w.Configuration.BasicAuth == "" {
+		return nil
+	}
+	users, err := config.ParseBasicAuth(w.Configuration.BasicAuth)
+	if err != nil {
+		return fmt.Errorf("invalid basic auth configuration: %w", err)
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("invalid basic auth configuration: no users")
+	}
+	// all routers share the middleware, so a verified password hash is cached for all listeners
+	w.basicAuthMiddleware = newBasicAuthMiddleware(users)
+	return nil
+}
+
+// newRouter creates the router with all routes and the given authentication
+func (w *handler) newRouter(auth routerAuth) *mux.Router {
+	routes := mux.NewRouter()
+	if log.GetLevel() == log.DebugLevel {
+		log.Debugln("Webserver: Activate Handler Debug Middleware")
+		routes.Use(debugMiddleware)
+	}
+	if auth.trusted {
+		routes.Use(socketAuthMiddleware)
+	}
+	if auth.tls && isAutosslEnabled(w.Configuration) {
+		log.Infoln("Webserver: Activate TLS authentication")
+		routes.Use(tlsAuthMiddleware)
+	}
+	if auth.basic && w.Configuration.BasicAuth != "" {
+		log.Infoln("Webserver: Activate Basic authentication")
+		if err := w.configureBasicAuth(); err != nil {
+			// the server rejects an invalid basic auth on reload, never serve requests without authentication
+			log.Errorln("Webserver: ", err)
+			routes.Use(denyMiddleware)
+		} else {
 			routes.Use(w.basicAuthMiddleware.Middleware)
 		}
-		routes.Path("/").Methods("GET").HandlerFunc(w.handleStatus)
-		routes.Path("/prometheus").Methods("GET").HandlerFunc(w.handlePrometheusExporterStatus)
-		routes.Path("/packages").Methods("GET").HandlerFunc(w.handlePackageManagerStatus)
-		routes.Path("/config").Methods("GET").HandlerFunc(w.handleConfigRead)
-		routes.Path("/config").Methods("POST").HandlerFunc(w.handleConfigPush)
-		routes.Path("/autotls").Methods("GET").HandlerFunc(w.handlerCsr)
-		routes.Path("/autotls").Methods("POST").HandlerFunc(w.handlerUpdateCert)
-
-		if w.Configuration.EnablePPROF {
-			routes.Path("/debug/pprof/").HandlerFunc(pprof.Index)
-			routes.Path("/debug/pprof/cmdline").HandlerFunc(pprof.Cmdline)
-			routes.Path("/debug/pprof/profile").HandlerFunc(pprof.Profile)
-			routes.Path("/debug/pprof/symbol").HandlerFunc(pprof.Symbol)
-			routes.Path("/debug/pprof/trace").HandlerFunc(pprof.Trace)
-			routes.Path("/debug/pprof/block").Handler(pprof.Handler("block"))
-			routes.Path("/debug/pprof/goroutine").Handler(pprof.Handler("goroutine"))
-			routes.Path("/debug/pprof/heap").Handler(pprof.Handler("heap"))
-			routes.Path("/debug/pprof/threadcreate").Handler(pprof.Handler("threadcreate"))
-		}
-
-		w.router = routes
 	}
-	return w.router
+	routes.Path("/").Methods("GET").HandlerFunc(w.handleStatus)
+	routes.Path("/history").Methods("GET").HandlerFunc(w.handleHistory)
+	routes.Path("/events").Methods("GET").HandlerFunc(w.handleEvents)
+	routes.Path("/metrics").Methods("GET").HandlerFunc(w.handleMetrics)
+	routes.Path("/checks").Methods("GET").HandlerFunc(w.handleChecks)
+	routes.Path("/checks/{name}").Methods("GET").HandlerFunc(w.handleCheck)
+	routes.Path("/checks/{name}/run").Methods("POST").HandlerFunc(w.handleCheckRun)
+	routes.Path("/customchecks/{name}").Methods("GET").HandlerFunc(w.handleCustomCheck)
+	routes.Path("/customchecks/{name}/run").Methods("POST").HandlerFunc(w.handleCustomCheckRun)
+	routes.Path("/prometheus").Methods("GET").HandlerFunc(w.handlePrometheusExporterStatus)
+	routes.Path("/packages").Methods("GET").HandlerFunc(w.handlePackageManagerStatus)
+	routes.Path("/config").Methods("GET").HandlerFunc(w.handleConfigRead)
+	routes.Path("/config").Methods("POST").HandlerFunc(w.handleConfigPush)
+	routes.Path("/config/diff").Methods("POST").HandlerFunc(w.handleConfigDiff)
+	routes.Path("/autotls").Methods("GET").HandlerFunc(w.handlerCsr)
+	routes.Path("/autotls").Methods("POST").HandlerFunc(w.handlerUpdateCert)
+
+	if w.Configuration.EnablePPROF {
+		routes.Path("/debug/pprof/").HandlerFunc(pprof.Index)
+		routes.Path("/debug/pprof/cmdline").HandlerFunc(pprof.Cmdline)
+		routes.Path("/debug/pprof/profile").HandlerFunc(pprof.Profile)
+		routes.Path("/debug/pprof/symbol").HandlerFunc(pprof.Symbol)
+		routes.Path("/debug/pprof/trace").HandlerFunc(pprof.Trace)
+		routes.Path("/debug/pprof/block").Handler(pprof.Handler("block"))
+		routes.Path("/debug/pprof/goroutine").Handler(pprof.Handler("goroutine"))
+		routes.Path("/debug/pprof/heap").Handler(pprof.Handler("heap"))
+		routes.Path("/debug/pprof/threadcreate").Handler(pprof.Handler("threadcreate"))
+	}
+
+	return routes
 }
 
 func (w *handler) Shutdown() {
@@ -481,6 +848,8 @@ func (w *handler) Shutdown() {
 // Start webserver handler (should NOT run in a go routine)
 func (w *handler) Start(parentCtx context.Context) {
 	w.shutdown = make(chan struct{})
+	w.closing = make(chan struct{})
+	w.events = newEventBroker()
 
 	w.wg.Add(1)
 	go func() {
@@ -502,10 +871,13 @@ func (w *handler) Start(parentCtx context.Context) {
 				return
 			case s := <-w.StateInput:
 				w.setState(s)
+				w.events.publish(checksUpdate(w.getStateSections()))
 			case s := <-w.PrometheusInput:
 				w.setPrometheusState(s)
+				w.events.publish(prometheusUpdate(s))
 			case pkgInfo := <-w.PackageManagerInput:
 				w.setPackageManagerState(pkgInfo)
+				w.events.publish(packagesUpdate(pkgInfo))
 			}
 		}
 	}()
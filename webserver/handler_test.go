@@ -5,14 +5,17 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -94,6 +97,51 @@ func TestWebserverHandlerState(t *testing.T) {
 	w.Shutdown()
 }
 
+func TestWebserverHandlerMetrics(t *testing.T) {
+	stateInput := make(chan []byte)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &handler{
+		StateInput:    stateInput,
+		Configuration: &config.Configuration{},
+	}
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	w.Start(ctx)
+	defer w.Shutdown()
+
+	stateInput <- []byte(`{"memory": {"total": 1024}, "customchecks": {"check_users": {"rc": 2}}}`)
+
+	r, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status code: ", r.StatusCode)
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/openmetrics-text") {
+		t.Error("unexpected content type: ", r.Header.Get("Content-Type"))
+	}
+	for _, expected := range []string{
+		"oitc_agent_memory_total_bytes 1024\n",
+		`oitc_agent_customcheck_status{check="check_users"} 2` + "\n",
+		"# EOF\n",
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("missing %q in:\n%s", expected, body)
+		}
+	}
+}
+
 func TestWebserverHandlerAuthFailed(t *testing.T) {
 	stateInput := make(chan []byte)
 	ctx, cancel := context.WithCancel(context.Background())
@@ -130,14 +178,156 @@ func TestWebserverHandlerAuthFailed(t *testing.T) {
 	if err != nil {
 		t.Fatal("Request failed")
 	}
-	if r.StatusCode != http.StatusForbidden {
-		t.Error("Unexpected status code: ", http.StatusForbidden)
+	if r.StatusCode != http.StatusUnauthorized || r.Header.Get("WWW-Authenticate") == "" {
+		t.Error("Unexpected status code: ", r.StatusCode)
 	}
 	_ = r.Body.Close()
 
 	w.Shutdown()
 }
 
+func TestWebserverHandlerAuthFailedLimit(t *testing.T) {
+	stateInput := make(chan []byte)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &handler{
+		StateInput: stateInput,
+		Configuration: &config.Configuration{
+			BasicAuth: testBasicAuth,
+		},
+	}
+	w.Start(ctx)
+	defer w.Shutdown()
+
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	request := func(user, password string) int {
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		req.SetBasicAuth(user, password)
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Request failed")
+		}
+		_ = r.Body.Close()
+		return r.StatusCode
+	}
+
+	// clients send an anonymous request first, these are no failed logins
+	for i := 0; i < maxFailedLogins*2; i++ {
+		r, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatal("Request failed")
+		}
+		_ = r.Body.Close()
+		if r.StatusCode != http.StatusUnauthorized {
+			t.Fatal("unexpected status code without credentials: ", r.StatusCode)
+		}
+	}
+	if status := request(testBasicAuthUser, testBasicAuthPassword); status != http.StatusOK {
+		t.Error("unexpected status code after anonymous requests: ", status)
+	}
+
+	for i := 0; i < maxFailedLogins; i++ {
+		if status := request(testBasicAuthUser, "wrong"); status != http.StatusForbidden {
+			t.Fatal("unexpected status code: ", status)
+		}
+	}
+	// the password is not verified anymore, even the correct credentials get rejected
+	if status := request(testBasicAuthUser, testBasicAuthPassword); status != http.StatusTooManyRequests {
+		t.Error("unexpected status code after too many failed logins: ", status)
+	}
+
+	w.basicAuthMiddleware.failedMtx.Lock()
+	for _, f := range w.basicAuthMiddleware.failed {
+		f.since = f.since.Add(-failedLoginWindow)
+	}
+	w.basicAuthMiddleware.failedMtx.Unlock()
+	if status := request(testBasicAuthUser, testBasicAuthPassword); status != http.StatusOK {
+		t.Error("unexpected status code after the failed login window: ", status)
+	}
+}
+
+func TestWebserverHandlerInvalidBasicAuth(t *testing.T) {
+	stateInput := make(chan []byte)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &handler{
+		StateInput: stateInput,
+		Configuration: &config.Configuration{
+			BasicAuth: "invalid",
+		},
+	}
+	w.Start(ctx)
+	defer w.Shutdown()
+
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	r, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal("Request failed")
+	}
+	_ = r.Body.Close()
+	if r.StatusCode != http.StatusForbidden {
+		t.Error("unexpected status code: ", r.StatusCode)
+	}
+}
+
+func TestWebserverHandlerAuthHashed(t *testing.T) {
+	stateInput := make(chan []byte)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bcryptHash, err := utils.HashPassword("secret1", utils.PasswordBcrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon2Hash, err := utils.HashPassword("secret2", utils.PasswordArgon2id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &handler{
+		StateInput: stateInput,
+		Configuration: &config.Configuration{
+			BasicAuth: "monitor:" + bcryptHash + " admin:" + argon2Hash + "\n" + testBasicAuth,
+		},
+	}
+	w.Start(ctx)
+	defer w.Shutdown()
+
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	for _, test := range []struct {
+		user     string
+		password string
+		status   int
+	}{
+		{"monitor", "secret1", http.StatusOK},
+		{"monitor", "secret1", http.StatusOK},
+		{"monitor", "secret2", http.StatusForbidden},
+		{"admin", "secret2", http.StatusOK},
+		{"admin", "secret1", http.StatusForbidden},
+		{testBasicAuthUser, testBasicAuthPassword, http.StatusOK},
+		{"unknown", "secret1", http.StatusForbidden},
+	} {
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		req.SetBasicAuth(test.user, test.password)
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Request failed")
+		}
+		_ = r.Body.Close()
+		if r.StatusCode != test.status {
+			t.Errorf("unexpected status code %d for %s:%s", r.StatusCode, test.user, test.password)
+		}
+	}
+}
+
 func TestWebserverHandlerConfig(t *testing.T) {
 	state := make(chan []byte)
 	ctx, cancel := context.WithCancel(context.Background())
@@ -230,3 +420,450 @@ func TestWebserverHandlerConfig(t *testing.T) {
 
 	w.Shutdown()
 }
+
+func TestWebserverHandlerConfigYaml(t *testing.T) {
+	state := make(chan []byte)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpdir)
+	}()
+	cfgPath := filepath.Join(tmpdir, "config.yaml")
+
+	w := &handler{
+		StateInput: state,
+		Configuration: &config.Configuration{
+			ConfigurationPath:    cfgPath,
+			CustomchecksFilePath: filepath.Join(tmpdir, "customchecks.yaml"),
+			ConfigUpdate:         true,
+			Prometheus: &config.PrometheusConfiguration{
+				ExportersFilePath: filepath.Join(tmpdir, "prometheus_exporters.toml"),
+			},
+		},
+	}
+
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	w.Start(ctx)
+	defer w.Shutdown()
+
+	push := func(cp *configurationPush) int {
+		data, err := json.Marshal(cp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(ts.URL+"/config", "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := resp.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if code := push(&configurationPush{
+		Configuration:       base64.StdEncoding.EncodeToString([]byte("[default]\n")),
+		ConfigurationFormat: "ini",
+	}); code != http.StatusBadRequest {
+		t.Error("expected status code 400 for format mismatch, got ", code)
+	}
+
+	if code := push(&configurationPush{
+		Configuration:       base64.StdEncoding.EncodeToString([]byte("default:\n  port: 3333\n")),
+		ConfigurationFormat: "yaml",
+	}); code != http.StatusOK {
+		t.Error("expected status code 200, got ", code)
+	}
+
+	resp, err := http.Get(ts.URL + "/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cp := &configurationPush{}
+	if err := json.Unmarshal(body, cp); err != nil {
+		t.Fatal(err)
+	}
+	if cp.ConfigurationFormat != "yaml" || cp.CustomCheckConfigurationFormat != "yaml" || cp.PrometheusExporterConfigurationFormat != "toml" {
+		t.Error("unexpected formats: ", cp.ConfigurationFormat, cp.CustomCheckConfigurationFormat, cp.PrometheusExporterConfigurationFormat)
+	}
+	cfg, err := base64.StdEncoding.DecodeString(cp.Configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cfg) != "default:\n  port: 3333\n" {
+		t.Error("unexpected response for configuration get: ", string(cfg))
+	}
+}
+
+func TestWebserverHandlerConfigSecrets(t *testing.T) {
+	state := make(chan []byte)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpdir)
+	}()
+	cfgPath := filepath.Join(tmpdir, "config.ini")
+	cfgData := "[default]\nport = 3333\n\n[oitc]\napikey = verysecret\n"
+	if err := os.WriteFile(cfgPath, []byte(cfgData), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &handler{
+		StateInput: state,
+		Configuration: &config.Configuration{
+			ConfigurationPath: cfgPath,
+			ConfigUpdate:      true,
+			Prometheus:        &config.PrometheusConfiguration{},
+		},
+	}
+
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	w.Start(ctx)
+	defer w.Shutdown()
+
+	resp, err := http.Get(ts.URL + "/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cp := &configurationPush{}
+	if err := json.Unmarshal(body, cp); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := base64.StdEncoding.DecodeString(cp.Configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(cfg), "verysecret") {
+		t.Fatal("configuration read returned the api key")
+	}
+
+	// push the redacted configuration back with a changed port
+	cp.Configuration = base64.StdEncoding.EncodeToString(bytes.Replace(cfg, []byte("3333"), []byte("3334"), 1))
+	data, err := json.Marshal(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Post(ts.URL+"/config", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := os.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != strings.Replace(cfgData, "3333", "3334", 1) {
+		t.Error("unexpected saved configuration: ", string(saved))
+	}
+}
+
+type testReloader struct {
+	err error
+	cfg *config.Configuration
+}
+
+func (r *testReloader) Reload() {}
+
+func (r *testReloader) Configuration() *config.Configuration {
+	return r.cfg
+}
+
+func (r *testReloader) ReloadWithRollback(restore func() error) error {
+	if r.err != nil {
+		if err := restore(); err != nil {
+			return err
+		}
+	}
+	return r.err
+}
+
+func TestWebserverHandlerConfigPushTransaction(t *testing.T) {
+	state := make(chan []byte)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpdir)
+	}()
+	cfgPath := filepath.Join(tmpdir, "config.ini")
+	ccPath := filepath.Join(tmpdir, "customchecks.ini")
+	oldCfg := "[default]\nport = 3333\n"
+	if err := os.WriteFile(cfgPath, []byte(oldCfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reloader := &testReloader{}
+	w := &handler{
+		StateInput: state,
+		Reloader:   reloader,
+		Configuration: &config.Configuration{
+			ConfigurationPath:    cfgPath,
+			CustomchecksFilePath: ccPath,
+			ConfigUpdate:         true,
+			Prometheus:           &config.PrometheusConfiguration{},
+		},
+	}
+
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	w.Start(ctx)
+	defer w.Shutdown()
+
+	push := func(cfg, ccc string) (int, *configurationPushResult) {
+		data, err := json.Marshal(&configurationPush{
+			Configuration:            base64.StdEncoding.EncodeToString([]byte(cfg)),
+			CustomCheckConfiguration: base64.StdEncoding.EncodeToString([]byte(ccc)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(ts.URL+"/config", "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		result := &configurationPushResult{}
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, result
+	}
+	readConfig := func() string {
+		data, err := os.ReadFile(cfgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// invalid custom check, nothing gets written
+	code, result := push("[default]\nport = 3334\n", "[check_slow]\ncommand = sleep 1\ninterval = 5\ntimeout = 10\n")
+	if code != http.StatusBadRequest || result.Success || len(result.Errors) != 1 {
+		t.Error("unexpected result for invalid configuration: ", code, result)
+	}
+	if readConfig() != oldCfg {
+		t.Error("configuration was changed by invalid push")
+	}
+	if _, err := os.Stat(ccPath); !os.IsNotExist(err) {
+		t.Error("custom check configuration was written by invalid push")
+	}
+
+	// failed reload gets rolled back
+	reloader.err = errors.New("test error")
+	code, result = push("[default]\nport = 3334\n", "")
+	if code != http.StatusInternalServerError || result.Success || !strings.Contains(result.Message, "test error") {
+		t.Error("unexpected result for failed reload: ", code, result)
+	}
+	if readConfig() != oldCfg {
+		t.Error("configuration was not rolled back")
+	}
+
+	// successful push
+	reloader.err = nil
+	code, result = push("[default]\nport = 3334\n", "")
+	if code != http.StatusOK || !result.Success {
+		t.Error("unexpected result: ", code, result)
+	}
+	if readConfig() != "[default]\nport = 3334\n" {
+		t.Error("configuration was not saved")
+	}
+	backup, err := os.ReadFile(config.BackupPath(cfgPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(backup) != oldCfg {
+		t.Error("unexpected backup: ", string(backup))
+	}
+}
+
+func TestWebserverHandlerHistory(t *testing.T) {
+	stateInput := make(chan []byte)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &handler{
+		StateInput: stateInput,
+		Configuration: &config.Configuration{
+			BasicAuth: "",
+		},
+		History: newHistory(10, 0),
+	}
+	w.Start(ctx)
+
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	stateInput <- []byte(`{"disks": [1], "cpu": 1}`)
+	stateInput <- []byte(`{"disks": [2], "cpu": 2}`)
+	// the handler received the second state, so the first one is stored for sure
+	stateInput <- []byte(`{"disks": [3], "cpu": 3}`)
+
+	r, err := http.Get(ts.URL + "/history?check=disks&since=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Body.Close()
+
+	res := map[string][]*historyEntry{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || len(res["disks"]) < 2 {
+		t.Fatal("unexpected history: ", string(body))
+	}
+	if string(res["disks"][0].Result) != "[1]" {
+		t.Error("unexpected first result: ", string(res["disks"][0].Result))
+	}
+
+	r, err = http.Get(ts.URL + "/history?since=invalid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Body.Close()
+	if r.StatusCode != http.StatusBadRequest {
+		t.Error("unexpected status code: ", r.StatusCode)
+	}
+
+	w.Shutdown()
+}
+
+func TestWebserverHandlerConfigDiff(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpdir)
+	}()
+	cfgPath := filepath.Join(tmpdir, "config.ini")
+	ccPath := filepath.Join(tmpdir, "customchecks.ini")
+	cfgData := "[default]\nport = 3333\ncustomchecks = " + ccPath + "\n\n[oitc]\napikey = verysecret\n"
+	ccData := "[check_a]\ncommand = whoami\nenabled = true\n"
+	if err := os.WriteFile(cfgPath, []byte(cfgData), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ccPath, []byte(ccData), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Load(context.Background(), cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ConfigUpdate = true
+
+	w := &handler{
+		StateInput:    make(chan []byte),
+		Configuration: cfg,
+	}
+	ts := httptest.NewServer(w.Handler())
+	defer ts.Close()
+
+	cp := &configurationPush{
+		Configuration: base64.StdEncoding.EncodeToString(
+			[]byte("[default]\nport = 3334\ncustomchecks = " + ccPath + "\n\n[oitc]\napikey = \"********\"\n"),
+		),
+		CustomCheckConfiguration: base64.StdEncoding.EncodeToString(
+			[]byte("[check_b]\ncommand = whoami\nenabled = true\n"),
+		),
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(ts.URL+"/config/diff", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status code: ", resp.StatusCode, string(body))
+	}
+
+	result := &configurationDiffResult{}
+	if err := json.Unmarshal(body, result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid {
+		t.Error("expected valid configuration: ", result.Errors)
+	}
+	if len(result.ChangedKeys) != 1 || result.ChangedKeys[0].Key != "default.port" || result.ChangedKeys[0].New != "3334" {
+		t.Errorf("unexpected changed keys: %s", body)
+	}
+	if len(result.CustomChecksAdded) != 1 || result.CustomChecksAdded[0] != "check_b" {
+		t.Error("unexpected added custom checks: ", result.CustomChecksAdded)
+	}
+	if len(result.CustomChecksRemoved) != 1 || result.CustomChecksRemoved[0] != "check_a" {
+		t.Error("unexpected removed custom checks: ", result.CustomChecksRemoved)
+	}
+	if !result.WebserverRestart {
+		t.Error("expected webserver restart")
+	}
+	if result.TLSChange || result.PushRestart {
+		t.Error("unexpected tls change or push restart")
+	}
+	if strings.Contains(string(body), "verysecret") {
+		t.Error("diff returned the api key")
+	}
+
+	for path, expected := range map[string]string{cfgPath: cfgData, ccPath: ccData} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Error("file was changed by diff: ", path)
+		}
+		if _, err := os.Stat(config.BackupPath(path)); !os.IsNotExist(err) {
+			t.Error("backup was created by diff: ", path)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package webserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// historyIgnoredSections are not recorded in the history, agent_runtime is the telemetry of the agent itself
+// and changes with every check run, so it would use up the history without containing check results
+var historyIgnoredSections = map[string]bool{
+	"agent_runtime": true,
+}
+
+type historyEntry struct {
+	Timestamp int64           `json:"timestamp"`
+	Result    json.RawMessage `json:"result"`
+}
+
+// history keeps the last check results of each check in memory
+// All methods are safe to call on a nil history
+type history struct {
+	mtx sync.RWMutex
+
+	// maxEntries is the number of results kept per check
+	maxEntries int
+	// maxBytes limits the size of all stored results, the oldest results get dropped first (0 = unlimited)
+	maxBytes int
+
+	bytes  int
+	checks map[string][]*historyEntry
+}
+
+func newHistory(maxEntries, maxBytes int) *history {
+	return &history{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		checks:     map[string][]*historyEntry{},
+	}
+}
+
+// configure changes the limits of the history, results exceeding the new limits get dropped
+func (h *history) configure(maxEntries, maxBytes int) {
+	if h == nil {
+		return
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.maxEntries = maxEntries
+	h.maxBytes = maxBytes
+	for name := range h.checks {
+		h.trimCheck(name)
+	}
+	h.trimBytes()
+}
+
+// trimCheck drops the oldest results of the check exceeding maxEntries
+func (h *history) trimCheck(name string) {
+	entries := h.checks[name]
+	for len(entries) > 0 && len(entries) > h.maxEntries {
+		h.bytes -= len(entries[0].Result)
+		entries[0] = nil
+		entries = entries[1:]
+	}
+	if len(entries) == 0 {
+		delete(h.checks, name)
+		return
+	}
+	h.checks[name] = entries
+}
+
+// trimBytes drops the oldest results of all checks until the history fits into maxBytes
+func (h *history) trimBytes() {
+	for h.maxBytes > 0 && h.bytes > h.maxBytes {
+		oldest := ""
+		for name, entries := range h.checks {
+			if oldest == "" || entries[0].Timestamp < h.checks[oldest][0].Timestamp {
+				oldest = name
+			}
+		}
+		if oldest == "" {
+			return
+		}
+
+		entries := h.checks[oldest]
+		h.bytes -= len(entries[0].Result)
+		entries[0] = nil
+		if len(entries) == 1 {
+			delete(h.checks, oldest)
+		} else {
+			h.checks[oldest] = entries[1:]
+		}
+	}
+}
+
+// add stores the result of each check of the given serialized check result
+// The state contains the last result of all checks, so results which did not change since the last state
+// (e.g. of checks with a longer interval) are not stored again
+func (h *history) add(state []byte) error {
+	if h == nil {
+		return nil
+	}
+
+	results := map[string]json.RawMessage{}
+	if err := json.Unmarshal(state, &results); err != nil {
+		return err
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if h.maxEntries <= 0 {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	for name, result := range results {
+		if historyIgnoredSections[name] {
+			continue
+		}
+		if entries := h.checks[name]; len(entries) > 0 && bytes.Equal(entries[len(entries)-1].Result, result) {
+			continue
+		}
+		h.checks[name] = append(h.checks[name], &historyEntry{
+			Timestamp: now,
+			Result:    result,
+		})
+		h.bytes += len(result)
+		h.trimCheck(name)
+	}
+	h.trimBytes()
+	return nil
+}
+
+// get returns all stored results of the check since the given unix timestamp (inclusive)
+// If check is empty, the results of all checks get returned
+func (h *history) get(check string, since int64) map[string][]*historyEntry {
+	res := map[string][]*historyEntry{}
+	if h == nil {
+		return res
+	}
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	for name, checkEntries := range h.checks {
+		if check != "" && name != check {
+			continue
+		}
+		entries := []*historyEntry{}
+		for _, entry := range checkEntries {
+			if entry.Timestamp >= since {
+				entries = append(entries, entry)
+			}
+		}
+		res[name] = entries
+	}
+	if _, ok := res[check]; check != "" && !ok {
+		res[check] = []*historyEntry{}
+	}
+	return res
+}
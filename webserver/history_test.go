@@ -0,0 +1,104 @@
+package webserver
+
+import (
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	h := newHistory(2, 0)
+
+	for _, state := range []string{
+		`{"cpu": 1, "memory": 10}`,
+		`{"cpu": 2, "memory": 20}`,
+		`{"cpu": 3}`,
+	} {
+		if err := h.add([]byte(state)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res := h.get("cpu", 0)
+	if len(res) != 1 || len(res["cpu"]) != 2 {
+		t.Fatal("unexpected history: ", res)
+	}
+	if string(res["cpu"][0].Result) != "2" || string(res["cpu"][1].Result) != "3" {
+		t.Error("unexpected cpu history: ", string(res["cpu"][0].Result), string(res["cpu"][1].Result))
+	}
+
+	res = h.get("", 0)
+	if len(res) != 2 || len(res["memory"]) != 2 {
+		t.Error("unexpected history: ", res)
+	}
+
+	if res := h.get("unknown", 0); len(res["unknown"]) != 0 {
+		t.Error("unexpected history for unknown check: ", res)
+	}
+
+	if err := h.add([]byte(`invalid`)); err == nil {
+		t.Error("expected error for invalid state")
+	}
+}
+
+func TestHistoryMaxBytes(t *testing.T) {
+	h := newHistory(10, 6)
+
+	for _, state := range []string{
+		`{"cpu": 100}`,
+		`{"cpu": 200}`,
+		`{"cpu": 300}`,
+	} {
+		if err := h.add([]byte(state)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res := h.get("cpu", 0)
+	if len(res["cpu"]) != 2 {
+		t.Fatal("unexpected number of results (2): ", len(res["cpu"]))
+	}
+	if string(res["cpu"][0].Result) != "200" {
+		t.Error("oldest result was not dropped: ", string(res["cpu"][0].Result))
+	}
+
+	h.configure(1, 0)
+	if res := h.get("cpu", 0); len(res["cpu"]) != 1 || string(res["cpu"][0].Result) != "300" {
+		t.Error("unexpected history after configure: ", res)
+	}
+
+	h.configure(0, 0)
+	if res := h.get("", 0); len(res) != 0 {
+		t.Error("history expected to be empty: ", res)
+	}
+}
+
+func TestHistoryIntervalGroups(t *testing.T) {
+	h := newHistory(10, 0)
+
+	// cpu runs every tick, disks every third tick, the state always contains the last result of both
+	for _, state := range []string{
+		`{"cpu": 1, "disks": [1], "agent_runtime": {"checks": {"cpu": {"runs": 1}}}}`,
+		`{"cpu": 2, "disks": [1], "agent_runtime": {"checks": {"cpu": {"runs": 2}}}}`,
+		`{"cpu": 3, "disks": [1], "agent_runtime": {"checks": {"cpu": {"runs": 3}}}}`,
+		`{"cpu": 4, "disks": [2], "agent_runtime": {"checks": {"cpu": {"runs": 4}}}}`,
+		`{"cpu": 5, "disks": [2], "agent_runtime": {"checks": {"cpu": {"runs": 5}}}}`,
+	} {
+		if err := h.add([]byte(state)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res := h.get("", 0)
+	if len(res["cpu"]) != 5 {
+		t.Error("unexpected number of cpu results (5): ", len(res["cpu"]))
+	}
+	if len(res["disks"]) != 2 {
+		t.Fatal("unexpected number of disks results (2): ", len(res["disks"]))
+	}
+	if string(res["disks"][0].Result) != "[1]" || string(res["disks"][1].Result) != "[2]" {
+		t.Error("unexpected disks history: ", string(res["disks"][0].Result), string(res["disks"][1].Result))
+	}
+	// the telemetry of the agent changes with every run and is not part of the history
+	if _, ok := res["agent_runtime"]; ok {
+		t.Error("agent_runtime must not be stored in the history: ", len(res["agent_runtime"]))
+	}
+}
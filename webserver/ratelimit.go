@@ -0,0 +1,60 @@
+package webserver
+
+import (
+	"sync"
+	"time"
+)
+
+// runLimiter limits the on-demand executions of each check
+// All methods are safe to call on a nil runLimiter
+type runLimiter struct {
+	mtx sync.Mutex
+
+	// interval is the minimum time between two executions of the same check
+	interval time.Duration
+	lastRun  map[string]time.Time
+}
+
+func newRunLimiter(interval time.Duration) *runLimiter {
+	return &runLimiter{
+		interval: interval,
+		lastRun:  map[string]time.Time{},
+	}
+}
+
+// configure changes the minimum time between two executions
+func (l *runLimiter) configure(interval time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.interval = interval
+}
+
+// allow reserves an execution of the given key, returns false and the time until the next execution is allowed
+// if the key was executed within the interval
+func (l *runLimiter) allow(key string) (time.Duration, bool) {
+	if l == nil {
+		return 0, true
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	now := time.Now()
+	if last, ok := l.lastRun[key]; ok {
+		if wait := l.interval - now.Sub(last); wait > 0 {
+			return wait, false
+		}
+	}
+	l.lastRun[key] = now
+
+	// drop the keys which are not limited anymore
+	for k, last := range l.lastRun {
+		if now.Sub(last) >= l.interval {
+			delete(l.lastRun, k)
+		}
+	}
+	return 0, true
+}
@@ -1,14 +1,12 @@
 package webserver
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
-	"os"
 	"runtime"
 	"sync"
 	"time"
@@ -19,21 +17,24 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func testPortOpen(address string) bool {
-	timeout := time.Second
-	conn, err := net.DialTimeout("tcp", address, timeout)
-	if err != nil {
-		return false
-	}
-	defer func() {
-		_ = conn.Close()
-	}()
-	return true
-}
-
 // Reloader interface contains a pointer to the agent instance the we can reload the agent on config push
 type Reloader interface {
 	Reload()
+	// ReloadWithRollback reloads the agent after a configuration push, restore gets called to restore the
+	// previous configuration files if the agent could not be reloaded with the new configuration
+	ReloadWithRollback(restore func() error) error
+	// Configuration returns the configuration the agent is running with (nil if the agent was not started yet)
+	Configuration() *config.Configuration
+}
+
+// CheckExecutor interface contains a pointer to the agent instance to execute checks on demand
+type CheckExecutor interface {
+	// RunCheck executes the built-in check and returns the result
+	RunCheck(ctx context.Context, name string) (interface{}, error)
+	// RunCustomCheck executes the custom check and returns the result
+	RunCustomCheck(ctx context.Context, name string) (*utils.CommandResult, error)
+	// HasCheck returns true if the built-in check (or the custom check if custom is set) exists
+	HasCheck(ctx context.Context, name string, custom bool) bool
 }
 
 type reloadConfig struct {
@@ -48,12 +49,25 @@ type Server struct {
 	PrometheusInput     <-chan map[string]string
 	PackageManagerInput <-chan packagemanager.PackageInfo
 	Reloader            Reloader
+	CheckExecutor       CheckExecutor
 
 	reload   chan *reloadConfig
 	shutdown chan struct{}
 
-	server  *http.Server
-	handler *handler
+	// servers contains one http server for each listen spec
+	servers []*http.Server
+	// socketServer serves the unix domain socket (optional)
+	socketServer *http.Server
+	handler      *handler
+	// err is the error of the last reload
+	err    error
+	errMtx sync.Mutex
+	// history is kept across reloads
+	history *history
+	// runLimiter is kept across reloads, so a reload does not reset the rate limit
+	runLimiter *runLimiter
+	// certificates is kept across reloads as long as the certificate files do not change
+	certificates *certificateStore
 
 	wg sync.WaitGroup
 }
@@ -78,184 +92,306 @@ func isAutosslEnabled(cfg *config.Configuration) bool {
 	return false
 }
 
+// tlsFilesForConfiguration returns the certificate files of the webserver, returns false if tls is disabled
+func tlsFilesForConfiguration(cfg *config.Configuration) (certFile, keyFile, caFile string, ok bool) {
+	if isAutosslEnabled(cfg) {
+		log.Debugln("Webserver: Using AutoSSL certificates")
+		return cfg.AutoSslCrtFile, cfg.AutoSslKeyFile, cfg.AutoSslCaFile, true
+	}
+	if cfg.KeyFile == "" || cfg.CertificateFile == "" {
+		if cfg.AutoSslEnabled {
+			log.Infoln("Webserver: autossl enabled, but no certificates found")
+		}
+		return "", "", "", false
+	}
+	return cfg.CertificateFile, cfg.KeyFile, "", true
+}
+
+// tlsConfigForConfiguration returns the tls configuration of the webserver without certificates
+func tlsConfigForConfiguration(cfg *config.Configuration) *tls.Config {
+	// the values for "intermediate" and "modern" are taken from https://ssl-config.mozilla.org/
+	// also see https://wiki.mozilla.org/Security/Server_Side_TLS for more information about client compatibility
+	var tlsConfig *tls.Config
+	switch cfg.TlsSecurityLevel {
+	case "intermediate":
+		log.Infoln("Webserver: Using intermediate TLS configuration")
+		tlsConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			CurvePreferences: []tls.CurveID{
+				tls.X25519, // Go 1.8+
+				tls.CurveP256,
+				tls.CurveP384,
+				//tls.x25519Kyber768Draft00, // Go 1.23+
+			},
+			CipherSuites: []uint16{
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			},
+		}
+	case "modern":
+		log.Infoln("Webserver: Using modern TLS configuration")
+		tlsConfig = &tls.Config{
+			MinVersion: tls.VersionTLS13,
+			CurvePreferences: []tls.CurveID{
+				tls.X25519, // Go 1.8+
+				tls.CurveP256,
+				tls.CurveP384,
+				//tls.x25519Kyber768Draft00, // Go 1.23+
+			},
+		}
+	default:
+		// Lax or any other typo in the config file
+		// Lax is the default behevior
+		log.Infoln("Webserver: Using lax TLS configuration")
+		tlsConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	log.Debugln("Webserver: TLS enabled")
+
+	if isAutosslEnabled(cfg) {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig
+}
+
+// certificatesForConfiguration returns the certificate store for the certificate files of the configuration
+// The running certificate store is kept if the files did not change, so the last good certificate is kept
+// if the files are broken. Returns nil if tls is disabled.
+func (s *Server) certificatesForConfiguration(cfg *config.Configuration) (*certificateStore, error) {
+	certFile, keyFile, caFile, ok := tlsFilesForConfiguration(cfg)
+	if !ok {
+		return nil, nil
+	}
+	if s.certificates.uses(certFile, keyFile, caFile) {
+		s.certificates.reload()
+		return s.certificates, nil
+	}
+
+	certificates := newCertificateStore(certFile, keyFile, caFile)
+	if err := certificates.load(); err != nil {
+		return nil, err
+	}
+	return certificates, nil
+}
+
+// listen opens the listener of the webserver, retries as long as the old server may still use the address
+func listen(network, address string) (net.Listener, error) {
+	trys := 30
+	if runtime.GOOS == "freebsd" {
+		// For some reason the check is buggy on FreeBSD, so we reduce the number of tries
+		trys = 5
+	}
+
+	var err error
+	for i := 0; i < trys; i++ {
+		var l net.Listener
+		l, err = net.Listen(network, address)
+		if err == nil {
+			return l, nil
+		}
+		log.Debugln("Webserver: Could not listen on ", address, ": ", err)
+		time.Sleep(time.Second)
+	}
+	return nil, err
+}
+
+func (s *Server) setErr(err error) {
+	s.errMtx.Lock()
+	defer s.errMtx.Unlock()
+	s.err = err
+}
+
+// Err returns the error of the last reload, or nil if the webserver is running
+func (s *Server) Err() error {
+	s.errMtx.Lock()
+	defer s.errMtx.Unlock()
+	return s.err
+}
+
 func (s *Server) doReload(ctx context.Context, cfg *reloadConfig) {
 	log.Infoln("Webserver: Reload")
+	defer func() {
+		log.Debugln("Webserver: Reload complete")
+		cfg.reloadDone <- struct{}{}
+	}()
+
+	specs, err := cfg.Configuration.ListenSpecs()
+	if err != nil {
+		log.Errorln("Webserver: ", err)
+		s.setErr(err)
+		return
+	}
+
+	// If the certificates are broken the old server keeps running
+	certificates, err := s.certificatesForConfiguration(cfg.Configuration)
+	if err != nil {
+		log.Errorln("Webserver: ", err)
+		s.setErr(err)
+		return
+	}
+	if certificates == nil {
+		for _, spec := range specs {
+			if spec.TLS == config.ListenTLSRequired {
+				err := fmt.Errorf("listener %s requires tls, but there is no certificate", spec.Address)
+				log.Errorln("Webserver: ", err)
+				s.setErr(err)
+				return
+			}
+		}
+	}
+
 	newHandler := &handler{
 		StateInput:          s.StateInput,
 		PrometheusInput:     s.PrometheusInput,
 		PackageManagerInput: s.PackageManagerInput,
 		Configuration:       cfg.Configuration,
 		Reloader:            s.Reloader,
+		CheckExecutor:       s.CheckExecutor,
+		History:             s.history,
+		RunLimiter:          s.runLimiter,
+		Certificates:        certificates,
 	}
-	newHandler.Start(ctx)
-	serverAddr := fmt.Sprintf("%s:%d", cfg.Configuration.Address, cfg.Configuration.Port)
-	log.Debugln("Webserver: Listening to ", serverAddr)
+	// An invalid basic auth is rejected before the old server gets stopped
+	if err := newHandler.configureBasicAuth(); err != nil {
+		log.Errorln("Webserver: ", err)
+		s.setErr(err)
+		return
+	}
+	s.history.configure(int(cfg.Configuration.HistorySize), int(cfg.Configuration.HistoryMaxBytes))
+	s.runLimiter.configure(time.Duration(cfg.Configuration.CheckRunMinInterval) * time.Second)
 	timeout := time.Second * 30
 	if cfg.Configuration.EnablePPROF {
 		timeout = time.Hour
 	}
-	newServer := &http.Server{
-		Addr:           serverAddr,
-		Handler:        newHandler.Handler(),
-		ReadTimeout:    timeout,
-		WriteTimeout:   timeout,
-		IdleTimeout:    timeout,
-		MaxHeaderBytes: 256 * 1024,
+	var tlsConfig *tls.Config
+	if certificates != nil {
+		tlsConfig = certificates.tlsConfig(tlsConfigForConfiguration(cfg.Configuration))
 	}
-
-	if isAutosslEnabled(cfg.Configuration) || (cfg.Configuration.KeyFile != "" && cfg.Configuration.CertificateFile != "") {
-		// the values for "intermediate" and "modern" are taken from https://ssl-config.mozilla.org/
-		// also see https://wiki.mozilla.org/Security/Server_Side_TLS for more information about client compatibility
-		var tlsConfig *tls.Config
-		switch cfg.Configuration.TlsSecurityLevel {
-		case "intermediate":
-			log.Infoln("Webserver: Using intermediate TLS configuration")
-			tlsConfig = &tls.Config{
-				MinVersion: tls.VersionTLS12,
-				CurvePreferences: []tls.CurveID{
-					tls.X25519, // Go 1.8+
-					tls.CurveP256,
-					tls.CurveP384,
-					//tls.x25519Kyber768Draft00, // Go 1.23+
-				},
-				CipherSuites: []uint16{
-					tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-					tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-					tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-					tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-					tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-					tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-				},
-			}
-		case "modern":
-			log.Infoln("Webserver: Using modern TLS configuration")
-			tlsConfig = &tls.Config{
-				MinVersion: tls.VersionTLS13,
-				CurvePreferences: []tls.CurveID{
-					tls.X25519, // Go 1.8+
-					tls.CurveP256,
-					tls.CurveP384,
-					//tls.x25519Kyber768Draft00, // Go 1.23+
-				},
-			}
-		default:
-			// Lax or any other typo in the config file
-			// Lax is the default behevior
-			log.Infoln("Webserver: Using lax TLS configuration")
-			tlsConfig = &tls.Config{
-				MinVersion: tls.VersionTLS12,
+	newServers := make([]*http.Server, 0, len(specs))
+	for _, spec := range specs {
+		useTLS := tlsConfig != nil && spec.TLS != config.ListenTLSNone
+		authentication := spec.Auth != config.ListenAuthNone
+		newServer := &http.Server{
+			Addr:           spec.Address,
+			Handler:        newHandler.ListenHandler(useTLS && authentication, authentication),
+			ReadTimeout:    timeout,
+			WriteTimeout:   timeout,
+			IdleTimeout:    timeout,
+			MaxHeaderBytes: 256 * 1024,
+		}
+		if useTLS {
+			newServer.TLSConfig = tlsConfig
+			if !authentication {
+				newServer.TLSConfig = certificates.withoutClientAuth(tlsConfig)
 			}
+			newServer.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
 		}
+		newServers = append(newServers, newServer)
+	}
 
-		log.Debugln("Webserver: TLS enabled")
-
-		certFilePath := cfg.Configuration.CertificateFile
-		keyFilePath := cfg.Configuration.KeyFile
-		caFilePath := ""
-		if cfg.Configuration.AutoSslEnabled {
-			log.Debugln("Webserver: Using AutoSSL certificates")
-
-			certFilePath = cfg.Configuration.AutoSslCrtFile
-			keyFilePath = cfg.Configuration.AutoSslKeyFile
-			caFilePath = cfg.Configuration.AutoSslCaFile
-
-			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
-		}
-		pem := bytes.Buffer{}
+	s.close()
+	s.setCertificates(certificates)
 
-		certPem, err := os.ReadFile(certFilePath)
-		if err != nil {
-			log.Fatalln("Webserver: Could not read server certificate: ", err)
-		}
-		pem.Write(certPem)
-		pem.WriteByte('\n')
-		keyPem, err := os.ReadFile(keyFilePath)
+	listeners := make([]net.Listener, 0, len(specs))
+	for _, spec := range specs {
+		log.Debugln("Webserver: Listening to ", spec)
+		listener, err := listen(spec.Network, spec.Address)
 		if err != nil {
-			log.Fatalln("Webserver: Could not read server key: ", err)
-		}
-
-		if caFilePath != "" {
-			pool, caPem, err := utils.CertPoolFromFiles(caFilePath)
-			if err != nil {
-				log.Fatalln("Webserver: ", err)
+			log.Errorln("Webserver: Could not listen on ", spec.Address, ": ", err)
+			for _, l := range listeners {
+				_ = l.Close()
 			}
-			tlsConfig.ClientCAs = pool
-			log.Debugln("Webserver: Loaded ca certificate")
-			pem.Write(caPem)
-		}
-
-		cert, err := tls.X509KeyPair(pem.Bytes(), keyPem)
-		if err != nil {
-			log.Fatal("Webserver: Could not load tls certificate: ", err)
+			s.setErr(err)
+			return
 		}
-		log.Debugln("Webserver: Loaded server cerificate")
-
-		tlsConfig.Certificates = []tls.Certificate{cert}
-
-		newServer.TLSConfig = tlsConfig
-		newServer.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
-	} else if cfg.Configuration.AutoSslEnabled {
-		log.Infoln("Webserver: autossl enabled, but no certificates found")
+		listeners = append(listeners, listener)
 	}
 
-	s.close()
+	newHandler.Start(ctx)
 	s.handler = newHandler
+	s.setErr(nil)
 
-	// test that old server stopped
-	if s.server != nil {
-		for i := 0; i < 30; i++ {
-			log.Debugln("Webserver: Testing for closed port ", s.server.Addr)
-			if !testPortOpen(s.server.Addr) {
-				break
-			}
-			time.Sleep(time.Second)
-		}
+	for i, newServer := range newServers {
+		s.serve(newServer, listeners[i])
 	}
+	s.servers = newServers
 
-	// test if new port is really ready
-	for i := 0; i < 30; i++ {
-		log.Debugln("Webserver: First testing for open port ", newServer.Addr)
-		if !testPortOpen(newServer.Addr) {
-			break
+	if cfg.Configuration.Socket != "" {
+		socketListener, err := listenSocket(cfg.Configuration)
+		if err != nil {
+			log.Errorln("Webserver: Could not listen on socket ", cfg.Configuration.Socket, ": ", err)
+			s.setErr(err)
+			return
 		}
-		time.Sleep(time.Second)
+		log.Debugln("Webserver: Listening to socket ", cfg.Configuration.Socket)
+		socketServer := &http.Server{
+			Handler:        newHandler.SocketHandler(),
+			ReadTimeout:    timeout,
+			WriteTimeout:   timeout,
+			IdleTimeout:    timeout,
+			MaxHeaderBytes: 256 * 1024,
+		}
+		s.serve(socketServer, socketListener)
+		s.socketServer = socketServer
 	}
+}
 
+// serve runs the http server in background until it gets closed
+func (s *Server) serve(server *http.Server, listener net.Listener) {
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
-		log.Infoln("Webserver: Starting http server")
-		err := listenServe(newServer)
+		log.Infoln("Webserver: Starting http server on ", listener.Addr())
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatal("Webserver: ", err)
+			log.Errorln("Webserver: ", err)
+			s.setErr(err)
 		}
 		log.Debugln("Webserver: http listener stopped")
 	}()
+}
 
-	s.server = newServer
-	trys := 30
-	if runtime.GOOS == "freebsd" {
-		// For some reason the check is buggy on FreeBSD, so we reduce the number of tries
-		trys = 5
+// setCertificates replaces the certificate store and watches the certificate files of the new store
+func (s *Server) setCertificates(certificates *certificateStore) {
+	if s.certificates == certificates {
+		return
 	}
-	for i := 0; i < trys; i++ {
-		log.Debugln("Webserver: Second testing for open port ", newServer.Addr)
-		if testPortOpen(newServer.Addr) {
-			break
-		}
-		time.Sleep(time.Second)
+	s.certificates.Shutdown()
+	s.certificates = certificates
+	if certificates != nil {
+		certificates.watch()
 	}
-	log.Debugln("Webserver: Reload complete")
-	cfg.reloadDone <- struct{}{}
 }
 
 func (s *Server) close() {
-	if s.server != nil {
+	if s.handler != nil {
+		s.handler.beforeClose()
+	}
+	if len(s.servers) > 0 {
 		log.Debugln("Webserver: Stopping http server")
-		_ = s.server.Close()
-		s.server = nil
+		for _, server := range s.servers {
+			_ = server.Close()
+		}
+		s.servers = nil
 		log.Infoln("Webserver: Server stopped")
 	}
+	if s.socketServer != nil {
+		// closing the listener also removes the socket file
+		_ = s.socketServer.Close()
+		s.socketServer = nil
+		log.Infoln("Webserver: Socket server stopped")
+	}
 	if s.handler != nil {
 		log.Debugln("Webserver: Stopping handler")
 		s.handler.Shutdown()
@@ -264,13 +400,6 @@ func (s *Server) close() {
 	}
 }
 
-func listenServe(server *http.Server) error {
-	if server.TLSConfig != nil {
-		return server.ListenAndServeTLS("", "")
-	}
-	return server.ListenAndServe()
-}
-
 // Reload webserver configuration
 func (s *Server) Reload(cfg *config.Configuration) {
 	done := make(chan struct{})
@@ -296,11 +425,14 @@ func (s *Server) Shutdown() {
 func (s *Server) Start(ctx context.Context) {
 	s.shutdown = make(chan struct{})
 	s.reload = make(chan *reloadConfig)
+	s.history = newHistory(0, 0)
+	s.runLimiter = newRunLimiter(0)
 
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
 
+		defer s.setCertificates(nil)
 		defer s.close()
 
 		for {
@@ -1,9 +1,12 @@
 package webserver
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
@@ -11,6 +14,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"testing"
 	"time"
 
@@ -82,6 +86,37 @@ func TestServerCancel(t *testing.T) {
 	}
 }
 
+func TestServerInvalidBasicAuth(t *testing.T) {
+	stateInput := make(chan []byte)
+	srv := &Server{
+		StateInput: stateInput,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv.Start(ctx)
+	defer srv.Shutdown()
+
+	port := dynamicPort()
+	srv.Reload(&config.Configuration{
+		Port: port,
+	})
+	if err := srv.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Reload(&config.Configuration{
+		Port:      port,
+		BasicAuth: "invalid",
+	})
+	if srv.Err() == nil {
+		t.Error("expected error for invalid basic auth")
+	}
+	// the previous server keeps running
+	if !connectionTest("localhost", int(port), nil) {
+		t.Error("server is not running")
+	}
+}
+
 func TestServerTLS(t *testing.T) {
 	crt, err := copyTestCertificates(false)
 	if err != nil {
@@ -248,6 +283,231 @@ func TestServerAutoTLSBasicAuthRealClient(t *testing.T) {
 	}
 }
 
+func TestServerSocket(t *testing.T) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	socket := filepath.Join(tmpDir, "agent.sock")
+
+	srv := &Server{
+		StateInput: make(chan []byte),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv.Start(ctx)
+
+	port := dynamicPort()
+	cfg := &config.Configuration{
+		Port:       port,
+		BasicAuth:  testBasicAuth,
+		Socket:     socket,
+		SocketMode: "0600",
+	}
+	srv.Reload(cfg)
+	if err := srv.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0600 {
+			t.Error("unexpected socket mode: ", fi.Mode())
+		}
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+		Timeout: time.Second * 5,
+	}
+	get := func(url string) int {
+		r, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, r.Body)
+		_ = r.Body.Close()
+		return r.StatusCode
+	}
+
+	// the socket does not use basic auth
+	if status := get("http://agent/"); status != http.StatusOK {
+		t.Error("unexpected status code on socket: ", status)
+	}
+	r, err := http.Get(fmt.Sprintf("http://localhost:%d/", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Body.Close()
+	if r.StatusCode != http.StatusUnauthorized {
+		t.Error("unexpected status code without credentials: ", r.StatusCode)
+	}
+
+	// the old socket gets replaced on reload
+	client.CloseIdleConnections()
+	srv.Reload(cfg)
+	if err := srv.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if status := get("http://agent/checks"); status != http.StatusOK {
+		t.Error("unexpected status code on socket after reload: ", status)
+	}
+
+	client.CloseIdleConnections()
+	srv.Shutdown()
+	if utils.FileExists(socket) {
+		t.Error("socket was not removed on shutdown")
+	}
+}
+
+func TestServerListenSpecs(t *testing.T) {
+	crt, err := copyTestCertificates(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(crt.tmpDir)
+	}()
+
+	srv := &Server{
+		StateInput: make(chan []byte),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv.Start(ctx)
+
+	plainPort, mtlsPort, tlsPort := dynamicPort(), dynamicPort(), dynamicPort()
+	srv.Reload(&config.Configuration{
+		AutoSslEnabled: true,
+		AutoSslFolder:  crt.tmpDir,
+		AutoSslCrtFile: crt.certPath,
+		AutoSslKeyFile: crt.keyPath,
+		AutoSslCaFile:  crt.caCertPath,
+		BasicAuth:      testBasicAuth,
+		Listen: []string{
+			fmt.Sprintf("127.0.0.1:%d tls=none auth=none", plainPort),
+			fmt.Sprintf("127.0.0.1:%d tls=required", mtlsPort),
+			fmt.Sprintf("localhost:%d auth=none", tlsPort),
+		},
+	})
+	if err := srv.Err(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Shutdown()
+
+	caPool, _, err := utils.CertPoolFromFiles(crt.caCertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := tls.LoadX509KeyPair(crt.certClientPath, crt.keyClientPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(url string, clientCerts []tls.Certificate, basicAuth bool) (int, error) {
+		c := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs:      caPool,
+					Certificates: clientCerts,
+				},
+			},
+			Timeout: time.Second * 5,
+		}
+		defer c.CloseIdleConnections()
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if basicAuth {
+			req.SetBasicAuth(testBasicAuthUser, testBasicAuthPassword)
+		}
+		res, err := c.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		_, _ = io.Copy(io.Discard, res.Body)
+		_ = res.Body.Close()
+		return res.StatusCode, nil
+	}
+
+	// plain http without authentication
+	if status, err := get(fmt.Sprintf("http://127.0.0.1:%d/", plainPort), nil, false); err != nil || status != http.StatusOK {
+		t.Error("unexpected response from plain listener: ", status, err)
+	}
+
+	// mTLS with basic auth
+	mtlsURL := fmt.Sprintf("https://localhost:%d/", mtlsPort)
+	if status, err := get(mtlsURL, []tls.Certificate{clientCert}, true); err != nil || status != http.StatusOK {
+		t.Error("unexpected response from mtls listener: ", status, err)
+	}
+	if status, err := get(mtlsURL, []tls.Certificate{clientCert}, false); err != nil || status != http.StatusUnauthorized {
+		t.Error("unexpected response from mtls listener without credentials: ", status, err)
+	}
+	if _, err := get(mtlsURL, nil, true); err == nil {
+		t.Error("mtls listener accepted connection without client certificate")
+	}
+
+	// tls without authentication does not request a client certificate
+	if status, err := get(fmt.Sprintf("https://localhost:%d/", tlsPort), nil, false); err != nil || status != http.StatusOK {
+		t.Error("unexpected response from tls listener without authentication: ", status, err)
+	}
+
+	// a listener which requires tls does not start without certificates, the running server is kept
+	srv.Reload(&config.Configuration{
+		Listen: []string{fmt.Sprintf("127.0.0.1:%d tls=required", dynamicPort())},
+	})
+	if srv.Err() == nil {
+		t.Error("expected error for tls listener without certificate")
+	}
+	if status, err := get(fmt.Sprintf("http://127.0.0.1:%d/", plainPort), nil, false); err != nil || status != http.StatusOK {
+		t.Error("server was stopped by failed reload: ", status, err)
+	}
+}
+
+func TestServerListenDualStack(t *testing.T) {
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available: ", err)
+	}
+	_ = l.Close()
+
+	srv := &Server{
+		StateInput: make(chan []byte),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv.Start(ctx)
+
+	// separate IPv4 and IPv6 wildcard listeners on the same port
+	port := dynamicPort()
+	srv.Reload(&config.Configuration{
+		Listen: []string{
+			fmt.Sprintf("0.0.0.0:%d", port),
+			fmt.Sprintf("[::]:%d", port),
+		},
+	})
+	if err := srv.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !connectionTest("127.0.0.1", int(port), nil) {
+		t.Error("IPv4 listener did not start")
+	}
+	if !connectionTest("::1", int(port), nil) {
+		t.Error("IPv6 listener did not start")
+	}
+	srv.Shutdown()
+}
+
 func dynamicPort() int64 {
 	addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
 	if err != nil {
@@ -266,7 +526,7 @@ func dynamicPort() int64 {
 
 func connectionTest(host string, port int, crt *certs) bool {
 	timeout := time.Second
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", host, port), timeout)
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
 	if err != nil {
 		return false
 	}
@@ -357,3 +617,81 @@ func copyTestCertificates(autoTLS bool) (*certs, error) {
 	ok = true
 	return crt, nil
 }
+
+// restartReloader reloads the server with another port like the agent after a configuration push
+type restartReloader struct {
+	srv *Server
+	cfg *config.Configuration
+}
+
+func (r *restartReloader) Reload() {}
+
+func (r *restartReloader) Configuration() *config.Configuration {
+	return nil
+}
+
+func (r *restartReloader) ReloadWithRollback(func() error) error {
+	r.srv.Reload(r.cfg)
+	return r.srv.Err()
+}
+
+func TestServerConfigPushRestart(t *testing.T) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	port := dynamicPort()
+	newPort := dynamicPort()
+	cfg := &config.Configuration{
+		Address:              "127.0.0.1",
+		Port:                 port,
+		ConfigUpdate:         true,
+		ConfigurationPath:    filepath.Join(tmpDir, "config.ini"),
+		CustomchecksFilePath: filepath.Join(tmpDir, "customchecks.ini"),
+		Prometheus:           &config.PrometheusConfiguration{},
+	}
+	newCfg := *cfg
+	newCfg.Port = newPort
+
+	srv := &Server{
+		StateInput: make(chan []byte),
+	}
+	srv.Reloader = &restartReloader{srv: srv, cfg: &newCfg}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv.Start(ctx)
+	defer srv.Shutdown()
+
+	srv.Reload(cfg)
+	if err := srv.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(&configurationPush{
+		Configuration: base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("[default]\naddress = 127.0.0.1\nport = %d\n", newPort))),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/config", port), "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("push got no response: ", err)
+	}
+	result := &configurationPushResult{}
+	err = json.NewDecoder(resp.Body).Decode(result)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusAccepted || !result.Success {
+		t.Error("unexpected result: ", resp.StatusCode, result)
+	}
+
+	if !connectionTest("127.0.0.1", int(newPort), nil) {
+		t.Error("server was not restarted")
+	}
+}
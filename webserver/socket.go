@@ -0,0 +1,53 @@
+package webserver
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"runtime"
+
+	"github.com/openITCOCKPIT/openitcockpit-agent-go/config"
+)
+
+// listenSocket opens the unix domain socket of the webserver and sets the configured permissions
+func listenSocket(cfg *config.Configuration) (net.Listener, error) {
+	mode, err := cfg.SocketFileMode()
+	if err != nil {
+		return nil, err
+	}
+	uid, gid, err := cfg.SocketOwnerIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	// A socket file is left behind if the agent did not stop cleanly
+	if fi, err := os.Lstat(cfg.Socket); err == nil {
+		if fi.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", cfg.Socket)
+		}
+		if err := os.Remove(cfg.Socket); err != nil {
+			return nil, fmt.Errorf("could not remove old socket: %w", err)
+		}
+	}
+
+	listener, err := listenUnix(cfg.Socket)
+	if err != nil {
+		return nil, err
+	}
+
+	// On Windows the access is restricted by the permissions of the socket folder
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(cfg.Socket, mode); err != nil {
+			_ = listener.Close()
+			return nil, fmt.Errorf("could not set socket mode: %w", err)
+		}
+		if uid != -1 || gid != -1 {
+			if err := os.Chown(cfg.Socket, uid, gid); err != nil {
+				_ = listener.Close()
+				return nil, fmt.Errorf("could not set socket owner: %w", err)
+			}
+		}
+	}
+	return listener, nil
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package webserver
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+var umaskMtx sync.Mutex
+
+// listenUnix creates the socket with a restrictive umask, so it is only accessible by the owner
+// until the configured mode and owner are set
+func listenUnix(path string) (net.Listener, error) {
+	umaskMtx.Lock()
+	defer umaskMtx.Unlock()
+
+	oldMask := syscall.Umask(0077)
+	defer syscall.Umask(oldMask)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,45 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package webserver
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestListenUnixMode(t *testing.T) {
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "*-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	socket := filepath.Join(tmpDir, "agent.sock")
+
+	// the socket must not be accessible by others before the configured mode is set, even with an open umask
+	oldMask := syscall.Umask(0)
+	defer syscall.Umask(oldMask)
+
+	listener, err := listenUnix(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	fi, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		t.Error("socket is accessible by others after creation: ", fi.Mode())
+	}
+	if mask := syscall.Umask(0); mask != 0 {
+		t.Error("umask not restored: ", mask)
+	}
+}
@@ -0,0 +1,10 @@
+package webserver
+
+import (
+	"net"
+)
+
+// listenUnix creates the socket, the access is restricted by the permissions of the socket folder
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}